@@ -2,18 +2,22 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/communicationInterface"
 	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/config"
 	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/credentialFetcher"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/daemon"
 	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/logger"
 	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/provider"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/tokenCache"
 	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/vault"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -54,47 +58,46 @@ func executeRootCmd(cmd *cobra.Command, args []string) {
 		handleShutdown(ctx, shutdownReasonSignal)
 	}()
 
-	// setup initial logger (to log errors before config is loaded and logger is initialized)
-	initialLogger, err := logger.NewFileLogger(true, logger.DefaultLogFile, "error")
-	log = initialLogger
-	if err != nil {
-		log.Log(ctx, slog.LevelError, "Failed to initialize initial logger", "error", err)
-		handleShutdown(ctx, shutdownReasonError)
-		return
-	}
-
-	// load config
-	cfg, err := config.New(ctx, log, configFile)
-	if err != nil {
-		log.Log(ctx, slog.LevelError, "Failed to load configuration", "error", err)
-		handleShutdown(ctx, shutdownReasonError)
-		return
-	}
-
-	// setup logger
-	newLogger, err := logger.NewFileLogger(cfg.Log.Enabled, cfg.Log.File, cfg.Log.Level)
-	log = newLogger
+	// load config and setup logger
+	cfg, err := setup(ctx)
 	if err != nil {
-		log.Log(ctx, slog.LevelError, "Failed to initialize logger", "error", err)
 		handleShutdown(ctx, shutdownReasonError)
 		return
 	}
-
-	// log startup information after logger is initialized
-	log.Log(ctx, slog.LevelDebug, "Loaded configuration", "config", *cfg)
-	log.Log(ctx, slog.LevelDebug, "Initialized logger", "file", cfg.Log.File, "level", cfg.Log.Level)
 	log.Log(ctx, slog.LevelInfo, "Starting kubelet-credential-provider-vault", "version", version)
 
 	// setup communication interface (stdio)
 	communicationInterface := communicationInterface.NewStdIOCommunicationInterface()
 	log.Log(ctx, slog.LevelDebug, "Initialized communication interface", "interface", "StdIO")
 
+	// forward the request to the daemon (optional), it is handled in-process if the daemon is not available
+	if cfg.Daemon.Socket != "" {
+		err = daemon.NewClient(cfg.Daemon.Socket, cfg.Daemon.Timeout).Forward(ctx, log, communicationInterface)
+		if err == nil {
+			handleShutdown(ctx, shutdownReasonFinished)
+			return
+		}
+		if !errors.Is(err, daemon.ErrDaemonUnavailable) {
+			log.Log(ctx, slog.LevelError, "Failed to forward request to daemon", "error", err)
+			handleShutdown(ctx, shutdownReasonError)
+			return
+		}
+		log.Log(ctx, slog.LevelWarn, "Daemon is not available, handling request in-process", "socket", cfg.Daemon.Socket, "error", err)
+	}
+
+	// setup token cache (optional)
+	var tokenCacheImpl tokenCache.TokenCache
+	if cfg.Vault.TokenCache.Enabled {
+		tokenCacheImpl = tokenCache.NewFileTokenCache(cfg.Vault.TokenCache.Directory, cfg.Vault.TokenCache.KeyFile)
+		log.Log(ctx, slog.LevelDebug, "Initialized token cache", "directory", cfg.Vault.TokenCache.Directory)
+	}
+
 	// setup credential fetcher (vault)
-	credentialFetcher := credentialFetcher.NewVaultCredentialFetcher(vault.NewHashicorpClientBuilder(), &cfg.Vault)
+	credentialFetcher := credentialFetcher.NewVaultCredentialFetcher(vault.NewHashicorpClientBuilder, &cfg.Vault, cfg.Registries, cfg.CacheKeyType, tokenCacheImpl, nil)
 	log.Log(ctx, slog.LevelDebug, "Initialized credential fetcher", "fetcher", "Vault")
 
 	// provide credentials to kubelet
-	provider := provider.NewKubeletCredentialProvider(communicationInterface, credentialFetcher)
+	provider := provider.NewKubeletCredentialProvider(communicationInterface, credentialFetcher, &cfg.Graceful)
 	err = provider.Run(ctx, log)
 	if err != nil {
 		log.Log(ctx, slog.LevelError, "Failed to run provider", "error", err)
@@ -107,6 +110,37 @@ func executeRootCmd(cmd *cobra.Command, args []string) {
 	handleShutdown(ctx, shutdownReasonFinished)
 }
 
+// setup loads the configuration and initializes the logger, errors are logged
+func setup(ctx context.Context) (*config.Configuration, error) {
+	// setup initial logger (to log errors before config is loaded and logger is initialized)
+	initialLogger, err := logger.NewFileLogger(true, logger.DefaultLogFile, "error")
+	log = initialLogger
+	if err != nil {
+		log.Log(ctx, slog.LevelError, "Failed to initialize initial logger", "error", err)
+		return nil, err
+	}
+
+	// load config
+	cfg, err := config.New(ctx, log, configFile)
+	if err != nil {
+		log.Log(ctx, slog.LevelError, "Failed to load configuration", "error", err)
+		return nil, err
+	}
+
+	// setup logger
+	newLogger, err := logger.NewFileLogger(cfg.Log.Enabled, cfg.Log.File, cfg.Log.Level)
+	log = newLogger
+	if err != nil {
+		log.Log(ctx, slog.LevelError, "Failed to initialize logger", "error", err)
+		return nil, err
+	}
+
+	// log startup information after logger is initialized
+	log.Log(ctx, slog.LevelDebug, "Loaded configuration", "config", *cfg)
+	log.Log(ctx, slog.LevelDebug, "Initialized logger", "file", cfg.Log.File, "level", cfg.Log.Level)
+	return cfg, nil
+}
+
 type shutdownReason string
 
 const (
@@ -144,66 +178,330 @@ func Execute() {
 }
 
 func init() {
-	rootCmd.Flags().StringVar(&configFile, "config", "", "configuration file to use. If not set, the application will look for "+config.DefaultConfigFile)
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "configuration file to use. If not set, the application will look for "+config.DefaultConfigFile)
 	// no viper bind for config file because it must be handled before viper
 
-	rootCmd.Flags().String("log-file", logger.DefaultLogFile, "file the logger will write to")
+	rootCmd.PersistentFlags().String("log-file", logger.DefaultLogFile, "file the logger will write to")
 	// nolint:errcheck
-	viper.BindPFlag("log.file", rootCmd.Flags().Lookup("log-file")) //gosec:disable G104
+	viper.BindPFlag("log.file", rootCmd.PersistentFlags().Lookup("log-file")) //gosec:disable G104
 	// nolint:errcheck
 	viper.BindEnv("log.file", "LOG_FILE") //gosec:disable G104
 
-	rootCmd.Flags().String("log-level", "info", "log level to use. Possible values: debug, info, warn, error")
+	rootCmd.PersistentFlags().String("log-level", "info", "log level to use. Possible values: debug, info, warn, error")
 	// nolint:errcheck
-	viper.BindPFlag("log.level", rootCmd.Flags().Lookup("log-level")) //gosec:disable G104
+	viper.BindPFlag("log.level", rootCmd.PersistentFlags().Lookup("log-level")) //gosec:disable G104
 	// nolint:errcheck
 	viper.BindEnv("log.level", "LOG_LEVEL") //gosec:disable G104
 
-	rootCmd.Flags().Bool("log-enabled", true, "enable or disable logging")
+	rootCmd.PersistentFlags().Bool("log-enabled", true, "enable or disable logging")
 	// nolint:errcheck
-	viper.BindPFlag("log.enabled", rootCmd.Flags().Lookup("log-enabled")) //gosec:disable G104
+	viper.BindPFlag("log.enabled", rootCmd.PersistentFlags().Lookup("log-enabled")) //gosec:disable G104
 	// nolint:errcheck
 	viper.BindEnv("log.enabled", "LOG_ENABLED") //gosec:disable G104
 
-	rootCmd.Flags().String("vault-addr", "", "address of the Vault server")
+	rootCmd.PersistentFlags().String("cache-key-type", "Registry", "cache key type of the response. Possible values: Image, Registry, Global")
+	// nolint:errcheck
+	viper.BindPFlag("cacheKeyType", rootCmd.PersistentFlags().Lookup("cache-key-type")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("cacheKeyType", "CACHE_KEY_TYPE") //gosec:disable G104
+
+	rootCmd.PersistentFlags().Bool("graceful-enabled", false, "write a response without credentials instead of failing if the service account token is missing, no registry matches the image or the secret does not exist")
+	// nolint:errcheck
+	viper.BindPFlag("graceful.enabled", rootCmd.PersistentFlags().Lookup("graceful-enabled")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("graceful.enabled", "GRACEFUL_ENABLED") //gosec:disable G104
+
+	rootCmd.PersistentFlags().Duration("graceful-cache-duration", time.Minute, "cache duration of responses without credentials (0 disables the caching by the kubelet)")
+	// nolint:errcheck
+	viper.BindPFlag("graceful.cacheDuration", rootCmd.PersistentFlags().Lookup("graceful-cache-duration")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("graceful.cacheDuration", "GRACEFUL_CACHE_DURATION") //gosec:disable G104
+
+	rootCmd.PersistentFlags().String("daemon-socket", "", "unix socket of the daemon (serve command). If set, requests are forwarded to the daemon and handled in-process if it is not available")
+	// nolint:errcheck
+	viper.BindPFlag("daemon.socket", rootCmd.PersistentFlags().Lookup("daemon-socket")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("daemon.socket", "DAEMON_SOCKET") //gosec:disable G104
+
+	rootCmd.PersistentFlags().Duration("daemon-timeout", 5*time.Second, "timeout of a request to the daemon, the request is handled in-process if the daemon does not reply in time")
+	// nolint:errcheck
+	viper.BindPFlag("daemon.timeout", rootCmd.PersistentFlags().Lookup("daemon-timeout")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("daemon.timeout", "DAEMON_TIMEOUT") //gosec:disable G104
+
+	rootCmd.PersistentFlags().String("vault-addr", "", "address of the Vault server (http://, https:// or unix:// for a local Vault Agent / Proxy socket)")
 	// nolint:errcheck
-	viper.BindPFlag("vault.address", rootCmd.Flags().Lookup("vault-addr")) //gosec:disable G104
+	viper.BindPFlag("vault.address", rootCmd.PersistentFlags().Lookup("vault-addr")) //gosec:disable G104
 	// nolint:errcheck
 	viper.BindEnv("vault.address", "VAULT_ADDR") //gosec:disable G104
 
-	rootCmd.Flags().Bool("vault-insecure-skip-verify", false, "skip TLS verification of the Vault server")
+	rootCmd.PersistentFlags().Bool("vault-insecure-skip-verify", false, "skip TLS verification of the Vault server")
 	// nolint:errcheck
-	viper.BindPFlag("vault.insecureSkipVerify", rootCmd.Flags().Lookup("vault-insecure-skip-verify")) //gosec:disable G104
+	viper.BindPFlag("vault.insecureSkipVerify", rootCmd.PersistentFlags().Lookup("vault-insecure-skip-verify")) //gosec:disable G104
 	// nolint:errcheck
 	viper.BindEnv("vault.insecureSkipVerify", "VAULT_INSECURE_SKIP_VERIFY") //gosec:disable G104
 
-	rootCmd.Flags().String("vault-auth-method", "kubernetes", "name of the auth method to use. Possible values: kubernetes")
+	rootCmd.PersistentFlags().String("vault-ca-cert", "", "PEM-encoded CA certificate file to verify the Vault server certificate")
 	// nolint:errcheck
-	viper.BindPFlag("vault.auth.method", rootCmd.Flags().Lookup("vault-auth-method")) //gosec:disable G104
+	viper.BindPFlag("vault.caCert", rootCmd.PersistentFlags().Lookup("vault-ca-cert")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.caCert", "VAULT_CACERT") //gosec:disable G104
+
+	rootCmd.PersistentFlags().String("vault-tls-server-name", "", "server name to verify the Vault server certificate against")
+	// nolint:errcheck
+	viper.BindPFlag("vault.tlsServerName", rootCmd.PersistentFlags().Lookup("vault-tls-server-name")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.tlsServerName", "VAULT_TLS_SERVER_NAME") //gosec:disable G104
+
+	rootCmd.PersistentFlags().String("vault-namespace", "", "vault enterprise namespace to use for login and secret reads")
+	// nolint:errcheck
+	viper.BindPFlag("vault.namespace", rootCmd.PersistentFlags().Lookup("vault-namespace")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.namespace", "VAULT_NAMESPACE") //gosec:disable G104
+
+	rootCmd.PersistentFlags().StringToString("vault-namespace-mapping", map[string]string{}, "mapping of kubernetes namespaces (from the service account token) to child namespaces of the vault namespace, e.g. team-a=tenants/team-a")
+	// nolint:errcheck
+	viper.BindPFlag("vault.namespaceMapping", rootCmd.PersistentFlags().Lookup("vault-namespace-mapping")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.namespaceMapping", "VAULT_NAMESPACE_MAPPING") //gosec:disable G104
+
+	rootCmd.PersistentFlags().String("vault-auth-method", "kubernetes", "name of the auth method to use. Possible values: kubernetes, jwt, approle, cert, token, agent, aws")
+	// nolint:errcheck
+	viper.BindPFlag("vault.auth.method", rootCmd.PersistentFlags().Lookup("vault-auth-method")) //gosec:disable G104
 	// nolint:errcheck
 	viper.BindEnv("vault.auth.method", "VAULT_AUTH_METHOD") //gosec:disable G104
 
-	rootCmd.Flags().String("vault-auth-mount", "", "name of the auth mount to use")
+	rootCmd.PersistentFlags().String("vault-auth-mount", "", "name of the auth mount to use")
 	// nolint:errcheck
-	viper.BindPFlag("vault.auth.mount", rootCmd.Flags().Lookup("vault-auth-mount")) //gosec:disable G104
+	viper.BindPFlag("vault.auth.mount", rootCmd.PersistentFlags().Lookup("vault-auth-mount")) //gosec:disable G104
 	// nolint:errcheck
 	viper.BindEnv("vault.auth.mount", "VAULT_AUTH_MOUNT") //gosec:disable G104
 
-	rootCmd.Flags().String("vault-auth-role", "", "name of the auth role to use")
+	rootCmd.PersistentFlags().String("vault-auth-role", "", "name of the auth role to use")
 	// nolint:errcheck
-	viper.BindPFlag("vault.auth.role", rootCmd.Flags().Lookup("vault-auth-role")) //gosec:disable G104
+	viper.BindPFlag("vault.auth.role", rootCmd.PersistentFlags().Lookup("vault-auth-role")) //gosec:disable G104
 	// nolint:errcheck
 	viper.BindEnv("vault.auth.role", "VAULT_AUTH_ROLE") //gosec:disable G104
 
-	rootCmd.Flags().String("vault-secret-mount", "", "name of the secret mount to use")
+	rootCmd.PersistentFlags().String("vault-auth-approle-role-id-file", "", "file containing the role id for the approle auth method")
+	// nolint:errcheck
+	viper.BindPFlag("vault.auth.appRole.roleIdFile", rootCmd.PersistentFlags().Lookup("vault-auth-approle-role-id-file")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.auth.appRole.roleIdFile", "VAULT_AUTH_APPROLE_ROLE_ID_FILE") //gosec:disable G104
+
+	rootCmd.PersistentFlags().String("vault-auth-approle-secret-id-file", "", "file containing the secret id for the approle auth method")
+	// nolint:errcheck
+	viper.BindPFlag("vault.auth.appRole.secretIdFile", rootCmd.PersistentFlags().Lookup("vault-auth-approle-secret-id-file")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.auth.appRole.secretIdFile", "VAULT_AUTH_APPROLE_SECRET_ID_FILE") //gosec:disable G104
+
+	rootCmd.PersistentFlags().Bool("vault-auth-approle-secret-id-wrapped", false, "the secret id file contains a response-wrapping token that must be unwrapped first, requires the token cache")
+	// nolint:errcheck
+	viper.BindPFlag("vault.auth.appRole.secretIdWrapped", rootCmd.PersistentFlags().Lookup("vault-auth-approle-secret-id-wrapped")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.auth.appRole.secretIdWrapped", "VAULT_AUTH_APPROLE_SECRET_ID_WRAPPED") //gosec:disable G104
+
+	rootCmd.PersistentFlags().String("vault-auth-cert-file", "", "PEM-encoded client certificate file for the cert auth method")
+	// nolint:errcheck
+	viper.BindPFlag("vault.auth.cert.certFile", rootCmd.PersistentFlags().Lookup("vault-auth-cert-file")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.auth.cert.certFile", "VAULT_AUTH_CERT_FILE") //gosec:disable G104
+
+	rootCmd.PersistentFlags().String("vault-auth-cert-key-file", "", "PEM-encoded client key file for the cert auth method")
+	// nolint:errcheck
+	viper.BindPFlag("vault.auth.cert.keyFile", rootCmd.PersistentFlags().Lookup("vault-auth-cert-key-file")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.auth.cert.keyFile", "VAULT_AUTH_CERT_KEY_FILE") //gosec:disable G104
+
+	rootCmd.PersistentFlags().String("vault-auth-token-file", "", "file containing the token for the token auth method (e.g. a vault agent sink). If not set, VAULT_TOKEN is used")
+	// nolint:errcheck
+	viper.BindPFlag("vault.auth.token.file", rootCmd.PersistentFlags().Lookup("vault-auth-token-file")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.auth.token.file", "VAULT_AUTH_TOKEN_FILE") //gosec:disable G104
+
+	rootCmd.PersistentFlags().Bool("vault-auth-token-wrapped", false, "the token is a response-wrapping token that must be unwrapped first, requires the token cache (detected for sinks with wrap_ttl)")
+	// nolint:errcheck
+	viper.BindPFlag("vault.auth.token.wrapped", rootCmd.PersistentFlags().Lookup("vault-auth-token-wrapped")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.auth.token.wrapped", "VAULT_AUTH_TOKEN_WRAPPED") //gosec:disable G104
+
+	rootCmd.PersistentFlags().Bool("vault-auth-token-lookup-self", false, "lookup the token before use to check its ttl")
+	// nolint:errcheck
+	viper.BindPFlag("vault.auth.token.lookupSelf", rootCmd.PersistentFlags().Lookup("vault-auth-token-lookup-self")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.auth.token.lookupSelf", "VAULT_AUTH_TOKEN_LOOKUP_SELF") //gosec:disable G104
+
+	rootCmd.PersistentFlags().Duration("vault-auth-token-min-ttl", 0, "minimum remaining ttl of the token when lookup-self is enabled")
+	// nolint:errcheck
+	viper.BindPFlag("vault.auth.token.minTTL", rootCmd.PersistentFlags().Lookup("vault-auth-token-min-ttl")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.auth.token.minTTL", "VAULT_AUTH_TOKEN_MIN_TTL") //gosec:disable G104
+
+	rootCmd.PersistentFlags().String("vault-auth-aws-region", vault.DefaultAWSRegion, "aws region used to sign the sts request for the aws auth method")
+	// nolint:errcheck
+	viper.BindPFlag("vault.auth.aws.region", rootCmd.PersistentFlags().Lookup("vault-auth-aws-region")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.auth.aws.region", "VAULT_AUTH_AWS_REGION") //gosec:disable G104
+
+	rootCmd.PersistentFlags().String("vault-auth-aws-sts-endpoint", vault.DefaultAWSSTSEndpoint, "sts endpoint for the aws auth method")
+	// nolint:errcheck
+	viper.BindPFlag("vault.auth.aws.stsEndpoint", rootCmd.PersistentFlags().Lookup("vault-auth-aws-sts-endpoint")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.auth.aws.stsEndpoint", "VAULT_AUTH_AWS_STS_ENDPOINT") //gosec:disable G104
+
+	rootCmd.PersistentFlags().String("vault-auth-aws-header-value", "", "value of the X-Vault-AWS-IAM-Server-ID header for the aws auth method")
+	// nolint:errcheck
+	viper.BindPFlag("vault.auth.aws.headerValue", rootCmd.PersistentFlags().Lookup("vault-auth-aws-header-value")) //gosec:disable G104
 	// nolint:errcheck
-	viper.BindPFlag("vault.secret.mount", rootCmd.Flags().Lookup("vault-secret-mount")) //gosec:disable G104
+	viper.BindEnv("vault.auth.aws.headerValue", "VAULT_AUTH_AWS_HEADER_VALUE") //gosec:disable G104
+
+	rootCmd.PersistentFlags().String("vault-secret-engine", "kv-v2", "secret engine of the secret mount. Possible values: kv-v1, kv-v2, generic")
+	// nolint:errcheck
+	viper.BindPFlag("vault.secret.engine", rootCmd.PersistentFlags().Lookup("vault-secret-engine")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.secret.engine", "VAULT_SECRET_ENGINE") //gosec:disable G104
+
+	rootCmd.PersistentFlags().String("vault-secret-mount", "", "name of the secret mount to use (go template)")
+	// nolint:errcheck
+	viper.BindPFlag("vault.secret.mount", rootCmd.PersistentFlags().Lookup("vault-secret-mount")) //gosec:disable G104
 	// nolint:errcheck
 	viper.BindEnv("vault.secret.mount", "VAULT_SECRET_MOUNT") //gosec:disable G104
 
-	rootCmd.Flags().String("vault-secret-path", "", "path of the secret to use")
+	rootCmd.PersistentFlags().String("vault-secret-path", "", "path of the secret to use (go template)")
 	// nolint:errcheck
-	viper.BindPFlag("vault.secret.path", rootCmd.Flags().Lookup("vault-secret-path")) //gosec:disable G104
+	viper.BindPFlag("vault.secret.path", rootCmd.PersistentFlags().Lookup("vault-secret-path")) //gosec:disable G104
 	// nolint:errcheck
 	viper.BindEnv("vault.secret.path", "VAULT_SECRET_PATH") //gosec:disable G104
+
+	rootCmd.PersistentFlags().String("vault-secret-format", "fields", "format of the secret. Possible values: fields, dockerconfigjson, jq")
+	// nolint:errcheck
+	viper.BindPFlag("vault.secret.format", rootCmd.PersistentFlags().Lookup("vault-secret-format")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.secret.format", "VAULT_SECRET_FORMAT") //gosec:disable G104
+
+	rootCmd.PersistentFlags().String("vault-secret-username-field", "username", "field of the secret containing the username, nested fields are separated by dots")
+	// nolint:errcheck
+	viper.BindPFlag("vault.secret.fields.username", rootCmd.PersistentFlags().Lookup("vault-secret-username-field")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.secret.fields.username", "VAULT_SECRET_USERNAME_FIELD") //gosec:disable G104
+
+	rootCmd.PersistentFlags().String("vault-secret-password-field", "password", "field of the secret containing the password, nested fields are separated by dots")
+	// nolint:errcheck
+	viper.BindPFlag("vault.secret.fields.password", rootCmd.PersistentFlags().Lookup("vault-secret-password-field")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.secret.fields.password", "VAULT_SECRET_PASSWORD_FIELD") //gosec:disable G104
+
+	rootCmd.PersistentFlags().String("vault-secret-auth-field", "", "field of the secret containing username:password or its base64 encoding (docker auth), takes precedence over the username and password fields")
+	// nolint:errcheck
+	viper.BindPFlag("vault.secret.fields.auth", rootCmd.PersistentFlags().Lookup("vault-secret-auth-field")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.secret.fields.auth", "VAULT_SECRET_AUTH_FIELD") //gosec:disable G104
+
+	rootCmd.PersistentFlags().String("vault-secret-docker-config-json-field", ".dockerconfigjson", "field of the secret containing the docker config (json string or structured data) for the dockerconfigjson format")
+	// nolint:errcheck
+	viper.BindPFlag("vault.secret.dockerConfigJson.field", rootCmd.PersistentFlags().Lookup("vault-secret-docker-config-json-field")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.secret.dockerConfigJson.field", "VAULT_SECRET_DOCKER_CONFIG_JSON_FIELD") //gosec:disable G104
+
+	rootCmd.PersistentFlags().Bool("vault-secret-docker-config-json-all-registries", false, "return the credentials of all registries of the docker config instead of only the matching one")
+	// nolint:errcheck
+	viper.BindPFlag("vault.secret.dockerConfigJson.allRegistries", rootCmd.PersistentFlags().Lookup("vault-secret-docker-config-json-all-registries")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.secret.dockerConfigJson.allRegistries", "VAULT_SECRET_DOCKER_CONFIG_JSON_ALL_REGISTRIES") //gosec:disable G104
+
+	rootCmd.PersistentFlags().String("vault-secret-jq-username", "", "jq expression returning the username for the jq format")
+	// nolint:errcheck
+	viper.BindPFlag("vault.secret.jq.username", rootCmd.PersistentFlags().Lookup("vault-secret-jq-username")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.secret.jq.username", "VAULT_SECRET_JQ_USERNAME") //gosec:disable G104
+
+	rootCmd.PersistentFlags().String("vault-secret-jq-password", "", "jq expression returning the password for the jq format")
+	// nolint:errcheck
+	viper.BindPFlag("vault.secret.jq.password", rootCmd.PersistentFlags().Lookup("vault-secret-jq-password")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.secret.jq.password", "VAULT_SECRET_JQ_PASSWORD") //gosec:disable G104
+
+	rootCmd.PersistentFlags().String("vault-secret-jq-auth", "", "jq expression returning username:password or its base64 encoding (docker auth) for the jq format, takes precedence over the username and password expressions")
+	// nolint:errcheck
+	viper.BindPFlag("vault.secret.jq.auth", rootCmd.PersistentFlags().Lookup("vault-secret-jq-auth")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.secret.jq.auth", "VAULT_SECRET_JQ_AUTH") //gosec:disable G104
+
+	rootCmd.PersistentFlags().Int("vault-secret-version", 0, "version of the kv v2 secret to use (0 uses the latest version)")
+	// nolint:errcheck
+	viper.BindPFlag("vault.secret.version", rootCmd.PersistentFlags().Lookup("vault-secret-version")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.secret.version", "VAULT_SECRET_VERSION") //gosec:disable G104
+
+	rootCmd.PersistentFlags().Bool("vault-secret-fallback-to-previous-version", false, "use the previous kv v2 secret version if the version is deleted or destroyed")
+	// nolint:errcheck
+	viper.BindPFlag("vault.secret.fallbackToPreviousVersion", rootCmd.PersistentFlags().Lookup("vault-secret-fallback-to-previous-version")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.secret.fallbackToPreviousVersion", "VAULT_SECRET_FALLBACK_TO_PREVIOUS_VERSION") //gosec:disable G104
+
+	rootCmd.PersistentFlags().StringSlice("vault-service-account-annotation-overrides", []string{}, "settings that may be overridden by service account annotations (vault.credential-provider/<setting>). Possible values: role, secret-mount, secret-path")
+	// nolint:errcheck
+	viper.BindPFlag("vault.serviceAccountAnnotationOverrides", rootCmd.PersistentFlags().Lookup("vault-service-account-annotation-overrides")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.serviceAccountAnnotationOverrides", "VAULT_SERVICE_ACCOUNT_ANNOTATION_OVERRIDES") //gosec:disable G104
+
+	rootCmd.PersistentFlags().Bool("vault-token-cache-enabled", false, "cache vault tokens on disk and reuse them in following invocations")
+	// nolint:errcheck
+	viper.BindPFlag("vault.tokenCache.enabled", rootCmd.PersistentFlags().Lookup("vault-token-cache-enabled")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.tokenCache.enabled", "VAULT_TOKEN_CACHE_ENABLED") //gosec:disable G104
+
+	rootCmd.PersistentFlags().String("vault-token-cache-directory", "/var/lib/kubelet-credential-provider-vault/token-cache", "directory of the token cache, only accessible by the owner")
+	// nolint:errcheck
+	viper.BindPFlag("vault.tokenCache.directory", rootCmd.PersistentFlags().Lookup("vault-token-cache-directory")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.tokenCache.directory", "VAULT_TOKEN_CACHE_DIRECTORY") //gosec:disable G104
+
+	rootCmd.PersistentFlags().String("vault-token-cache-key-file", "", "file containing the encryption key of the token cache, created on first use (required, must be outside of the token cache directory)")
+	// nolint:errcheck
+	viper.BindPFlag("vault.tokenCache.keyFile", rootCmd.PersistentFlags().Lookup("vault-token-cache-key-file")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.tokenCache.keyFile", "VAULT_TOKEN_CACHE_KEY_FILE") //gosec:disable G104
+
+	rootCmd.PersistentFlags().Duration("vault-token-cache-renew-before", time.Minute, "remaining ttl at which a cached token is renewed (or replaced by a new login if it is not renewable)")
+	// nolint:errcheck
+	viper.BindPFlag("vault.tokenCache.renewBefore", rootCmd.PersistentFlags().Lookup("vault-token-cache-renew-before")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.tokenCache.renewBefore", "VAULT_TOKEN_CACHE_RENEW_BEFORE") //gosec:disable G104
+
+	rootCmd.PersistentFlags().Bool("vault-revoke-token-enabled", false, "revoke the vault token after the response is written (not possible with the token cache)")
+	// nolint:errcheck
+	viper.BindPFlag("vault.revokeToken.enabled", rootCmd.PersistentFlags().Lookup("vault-revoke-token-enabled")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.revokeToken.enabled", "VAULT_REVOKE_TOKEN_ENABLED") //gosec:disable G104
+
+	rootCmd.PersistentFlags().Duration("vault-revoke-token-timeout", 2*time.Second, "timeout of the token revocation, which delays every image pull by up to this duration")
+	// nolint:errcheck
+	viper.BindPFlag("vault.revokeToken.timeout", rootCmd.PersistentFlags().Lookup("vault-revoke-token-timeout")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.revokeToken.timeout", "VAULT_REVOKE_TOKEN_TIMEOUT") //gosec:disable G104
+
+	rootCmd.PersistentFlags().String("vault-cache-duration-expires-at-key", "", "field of the secret data or key of the kv v2 custom metadata that contains the expiry of the credentials (RFC 3339)")
+	// nolint:errcheck
+	viper.BindPFlag("vault.cacheDuration.expiresAtKey", rootCmd.PersistentFlags().Lookup("vault-cache-duration-expires-at-key")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.cacheDuration.expiresAtKey", "VAULT_CACHE_DURATION_EXPIRES_AT_KEY") //gosec:disable G104
+
+	rootCmd.PersistentFlags().Duration("vault-cache-duration-margin", time.Minute, "margin subtracted from the validity of the credentials for the cache duration of the response")
+	// nolint:errcheck
+	viper.BindPFlag("vault.cacheDuration.margin", rootCmd.PersistentFlags().Lookup("vault-cache-duration-margin")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.cacheDuration.margin", "VAULT_CACHE_DURATION_MARGIN") //gosec:disable G104
+
+	rootCmd.PersistentFlags().Duration("vault-cache-duration-min", 0, "minimum cache duration of the response")
+	// nolint:errcheck
+	viper.BindPFlag("vault.cacheDuration.min", rootCmd.PersistentFlags().Lookup("vault-cache-duration-min")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.cacheDuration.min", "VAULT_CACHE_DURATION_MIN") //gosec:disable G104
+
+	rootCmd.PersistentFlags().Duration("vault-cache-duration-max", 0, "maximum cache duration of the response, also used if the validity of the credentials is unknown (0 means no maximum)")
+	// nolint:errcheck
+	viper.BindPFlag("vault.cacheDuration.max", rootCmd.PersistentFlags().Lookup("vault-cache-duration-max")) //gosec:disable G104
+	// nolint:errcheck
+	viper.BindEnv("vault.cacheDuration.max", "VAULT_CACHE_DURATION_MAX") //gosec:disable G104
 }
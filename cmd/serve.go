@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/credentialFetcher"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/daemon"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/tokenCache"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/vault"
+	"github.com/spf13/cobra"
+)
+
+// serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run a daemon that handles the requests forwarded by the credential provider",
+	Long:  "Run a daemon on the unix socket --daemon-socket that handles the requests forwarded by the credential provider. The daemon reuses vault clients, tokens and credentials between requests.",
+	Run:   executeServeCmd,
+}
+
+func executeServeCmd(cmd *cobra.Command, args []string) {
+	// create shutdown context handler, the daemon runs until it receives a shutdown signal
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT, os.Interrupt)
+	defer cancel()
+
+	// load config and setup logger
+	cfg, err := setup(ctx)
+	if err != nil {
+		handleShutdown(ctx, shutdownReasonError)
+		return
+	}
+	if cfg.Daemon.Socket == "" {
+		log.Log(ctx, slog.LevelError, "Daemon socket is required")
+		handleShutdown(ctx, shutdownReasonError)
+		return
+	}
+	if cfg.Vault.RevokeToken.Enabled {
+		// tokens are reused by following requests, so they must not be revoked
+		log.Log(ctx, slog.LevelError, "Vault revoke token can not be combined with the daemon")
+		handleShutdown(ctx, shutdownReasonError)
+		return
+	}
+	log.Log(ctx, slog.LevelInfo, "Starting kubelet-credential-provider-vault daemon", "version", version)
+
+	// setup caches, they are shared by all requests (the file token cache keeps tokens across restarts)
+	tokenCacheImpl := tokenCache.NewMemoryTokenCache()
+	if cfg.Vault.TokenCache.Enabled {
+		tokenCacheImpl = tokenCache.NewFileTokenCache(cfg.Vault.TokenCache.Directory, cfg.Vault.TokenCache.KeyFile)
+		log.Log(ctx, slog.LevelDebug, "Initialized token cache", "directory", cfg.Vault.TokenCache.Directory)
+	}
+	vaultClientCache := credentialFetcher.NewVaultClientCache()
+	credentialCache := credentialFetcher.NewCredentialCache()
+
+	// every request gets its own credential fetcher (vault), because fetchers are not safe for concurrent use
+	newCredentialFetcher := func() credentialFetcher.CredentialFetcher {
+		fetcher := credentialFetcher.NewVaultCredentialFetcher(vault.NewHashicorpClientBuilder, &cfg.Vault, cfg.Registries, cfg.CacheKeyType, tokenCacheImpl, vaultClientCache)
+		return credentialFetcher.NewCachingCredentialFetcher(fetcher, credentialCache)
+	}
+
+	// handle requests until shutdown
+	server := daemon.NewServer(cfg.Daemon.Socket, cfg.Daemon.Timeout, newCredentialFetcher, &cfg.Graceful)
+	if err := server.Serve(ctx, log); err != nil {
+		log.Log(ctx, slog.LevelError, "Failed to run daemon", "error", err)
+		handleShutdown(ctx, shutdownReasonError)
+		return
+	}
+	handleShutdown(ctx, shutdownReasonSignal)
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+}
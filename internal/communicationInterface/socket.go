@@ -0,0 +1,100 @@
+package communicationInterface
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	credentialproviderV1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
+)
+
+// maxSocketMessageSize limits the size of a message on the daemon socket
+const maxSocketMessageSize = 1 << 20
+
+// SocketReply is the message the daemon writes to the socket, it contains the encoded response or the error
+type SocketReply struct {
+	Response json.RawMessage `json:"response,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// SocketCommunicationInterface reads the request from and writes the reply to a connection of the daemon socket.
+// Messages are JSON terminated by a newline, the request is a CredentialProviderRequest of any supported api version
+// and the reply contains the response in the same version.
+type SocketCommunicationInterface struct {
+	conn         io.ReadWriter
+	lastResponse *credentialproviderV1.CredentialProviderResponse
+	// apiVersion is the api version of the request, the response is written in the same version
+	apiVersion schema.GroupVersion
+}
+
+// NewSocketCommunicationInterface returns the concrete type, because the daemon also writes errors to the connection
+func NewSocketCommunicationInterface(conn io.ReadWriter) *SocketCommunicationInterface {
+	return &SocketCommunicationInterface{
+		conn:         conn,
+		lastResponse: nil,
+		apiVersion:   credentialproviderV1.SchemeGroupVersion,
+	}
+}
+
+func (p *SocketCommunicationInterface) ReadRequest(_ context.Context) (*credentialproviderV1.CredentialProviderRequest, error) {
+	// the deadline of the connection is set by the daemon, so reading does not need the context
+	data, err := ReadSocketMessage(p.conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from socket: %w", err)
+	}
+
+	// decode the request (in any supported api version) and remember its api version for the response
+	request, apiVersion, err := decodeRequest(data)
+	if err != nil {
+		return nil, err
+	}
+	p.apiVersion = apiVersion
+
+	return request, nil
+}
+
+func (p *SocketCommunicationInterface) WriteResponse(_ context.Context, response *credentialproviderV1.CredentialProviderResponse) error {
+	// set last response
+	p.lastResponse = response
+
+	// convert the response to the api version of the request
+	data, err := encodeResponse(response, p.apiVersion)
+	if err != nil {
+		return err
+	}
+
+	return WriteSocketMessage(p.conn, &SocketReply{Response: data})
+}
+
+// WriteError replies with the error, so the client fails instead of handling the request again
+func (p *SocketCommunicationInterface) WriteError(_ context.Context, err error) error {
+	return WriteSocketMessage(p.conn, &SocketReply{Error: err.Error()})
+}
+
+func (p *SocketCommunicationInterface) LastResponse() *credentialproviderV1.CredentialProviderResponse {
+	return p.lastResponse
+}
+
+// ReadSocketMessage reads a message terminated by a newline (or the end of the connection)
+func ReadSocketMessage(r io.Reader) ([]byte, error) {
+	data, err := bufio.NewReader(io.LimitReader(r, maxSocketMessageSize)).ReadBytes('\n')
+	if err != nil && (err != io.EOF || len(data) == 0) {
+		return nil, err
+	}
+	return data, nil
+}
+
+// WriteSocketMessage writes the message as JSON terminated by a newline
+func WriteSocketMessage(w io.Writer, message any) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write to socket: %w", err)
+	}
+	return nil
+}
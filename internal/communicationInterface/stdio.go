@@ -2,25 +2,35 @@ package communicationInterface
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	credentialproviderV1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
 )
 
 type StdIOCommunicationInterface struct {
+	// request is the request read from stdin, stdin can only be read once
+	request      *credentialproviderV1.CredentialProviderRequest
 	lastResponse *credentialproviderV1.CredentialProviderResponse
+	// apiVersion is the api version of the request, the response is written in the same version
+	apiVersion schema.GroupVersion
 }
 
 func NewStdIOCommunicationInterface() CommunicationInterface {
 	return &StdIOCommunicationInterface{
 		lastResponse: nil,
+		apiVersion:   credentialproviderV1.SchemeGroupVersion,
 	}
 }
 
 func (p *StdIOCommunicationInterface) ReadRequest(ctx context.Context) (*credentialproviderV1.CredentialProviderRequest, error) {
+	// the request is read again if it could not be forwarded to the daemon
+	if p.request != nil {
+		return p.request, nil
+	}
+
 	// basic read from io.ReadAll(os.Stdin) is not possible because this wouldnt be context aware
 	// so canceling the context in the main function would not stop the read and the program would hang
 
@@ -60,20 +70,13 @@ func (p *StdIOCommunicationInterface) ReadRequest(ctx context.Context) (*credent
 		}
 	}
 
-	// unmarshal the request
-	request := &credentialproviderV1.CredentialProviderRequest{}
-	err := json.Unmarshal(in, request)
+	// decode the request (in any supported api version) and remember its api version for the response
+	request, apiVersion, err := decodeRequest(in)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal request: %w", err)
-	}
-
-	// validate the request
-	if request.APIVersion != credentialproviderV1.SchemeGroupVersion.String() {
-		return nil, fmt.Errorf("invalid request: expected apiVersion %s, got %s", credentialproviderV1.SchemeGroupVersion.String(), request.APIVersion)
-	}
-	if request.Kind != "CredentialProviderRequest" {
-		return nil, fmt.Errorf("invalid request: expected kind %s, got %s", "CredentialProviderRequest", request.Kind)
+		return nil, err
 	}
+	p.apiVersion = apiVersion
+	p.request = request
 
 	return request, nil
 }
@@ -82,10 +85,10 @@ func (p *StdIOCommunicationInterface) WriteResponse(ctx context.Context, respons
 	// set last response
 	p.lastResponse = response
 
-	// marshal the response
-	data, err := json.Marshal(response)
+	// convert the response to the api version of the request
+	data, err := encodeResponse(response, p.apiVersion)
 	if err != nil {
-		return fmt.Errorf("failed to marshal response: %w", err)
+		return err
 	}
 
 	// write to stdout
@@ -0,0 +1,98 @@
+package communicationInterface
+
+import (
+	"encoding/json"
+	"fmt"
+
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/kubelet/pkg/apis/credentialprovider"
+	"k8s.io/kubelet/pkg/apis/credentialprovider/install"
+	credentialproviderV1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
+	credentialproviderV1alpha1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1alpha1"
+	credentialproviderV1beta1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1beta1"
+)
+
+// SupportedAPIVersions are the CredentialProvider api versions the plugin reads requests and writes responses in
+var SupportedAPIVersions = []schema.GroupVersion{
+	credentialproviderV1.SchemeGroupVersion,
+	credentialproviderV1beta1.SchemeGroupVersion,
+	credentialproviderV1alpha1.SchemeGroupVersion,
+}
+
+// scheme converts between the api versions through the internal types of the kubelet
+var scheme = runtime.NewScheme()
+
+func init() {
+	install.Install(scheme)
+}
+
+// decodeRequest decodes a request of any supported api version and converts it to v1,
+// it also returns the api version of the request, which must be used for the response
+func decodeRequest(data []byte) (*credentialproviderV1.CredentialProviderRequest, schema.GroupVersion, error) {
+	typeMeta := &metaV1.TypeMeta{}
+	if err := json.Unmarshal(data, typeMeta); err != nil {
+		return nil, schema.GroupVersion{}, fmt.Errorf("failed to unmarshal request: %w", err)
+	}
+	groupVersion, err := supportedAPIVersion(typeMeta.APIVersion)
+	if err != nil {
+		return nil, schema.GroupVersion{}, fmt.Errorf("invalid request: %w", err)
+	}
+	if typeMeta.Kind != "CredentialProviderRequest" {
+		return nil, schema.GroupVersion{}, fmt.Errorf("invalid request: expected kind %s, got %s", "CredentialProviderRequest", typeMeta.Kind)
+	}
+
+	versioned, err := scheme.New(groupVersion.WithKind(typeMeta.Kind))
+	if err != nil {
+		return nil, schema.GroupVersion{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	if err := json.Unmarshal(data, versioned); err != nil {
+		return nil, schema.GroupVersion{}, fmt.Errorf("failed to unmarshal request: %w", err)
+	}
+
+	internal := &credentialprovider.CredentialProviderRequest{}
+	if err := scheme.Convert(versioned, internal, nil); err != nil {
+		return nil, schema.GroupVersion{}, fmt.Errorf("failed to convert request from %s: %w", groupVersion, err)
+	}
+	request := &credentialproviderV1.CredentialProviderRequest{}
+	if err := scheme.Convert(internal, request, nil); err != nil {
+		return nil, schema.GroupVersion{}, fmt.Errorf("failed to convert request to %s: %w", credentialproviderV1.SchemeGroupVersion, err)
+	}
+	request.SetGroupVersionKind(credentialproviderV1.SchemeGroupVersion.WithKind(typeMeta.Kind))
+
+	return request, groupVersion, nil
+}
+
+// encodeResponse converts the v1 response to the api version and encodes it
+func encodeResponse(response *credentialproviderV1.CredentialProviderResponse, groupVersion schema.GroupVersion) ([]byte, error) {
+	internal := &credentialprovider.CredentialProviderResponse{}
+	if err := scheme.Convert(response, internal, nil); err != nil {
+		return nil, fmt.Errorf("failed to convert response from %s: %w", credentialproviderV1.SchemeGroupVersion, err)
+	}
+
+	groupVersionKind := groupVersion.WithKind("CredentialProviderResponse")
+	versioned, err := scheme.New(groupVersionKind)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create response: %w", err)
+	}
+	if err := scheme.Convert(internal, versioned, nil); err != nil {
+		return nil, fmt.Errorf("failed to convert response to %s: %w", groupVersion, err)
+	}
+	versioned.GetObjectKind().SetGroupVersionKind(groupVersionKind)
+
+	data, err := json.Marshal(versioned)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return data, nil
+}
+
+func supportedAPIVersion(apiVersion string) (schema.GroupVersion, error) {
+	for _, groupVersion := range SupportedAPIVersions {
+		if groupVersion.String() == apiVersion {
+			return groupVersion, nil
+		}
+	}
+	return schema.GroupVersion{}, fmt.Errorf("unsupported apiVersion %s, supported versions are: %s, %s, %s", apiVersion, SupportedAPIVersions[0], SupportedAPIVersions[1], SupportedAPIVersions[2])
+}
@@ -0,0 +1,150 @@
+package communicationInterface
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	credentialproviderV1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
+	credentialproviderV1alpha1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1alpha1"
+	credentialproviderV1beta1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1beta1"
+)
+
+func TestDecodeRequest(t *testing.T) {
+	tests := []struct {
+		name           string
+		data           string
+		wantImage      string
+		wantToken      string
+		wantAPIVersion schema.GroupVersion
+		wantErrMsg     string
+	}{
+		{
+			name:           "v1",
+			data:           `{"apiVersion":"credentialprovider.kubelet.k8s.io/v1","kind":"CredentialProviderRequest","image":"registry.example.com/app","serviceAccountToken":"token"}`,
+			wantImage:      "registry.example.com/app",
+			wantToken:      "token",
+			wantAPIVersion: credentialproviderV1.SchemeGroupVersion,
+		},
+		{
+			name:           "v1beta1",
+			data:           `{"apiVersion":"credentialprovider.kubelet.k8s.io/v1beta1","kind":"CredentialProviderRequest","image":"registry.example.com/app"}`,
+			wantImage:      "registry.example.com/app",
+			wantAPIVersion: credentialproviderV1beta1.SchemeGroupVersion,
+		},
+		{
+			name:           "v1alpha1",
+			data:           `{"apiVersion":"credentialprovider.kubelet.k8s.io/v1alpha1","kind":"CredentialProviderRequest","image":"registry.example.com/app"}`,
+			wantImage:      "registry.example.com/app",
+			wantAPIVersion: credentialproviderV1alpha1.SchemeGroupVersion,
+		},
+		{
+			name:       "unsupported api version",
+			data:       `{"apiVersion":"credentialprovider.kubelet.k8s.io/v2","kind":"CredentialProviderRequest","image":"registry.example.com/app"}`,
+			wantErrMsg: "invalid request: unsupported apiVersion credentialprovider.kubelet.k8s.io/v2, supported versions are: credentialprovider.kubelet.k8s.io/v1, credentialprovider.kubelet.k8s.io/v1beta1, credentialprovider.kubelet.k8s.io/v1alpha1",
+		},
+		{
+			name:       "missing api version",
+			data:       `{"kind":"CredentialProviderRequest","image":"registry.example.com/app"}`,
+			wantErrMsg: "invalid request: unsupported apiVersion , supported versions are: credentialprovider.kubelet.k8s.io/v1, credentialprovider.kubelet.k8s.io/v1beta1, credentialprovider.kubelet.k8s.io/v1alpha1",
+		},
+		{
+			name:       "invalid kind",
+			data:       `{"apiVersion":"credentialprovider.kubelet.k8s.io/v1beta1","kind":"CredentialProviderResponse"}`,
+			wantErrMsg: "invalid request: expected kind CredentialProviderRequest, got CredentialProviderResponse",
+		},
+		{
+			name:       "invalid json",
+			data:       `{`,
+			wantErrMsg: "failed to unmarshal request: unexpected end of JSON input",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, apiVersion, err := decodeRequest([]byte(tt.data))
+			if tt.wantErrMsg != "" {
+				if err == nil || err.Error() != tt.wantErrMsg {
+					t.Fatalf("expected error %q, got %v", tt.wantErrMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if apiVersion != tt.wantAPIVersion {
+				t.Errorf("expected api version %s, got %s", tt.wantAPIVersion, apiVersion)
+			}
+			if request.APIVersion != credentialproviderV1.SchemeGroupVersion.String() || request.Kind != "CredentialProviderRequest" {
+				t.Errorf("expected v1 request, got %s %s", request.APIVersion, request.Kind)
+			}
+			if request.Image != tt.wantImage {
+				t.Errorf("expected image %s, got %s", tt.wantImage, request.Image)
+			}
+			if request.ServiceAccountToken != tt.wantToken {
+				t.Errorf("expected service account token %s, got %s", tt.wantToken, request.ServiceAccountToken)
+			}
+		})
+	}
+}
+
+func TestEncodeResponse(t *testing.T) {
+	response := &credentialproviderV1.CredentialProviderResponse{
+		TypeMeta: metaV1.TypeMeta{
+			APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+			Kind:       "CredentialProviderResponse",
+		},
+		CacheKeyType:  credentialproviderV1.ImagePluginCacheKeyType,
+		CacheDuration: &metaV1.Duration{Duration: time.Minute},
+		Auth: map[string]credentialproviderV1.AuthConfig{
+			"registry.example.com/app": {Username: "user", Password: "pass"},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		apiVersion schema.GroupVersion
+	}{
+		{
+			name:       "v1",
+			apiVersion: credentialproviderV1.SchemeGroupVersion,
+		},
+		{
+			name:       "v1beta1",
+			apiVersion: credentialproviderV1beta1.SchemeGroupVersion,
+		},
+		{
+			name:       "v1alpha1",
+			apiVersion: credentialproviderV1alpha1.SchemeGroupVersion,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := encodeResponse(response, tt.apiVersion)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// all supported versions share the same fields, so the response can be compared as v1
+			got := &credentialproviderV1.CredentialProviderResponse{}
+			if err := json.Unmarshal(data, got); err != nil {
+				t.Fatalf("failed to unmarshal response: %v", err)
+			}
+			if got.APIVersion != tt.apiVersion.String() || got.Kind != "CredentialProviderResponse" {
+				t.Errorf("expected %s CredentialProviderResponse, got %s %s", tt.apiVersion, got.APIVersion, got.Kind)
+			}
+			if got.CacheKeyType != response.CacheKeyType {
+				t.Errorf("expected cache key type %s, got %s", response.CacheKeyType, got.CacheKeyType)
+			}
+			if got.CacheDuration == nil || got.CacheDuration.Duration != time.Minute {
+				t.Errorf("expected cache duration %s, got %v", time.Minute, got.CacheDuration)
+			}
+			if auth := got.Auth["registry.example.com/app"]; auth.Username != "user" || auth.Password != "pass" || len(got.Auth) != 1 {
+				t.Errorf("expected auth %v, got %v", response.Auth, got.Auth)
+			}
+		})
+	}
+}
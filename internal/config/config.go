@@ -6,8 +6,17 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
 
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/itchyny/gojq"
 	"github.com/joho/godotenv"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/imageReference"
 	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/logger"
 	"github.com/spf13/viper"
 )
@@ -17,6 +26,48 @@ const DefaultConfigFile = "./kubelet-credential-provider-vault.yaml"
 type Configuration struct {
 	Log   LogConfiguration   `mapstructure:"log"`
 	Vault VaultConfiguration `mapstructure:"vault"`
+	// CacheKeyType is the cache key type of the response, registries can override it
+	CacheKeyType CacheKeyType `mapstructure:"cacheKeyType"`
+	// Registries route images to their own secret, the first matching entry is used
+	Registries []RegistryConfiguration `mapstructure:"registries"`
+	Graceful   GracefulConfiguration   `mapstructure:"graceful"`
+	Daemon     DaemonConfiguration     `mapstructure:"daemon"`
+}
+
+// CacheKeyType is the scope the kubelet caches the credentials for
+type CacheKeyType string
+
+const (
+	// CacheKeyTypeImage caches the credentials per image repository, e.g. for registries with credentials per repository
+	CacheKeyTypeImage    CacheKeyType = "Image"
+	CacheKeyTypeRegistry CacheKeyType = "Registry"
+	CacheKeyTypeGlobal   CacheKeyType = "Global"
+)
+
+func (t CacheKeyType) IsValid() bool {
+	switch t {
+	case CacheKeyTypeImage, CacheKeyTypeRegistry, CacheKeyTypeGlobal:
+		return true
+	default:
+		return false
+	}
+}
+
+// GracefulConfiguration writes a response without credentials instead of failing, if the request has no service account
+// token, no registry matches the image or the secret does not exist. The kubelet then falls back to other providers
+// and image pull secrets.
+type GracefulConfiguration struct {
+	Enabled bool `mapstructure:"enabled"`
+	// CacheDuration is the cache duration of the empty response, zero disables the caching by the kubelet
+	CacheDuration time.Duration `mapstructure:"cacheDuration"`
+}
+
+// DaemonConfiguration configures the daemon (serve command) and the forwarding of requests to it
+type DaemonConfiguration struct {
+	// Socket is the unix socket of the daemon, requests are only forwarded if it is set
+	Socket string `mapstructure:"socket"`
+	// Timeout bounds a request to the daemon, the request is handled in-process if the daemon does not reply in time
+	Timeout time.Duration `mapstructure:"timeout"`
 }
 
 type LogConfiguration struct {
@@ -26,36 +77,425 @@ type LogConfiguration struct {
 }
 
 type VaultConfiguration struct {
-	Address            string                   `mapstructure:"address"`
-	InsecureSkipVerify bool                     `mapstructure:"insecureSkipVerify"`
-	Auth               VaultAuthConfiguration   `mapstructure:"auth"`
-	Secret             VaultSecretConfiguration `mapstructure:"secret"`
+	Address            string `mapstructure:"address"`
+	InsecureSkipVerify bool   `mapstructure:"insecureSkipVerify"`
+	CACert             string `mapstructure:"caCert"`
+	TLSServerName      string `mapstructure:"tlsServerName"`
+	Namespace          string `mapstructure:"namespace"`
+	// NamespaceMapping maps the kubernetes namespace of the service account to a child namespace of Namespace
+	NamespaceMapping map[string]string        `mapstructure:"namespaceMapping"`
+	Auth             []VaultAuthConfiguration `mapstructure:"auth"`
+	Secret           VaultSecretConfiguration `mapstructure:"secret"`
+	// ServiceAccountAnnotationOverrides lists the settings that may be overridden by service account annotations
+	ServiceAccountAnnotationOverrides []ServiceAccountAnnotationOverride `mapstructure:"serviceAccountAnnotationOverrides"`
+	TokenCache                        VaultTokenCacheConfiguration       `mapstructure:"tokenCache"`
+	RevokeToken                       VaultRevokeTokenConfiguration      `mapstructure:"revokeToken"`
+	CacheDuration                     VaultCacheDurationConfiguration    `mapstructure:"cacheDuration"`
+}
+
+type ServiceAccountAnnotationOverride string
+
+const (
+	ServiceAccountAnnotationOverrideRole        ServiceAccountAnnotationOverride = "role"
+	ServiceAccountAnnotationOverrideSecretMount ServiceAccountAnnotationOverride = "secret-mount"
+	ServiceAccountAnnotationOverrideSecretPath  ServiceAccountAnnotationOverride = "secret-path"
+)
+
+func (o ServiceAccountAnnotationOverride) IsValid() bool {
+	switch o {
+	case ServiceAccountAnnotationOverrideRole, ServiceAccountAnnotationOverrideSecretMount, ServiceAccountAnnotationOverrideSecretPath:
+		return true
+	default:
+		return false
+	}
 }
 
 type VaultAuthMethod string
 
 const (
 	VaultAuthMethodKubernetes VaultAuthMethod = "kubernetes"
+	VaultAuthMethodJWT        VaultAuthMethod = "jwt"
+	VaultAuthMethodAppRole    VaultAuthMethod = "approle"
+	VaultAuthMethodCert       VaultAuthMethod = "cert"
+	VaultAuthMethodToken      VaultAuthMethod = "token"
+	VaultAuthMethodAgent      VaultAuthMethod = "agent"
+	VaultAuthMethodAWS        VaultAuthMethod = "aws"
 )
 
+var validVaultAuthMethods = []VaultAuthMethod{
+	VaultAuthMethodKubernetes,
+	VaultAuthMethodJWT,
+	VaultAuthMethodAppRole,
+	VaultAuthMethodCert,
+	VaultAuthMethodToken,
+	VaultAuthMethodAgent,
+	VaultAuthMethodAWS,
+}
+
 func (v VaultAuthMethod) IsValid() bool {
-	switch v {
-	case VaultAuthMethodKubernetes:
+	return slices.Contains(validVaultAuthMethods, v)
+}
+
+// requiresMount reports whether the auth method logs in against an auth mount
+func (v VaultAuthMethod) requiresMount() bool {
+	return v != VaultAuthMethodToken && v != VaultAuthMethodAgent
+}
+
+func joinVaultAuthMethods(methods []VaultAuthMethod) string {
+	names := make([]string, len(methods))
+	for i, m := range methods {
+		names[i] = string(m)
+	}
+	return strings.Join(names, ", ")
+}
+
+// vaultAuthConfigurationDecodeHook allows vault.auth to be configured as single auth method (e.g. via flags)
+// or as ordered list of auth methods that are tried one after another
+func vaultAuthConfigurationDecodeHook(from reflect.Type, to reflect.Type, data any) (any, error) {
+	if to != reflect.TypeFor[[]VaultAuthConfiguration]() || from.Kind() != reflect.Map {
+		return data, nil
+	}
+	return []any{data}, nil
+}
+
+// stringToStringMapDecodeHook allows maps to be configured as comma separated key=value pairs (e.g. via environment variables)
+func stringToStringMapDecodeHook(from reflect.Type, to reflect.Type, data any) (any, error) {
+	if from.Kind() != reflect.String || to != reflect.TypeFor[map[string]string]() {
+		return data, nil
+	}
+	result := map[string]string{}
+	for pair := range strings.SplitSeq(data.(string), ",") {
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid key=value pair: %s", pair)
+		}
+		result[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return result, nil
+}
+
+type VaultAuthConfiguration struct {
+	Method  VaultAuthMethod               `mapstructure:"method"`
+	Mount   string                        `mapstructure:"mount"`
+	Role    string                        `mapstructure:"role"`
+	AppRole VaultAppRoleAuthConfiguration `mapstructure:"appRole"`
+	Cert    VaultCertAuthConfiguration    `mapstructure:"cert"`
+	Token   VaultTokenAuthConfiguration   `mapstructure:"token"`
+	AWS     VaultAWSAuthConfiguration     `mapstructure:"aws"`
+}
+
+type VaultAppRoleAuthConfiguration struct {
+	RoleIDFile string `mapstructure:"roleIdFile"`
+	// SecretIDFile may contain a response-wrapping token instead of the secret id itself, see SecretIDWrapped
+	SecretIDFile string `mapstructure:"secretIdFile"`
+	// SecretIDWrapped requires the token cache, because the wrapping token can only be unwrapped once
+	SecretIDWrapped bool `mapstructure:"secretIdWrapped"`
+}
+
+type VaultCertAuthConfiguration struct {
+	CertFile string `mapstructure:"certFile"`
+	KeyFile  string `mapstructure:"keyFile"`
+}
+
+type VaultTokenAuthConfiguration struct {
+	// File is read on every invocation, VAULT_TOKEN is used if it is not set
+	File       string        `mapstructure:"file"`
+	Wrapped    bool          `mapstructure:"wrapped"`
+	LookupSelf bool          `mapstructure:"lookupSelf"`
+	MinTTL     time.Duration `mapstructure:"minTTL"`
+}
+
+type VaultAWSAuthConfiguration struct {
+	Region      string `mapstructure:"region"`
+	STSEndpoint string `mapstructure:"stsEndpoint"`
+	// HeaderValue is sent as X-Vault-AWS-IAM-Server-ID header and must match the iam_server_id_header_value of the auth mount
+	HeaderValue string `mapstructure:"headerValue"`
+}
+
+type VaultSecretEngine string
+
+const (
+	VaultSecretEngineKvV1 VaultSecretEngine = "kv-v1"
+	VaultSecretEngineKvV2 VaultSecretEngine = "kv-v2"
+	// VaultSecretEngineGeneric reads <mount>/<path> with a plain logical read, e.g. for dynamic secrets engines and plugins
+	VaultSecretEngineGeneric VaultSecretEngine = "generic"
+)
+
+func (e VaultSecretEngine) IsValid() bool {
+	switch e {
+	case VaultSecretEngineKvV1, VaultSecretEngineKvV2, VaultSecretEngineGeneric:
 		return true
 	default:
 		return false
 	}
 }
 
-type VaultAuthConfiguration struct {
-	Method VaultAuthMethod `mapstructure:"method"`
-	Mount  string          `mapstructure:"mount"`
-	Role   string          `mapstructure:"role"`
+type VaultSecretFormat string
+
+const (
+	// VaultSecretFormatFields reads username and password from the configured fields of the secret
+	VaultSecretFormatFields VaultSecretFormat = "fields"
+	// VaultSecretFormatDockerConfigJSON reads the credentials from a docker config.json / .dockerconfigjson document
+	VaultSecretFormatDockerConfigJSON VaultSecretFormat = "dockerconfigjson"
+	// VaultSecretFormatJQ reads username and password with jq expressions evaluated against the secret data
+	VaultSecretFormatJQ VaultSecretFormat = "jq"
+)
+
+func (f VaultSecretFormat) IsValid() bool {
+	switch f {
+	case VaultSecretFormatFields, VaultSecretFormatDockerConfigJSON, VaultSecretFormatJQ:
+		return true
+	default:
+		return false
+	}
 }
 
 type VaultSecretConfiguration struct {
-	Mount string `mapstructure:"mount"`
-	Path  string `mapstructure:"path"`
+	Engine VaultSecretEngine `mapstructure:"engine"`
+	// Mount and Path are go templates, rendered per request (see credentialFetcher.SecretTemplateData)
+	Mount  string            `mapstructure:"mount"`
+	Path   string            `mapstructure:"path"`
+	Format VaultSecretFormat `mapstructure:"format"`
+	// Version pins the kv v2 secret version, 0 reads the latest version
+	Version int `mapstructure:"version"`
+	// FallbackToPreviousVersion reads the previous available version if the version is deleted or destroyed
+	FallbackToPreviousVersion bool                                     `mapstructure:"fallbackToPreviousVersion"`
+	Fields                    VaultSecretFieldsConfiguration           `mapstructure:"fields"`
+	DockerConfigJSON          VaultSecretDockerConfigJSONConfiguration `mapstructure:"dockerConfigJson"`
+	JQ                        VaultSecretJQConfiguration               `mapstructure:"jq"`
+}
+
+// VaultSecretJQConfiguration contains the jq expressions that extract the credentials from the secret data, e.g. .data.token
+type VaultSecretJQConfiguration struct {
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	// Auth returns "username:password" or its base64 encoding (docker auth), it takes precedence over Username and Password
+	Auth string `mapstructure:"auth"`
+}
+
+type VaultSecretDockerConfigJSONConfiguration struct {
+	// Field contains the docker config as json string or structured data, the secret data itself is used if it contains auths
+	Field string `mapstructure:"field"`
+	// AllRegistries returns the credentials of all registries of the docker config instead of only the matching one
+	AllRegistries bool `mapstructure:"allRegistries"`
+}
+
+// VaultSecretFieldsConfiguration maps the credentials to the keys of the secret data, nested keys are separated by dots
+type VaultSecretFieldsConfiguration struct {
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	// Auth contains username and password as "username:password" or base64 encoded (docker auth), it takes precedence over Username and Password
+	Auth string `mapstructure:"auth"`
+}
+
+// RegistryConfiguration overrides the vault configuration for matching images, unset settings fall back to the vault configuration
+type RegistryConfiguration struct {
+	// MatchImages uses the same glob semantics as the matchImages of the kubelet CredentialProviderConfig, e.g. *.registry.io/team
+	MatchImages []string `mapstructure:"matchImages"`
+	// Role overrides the role of the kubernetes and jwt auth methods
+	Role   string                      `mapstructure:"role"`
+	Secret RegistrySecretConfiguration `mapstructure:"secret"`
+	// CacheKeyType overrides the cache key type of the response, Image must be used if repositories of a registry use different credentials
+	CacheKeyType CacheKeyType `mapstructure:"cacheKeyType"`
+	// Aliases are registry hosts that share the credentials, e.g. pull-through mirrors or geo-replicas, they are added to the response
+	Aliases []string `mapstructure:"aliases"`
+}
+
+type RegistrySecretConfiguration struct {
+	Engine VaultSecretEngine `mapstructure:"engine"`
+	Mount  string            `mapstructure:"mount"`
+	Path   string            `mapstructure:"path"`
+	Format VaultSecretFormat `mapstructure:"format"`
+	// Fields and JQ replace all fields or expressions of the vault secret configuration if any of them is set
+	Fields VaultSecretFieldsConfiguration `mapstructure:"fields"`
+	JQ     VaultSecretJQConfiguration     `mapstructure:"jq"`
+}
+
+// overridesSecret reports whether the registry overrides how the secret is read, not only where it is stored
+func (s *RegistrySecretConfiguration) overridesSecret() bool {
+	return s.Engine != "" || s.Format != "" || s.Fields != (VaultSecretFieldsConfiguration{}) || s.JQ != (VaultSecretJQConfiguration{})
+}
+
+// ApplySecret returns a copy of the secret configuration with the overrides of the registry applied
+func (r *RegistryConfiguration) ApplySecret(secret VaultSecretConfiguration) VaultSecretConfiguration {
+	if r.Secret.Engine != "" {
+		secret.Engine = r.Secret.Engine
+	}
+	if r.Secret.Format != "" {
+		secret.Format = r.Secret.Format
+	}
+	if r.Secret.Mount != "" {
+		secret.Mount = r.Secret.Mount
+	}
+	if r.Secret.Path != "" {
+		secret.Path = r.Secret.Path
+	}
+	if r.Secret.Fields != (VaultSecretFieldsConfiguration{}) {
+		secret.Fields = r.Secret.Fields
+	}
+	if r.Secret.JQ != (VaultSecretJQConfiguration{}) {
+		secret.JQ = r.Secret.JQ
+	}
+	return secret
+}
+
+func (r *RegistryConfiguration) validate(prefix string, defaultSecret VaultSecretConfiguration, defaultCacheKeyType CacheKeyType) []error {
+	var errs []error
+	if len(r.MatchImages) == 0 {
+		errs = append(errs, fmt.Errorf("%s match images are required", prefix))
+	}
+	for _, pattern := range r.MatchImages {
+		if err := imageReference.ValidatePattern(pattern); err != nil {
+			errs = append(errs, fmt.Errorf("%s match image %s is invalid: %w", prefix, pattern, err))
+		}
+	}
+	if r.CacheKeyType != "" && !r.CacheKeyType.IsValid() {
+		errs = append(errs, fmt.Errorf("%s cache key type is invalid. valid values are: %s, %s, %s", prefix, CacheKeyTypeImage, CacheKeyTypeRegistry, CacheKeyTypeGlobal))
+	}
+	for _, alias := range r.Aliases {
+		if strings.Contains(alias, "/") {
+			errs = append(errs, fmt.Errorf("%s alias %s must be a registry host without scheme and path", prefix, alias))
+		} else if err := imageReference.ValidatePattern(alias); err != nil {
+			errs = append(errs, fmt.Errorf("%s alias %s is invalid: %w", prefix, alias, err))
+		}
+	}
+	// templates of the default secret are validated on their own
+	secret := r.ApplySecret(defaultSecret)
+	if len(r.Aliases) > 0 && secret.Format == VaultSecretFormatDockerConfigJSON {
+		errs = append(errs, fmt.Errorf("%s aliases are not supported by the %s secret format", prefix, VaultSecretFormatDockerConfigJSON))
+	}
+	// the docker config contains registries, so its credentials can not be scoped to the repository of the image
+	cacheKeyType := defaultCacheKeyType
+	if r.CacheKeyType != "" {
+		cacheKeyType = r.CacheKeyType
+	}
+	if cacheKeyType == CacheKeyTypeImage && secret.Format == VaultSecretFormatDockerConfigJSON {
+		errs = append(errs, fmt.Errorf("%s cache key type %s is not supported by the %s secret format", prefix, CacheKeyTypeImage, VaultSecretFormatDockerConfigJSON))
+	}
+	if secret.Mount == "" {
+		errs = append(errs, fmt.Errorf("%s secret mount is required", prefix))
+	} else if _, err := template.New("mount").Parse(r.Secret.Mount); err != nil {
+		errs = append(errs, fmt.Errorf("%s secret mount is not a valid template: %w", prefix, err))
+	}
+	if secret.Path == "" {
+		errs = append(errs, fmt.Errorf("%s secret path is required", prefix))
+	} else if _, err := template.New("path").Parse(r.Secret.Path); err != nil {
+		errs = append(errs, fmt.Errorf("%s secret path is not a valid template: %w", prefix, err))
+	}
+	if r.Secret.overridesSecret() {
+		errs = append(errs, secret.validate(prefix+" secret")...)
+	}
+	return errs
+}
+
+type VaultTokenCacheConfiguration struct {
+	Enabled   bool   `mapstructure:"enabled"`
+	Directory string `mapstructure:"directory"`
+	// KeyFile contains the encryption key of the cache and is created on first use, it must be outside of Directory
+	// (otherwise everyone who can read the encrypted entries could also read the key)
+	KeyFile string `mapstructure:"keyFile"`
+	// RenewBefore is the remaining ttl at which a cached token is renewed (or replaced by a new login if it is not renewable)
+	RenewBefore time.Duration `mapstructure:"renewBefore"`
+}
+
+type VaultRevokeTokenConfiguration struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Timeout bounds the revocation, which happens after the response is written
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// VaultCacheDurationConfiguration controls the cache duration of the response, which is derived from the lease of the secret,
+// its expiry and the ttl of the vault token. The kubelet default is used if none of them is known.
+type VaultCacheDurationConfiguration struct {
+	// ExpiresAtKey is the field of the secret data or the key of the kv v2 custom metadata that contains the expiry (RFC 3339)
+	ExpiresAtKey string `mapstructure:"expiresAtKey"`
+	// Margin is subtracted from the remaining validity, so cached credentials are replaced before they expire
+	Margin time.Duration `mapstructure:"margin"`
+	Min    time.Duration `mapstructure:"min"`
+	// Max is also used if the validity is unknown, zero means no ceiling
+	Max time.Duration `mapstructure:"max"`
+}
+
+func (a *VaultAuthConfiguration) validate(prefix string) []error {
+	var errs []error
+	if a.Method == "" {
+		errs = append(errs, fmt.Errorf("%s method is required", prefix))
+	} else if !a.Method.IsValid() {
+		errs = append(errs, fmt.Errorf("%s method is invalid. valid values are: %s", prefix, joinVaultAuthMethods(validVaultAuthMethods)))
+	}
+	if a.Method.requiresMount() && a.Mount == "" {
+		errs = append(errs, fmt.Errorf("%s mount is required", prefix))
+	}
+	switch a.Method {
+	case VaultAuthMethodKubernetes, VaultAuthMethodJWT:
+		if a.Role == "" {
+			errs = append(errs, fmt.Errorf("%s role is required", prefix))
+		}
+	case VaultAuthMethodAppRole:
+		if a.AppRole.RoleIDFile == "" {
+			errs = append(errs, fmt.Errorf("%s approle role id file is required", prefix))
+		}
+		if a.AppRole.SecretIDFile == "" {
+			errs = append(errs, fmt.Errorf("%s approle secret id file is required", prefix))
+		}
+	case VaultAuthMethodCert:
+		if a.Cert.CertFile == "" {
+			errs = append(errs, fmt.Errorf("%s cert file is required", prefix))
+		}
+		if a.Cert.KeyFile == "" {
+			errs = append(errs, fmt.Errorf("%s cert key file is required", prefix))
+		}
+	}
+	return errs
+}
+
+func (s *VaultSecretConfiguration) validate(prefix string) []error {
+	var errs []error
+	if !s.Engine.IsValid() {
+		errs = append(errs, fmt.Errorf("%s engine is invalid. valid values are: %s, %s, %s", prefix, VaultSecretEngineKvV1, VaultSecretEngineKvV2, VaultSecretEngineGeneric))
+	}
+	if !s.Format.IsValid() {
+		errs = append(errs, fmt.Errorf("%s format is invalid. valid values are: %s, %s, %s", prefix, VaultSecretFormatFields, VaultSecretFormatDockerConfigJSON, VaultSecretFormatJQ))
+	}
+	if s.Format == VaultSecretFormatFields && s.Fields.Auth == "" {
+		if s.Fields.Username == "" {
+			errs = append(errs, fmt.Errorf("%s username field is required", prefix))
+		}
+		if s.Fields.Password == "" {
+			errs = append(errs, fmt.Errorf("%s password field is required", prefix))
+		}
+	}
+	if s.Format == VaultSecretFormatJQ {
+		if s.JQ.Auth == "" && (s.JQ.Username == "" || s.JQ.Password == "") {
+			errs = append(errs, fmt.Errorf("%s jq username and password or auth expressions are required", prefix))
+		}
+		for _, expression := range []struct{ name, value string }{{"username", s.JQ.Username}, {"password", s.JQ.Password}, {"auth", s.JQ.Auth}} {
+			if expression.value == "" {
+				continue
+			}
+			if _, err := gojq.Parse(expression.value); err != nil {
+				errs = append(errs, fmt.Errorf("%s jq %s expression is invalid: %w", prefix, expression.name, err))
+			}
+		}
+	}
+	if s.Version < 0 {
+		errs = append(errs, fmt.Errorf("%s version must not be negative", prefix))
+	}
+	if s.Engine != VaultSecretEngineKvV2 && (s.Version != 0 || s.FallbackToPreviousVersion) {
+		errs = append(errs, fmt.Errorf("%s version is only supported by the %s secret engine", prefix, VaultSecretEngineKvV2))
+	}
+	return errs
+}
+
+// vaultAuthPrefix returns the prefix of errors of the auth method, only the entries of an auth chain are indexed
+func (c *Configuration) vaultAuthPrefix(i int) string {
+	if len(c.Vault.Auth) == 1 {
+		return "vault auth"
+	}
+	return fmt.Sprintf("vault auth[%d]", i)
 }
 
 func (c *Configuration) validate() error {
@@ -68,25 +508,100 @@ func (c *Configuration) validate() error {
 	} else if _, err := logger.ParseLogLevel(c.Log.Level); err != nil {
 		errs = append(errs, fmt.Errorf("log level is invalid. valid values are: debug, info, warn, error"))
 	}
+	if !c.CacheKeyType.IsValid() {
+		errs = append(errs, fmt.Errorf("cache key type is invalid. valid values are: %s, %s, %s", CacheKeyTypeImage, CacheKeyTypeRegistry, CacheKeyTypeGlobal))
+	}
 	if c.Vault.Address == "" {
 		errs = append(errs, fmt.Errorf("vault address is required"))
+	} else if c.Vault.Address == "unix://" {
+		errs = append(errs, fmt.Errorf("vault address is invalid. unix socket path is required"))
 	}
-	if c.Vault.Auth.Method == "" {
+	if len(c.Vault.Auth) == 0 {
 		errs = append(errs, fmt.Errorf("vault auth method is required"))
-	} else if !c.Vault.Auth.Method.IsValid() {
-		errs = append(errs, fmt.Errorf("vault auth method is invalid. valid values are: %s", VaultAuthMethodKubernetes))
-	}
-	if c.Vault.Auth.Mount == "" {
-		errs = append(errs, fmt.Errorf("vault auth mount is required"))
 	}
-	if c.Vault.Auth.Role == "" {
-		errs = append(errs, fmt.Errorf("vault auth role is required"))
+	// auth methods are tried in order, so every entry of the chain must be valid on its own
+	for i, auth := range c.Vault.Auth {
+		errs = append(errs, auth.validate(c.vaultAuthPrefix(i))...)
 	}
+	errs = append(errs, c.Vault.Secret.validate("vault secret")...)
+	// with registries, the default secret is optional as long as every registry sets its own
 	if c.Vault.Secret.Mount == "" {
-		errs = append(errs, fmt.Errorf("vault secret mount is required"))
+		if len(c.Registries) == 0 {
+			errs = append(errs, fmt.Errorf("vault secret mount is required"))
+		}
+	} else if _, err := template.New("mount").Parse(c.Vault.Secret.Mount); err != nil {
+		errs = append(errs, fmt.Errorf("vault secret mount is not a valid template: %w", err))
+	}
+	for _, override := range c.Vault.ServiceAccountAnnotationOverrides {
+		if !override.IsValid() {
+			errs = append(errs, fmt.Errorf("vault service account annotation override %s is invalid. valid values are: %s, %s, %s", override, ServiceAccountAnnotationOverrideRole, ServiceAccountAnnotationOverrideSecretMount, ServiceAccountAnnotationOverrideSecretPath))
+		}
 	}
 	if c.Vault.Secret.Path == "" {
-		errs = append(errs, fmt.Errorf("vault secret path is required"))
+		if len(c.Registries) == 0 {
+			errs = append(errs, fmt.Errorf("vault secret path is required"))
+		}
+	} else if _, err := template.New("path").Parse(c.Vault.Secret.Path); err != nil {
+		errs = append(errs, fmt.Errorf("vault secret path is not a valid template: %w", err))
+	}
+	// the default secret is only read for images without a matching registry if it has a mount and path
+	defaultSecretUsed := len(c.Registries) == 0 || (c.Vault.Secret.Mount != "" && c.Vault.Secret.Path != "")
+	if defaultSecretUsed && c.CacheKeyType == CacheKeyTypeImage && c.Vault.Secret.Format == VaultSecretFormatDockerConfigJSON {
+		errs = append(errs, fmt.Errorf("cache key type %s is not supported by the %s secret format", CacheKeyTypeImage, VaultSecretFormatDockerConfigJSON))
+	}
+	for i, registry := range c.Registries {
+		errs = append(errs, registry.validate(fmt.Sprintf("registries[%d]", i), c.Vault.Secret, c.CacheKeyType)...)
+	}
+	if c.Vault.TokenCache.Enabled {
+		if c.Vault.TokenCache.Directory == "" {
+			errs = append(errs, fmt.Errorf("vault token cache directory is required"))
+		}
+		if c.Vault.TokenCache.KeyFile == "" {
+			errs = append(errs, fmt.Errorf("vault token cache key file is required"))
+		} else if c.Vault.TokenCache.Directory != "" && isWithinDirectory(c.Vault.TokenCache.KeyFile, c.Vault.TokenCache.Directory) {
+			errs = append(errs, fmt.Errorf("vault token cache key file must not be inside the token cache directory"))
+		}
+	}
+	if !c.Vault.TokenCache.Enabled {
+		// a wrapping token can only be unwrapped once, so its secret is kept in the token cache for following invocations
+		for i, auth := range c.Vault.Auth {
+			if auth.Method == VaultAuthMethodToken && auth.Token.Wrapped {
+				errs = append(errs, fmt.Errorf("%s token wrapped requires the vault token cache", c.vaultAuthPrefix(i)))
+			}
+			if auth.Method == VaultAuthMethodAppRole && auth.AppRole.SecretIDWrapped {
+				errs = append(errs, fmt.Errorf("%s approle secret id wrapped requires the vault token cache", c.vaultAuthPrefix(i)))
+			}
+		}
+	}
+	if c.Vault.RevokeToken.Enabled {
+		// cached tokens are reused by following invocations, so they must not be revoked
+		if c.Vault.TokenCache.Enabled {
+			errs = append(errs, fmt.Errorf("vault revoke token can not be combined with the vault token cache"))
+		}
+		// leases of dynamic secrets are revoked together with the token, so the credentials would die right after the response
+		if c.Vault.Secret.Engine == VaultSecretEngineGeneric {
+			errs = append(errs, fmt.Errorf("vault revoke token can not be combined with the %s vault secret engine", VaultSecretEngineGeneric))
+		}
+		for i, registry := range c.Registries {
+			if registry.Secret.Engine == VaultSecretEngineGeneric {
+				errs = append(errs, fmt.Errorf("vault revoke token can not be combined with the %s secret engine of registries[%d]", VaultSecretEngineGeneric, i))
+			}
+		}
+		if c.Vault.RevokeToken.Timeout <= 0 {
+			errs = append(errs, fmt.Errorf("vault revoke token timeout must be greater than zero"))
+		}
+	}
+	if c.Vault.CacheDuration.Margin < 0 || c.Vault.CacheDuration.Min < 0 || c.Vault.CacheDuration.Max < 0 {
+		errs = append(errs, fmt.Errorf("vault cache duration margin, min and max must not be negative"))
+	}
+	if c.Vault.CacheDuration.Max > 0 && c.Vault.CacheDuration.Min > c.Vault.CacheDuration.Max {
+		errs = append(errs, fmt.Errorf("vault cache duration min must not be greater than max"))
+	}
+	if c.Graceful.Enabled && c.Graceful.CacheDuration < 0 {
+		errs = append(errs, fmt.Errorf("graceful cache duration must not be negative"))
+	}
+	if c.Daemon.Socket != "" && c.Daemon.Timeout <= 0 {
+		errs = append(errs, fmt.Errorf("daemon timeout must be greater than zero"))
 	}
 	if len(errs) > 0 {
 		err := ""
@@ -101,6 +616,18 @@ func (c *Configuration) validate() error {
 	return nil
 }
 
+func overrideVaultAuthChain(configFile string) error {
+	fileViper := viper.New()
+	fileViper.SetConfigFile(configFile)
+	if err := fileViper.ReadInConfig(); err != nil {
+		return err
+	}
+	if authChain, ok := fileViper.Get("vault.auth").([]any); ok {
+		viper.Set("vault.auth", authChain)
+	}
+	return nil
+}
+
 func New(ctx context.Context, log logger.Logger, configFile string) (*Configuration, error) {
 	// load .env file if present
 	err := godotenv.Load()
@@ -132,11 +659,22 @@ func New(ctx context.Context, log logger.Logger, configFile string) (*Configurat
 		}
 	} else {
 		log.Log(ctx, slog.LevelInfo, "Loaded config file", "file", viper.ConfigFileUsed())
+
+		// an auth method chain in the config file replaces the single auth method flags and environment variables,
+		// otherwise viper would merge the list with the nested keys in arbitrary order
+		if err := overrideVaultAuthChain(viper.ConfigFileUsed()); err != nil {
+			return nil, fmt.Errorf("error reading vault auth chain from config file: %w", err)
+		}
 	}
 
 	// load config
 	var cfg Configuration
-	if err := viper.Unmarshal(&cfg); err != nil {
+	if err := viper.Unmarshal(&cfg, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToWeakSliceHookFunc(","),
+		vaultAuthConfigurationDecodeHook,
+		stringToStringMapDecodeHook,
+	))); err != nil {
 		return nil, fmt.Errorf("could not unmarshal config: %w", err)
 	}
 
@@ -147,3 +685,12 @@ func New(ctx context.Context, log logger.Logger, configFile string) (*Configurat
 
 	return &cfg, nil
 }
+
+// isWithinDirectory reports whether the file is the directory itself or inside of it
+func isWithinDirectory(file string, directory string) bool {
+	rel, err := filepath.Rel(filepath.Clean(directory), filepath.Clean(file))
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -1,6 +1,13 @@
 package config
 
-import "testing"
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-viper/mapstructure/v2"
+)
 
 func TestVaultAuthMethodIsValid(t *testing.T) {
 	tests := []struct {
@@ -13,6 +20,36 @@ func TestVaultAuthMethodIsValid(t *testing.T) {
 			method: "kubernetes",
 			want:   true,
 		},
+		{
+			name:   "jwt",
+			method: "jwt",
+			want:   true,
+		},
+		{
+			name:   "approle",
+			method: "approle",
+			want:   true,
+		},
+		{
+			name:   "cert",
+			method: "cert",
+			want:   true,
+		},
+		{
+			name:   "token",
+			method: "token",
+			want:   true,
+		},
+		{
+			name:   "agent",
+			method: "agent",
+			want:   true,
+		},
+		{
+			name:   "aws",
+			method: "aws",
+			want:   true,
+		},
 		{
 			name:   "invalid",
 			method: "invalid",
@@ -36,21 +73,39 @@ func TestValidate(t *testing.T) {
 			File:    "test.log",
 			Level:   "info",
 		},
+		CacheKeyType: CacheKeyTypeRegistry,
 		Vault: VaultConfiguration{
 			Address:            "http://localhost:8200",
 			InsecureSkipVerify: false,
-			Auth: VaultAuthConfiguration{
-				Method: VaultAuthMethodKubernetes,
-				Mount:  "kubernetes",
-				Role:   "example",
+			Auth: []VaultAuthConfiguration{
+				{
+					Method: VaultAuthMethodKubernetes,
+					Mount:  "kubernetes",
+					Role:   "example",
+				},
 			},
 			Secret: VaultSecretConfiguration{
-				Mount: "secret",
-				Path:  "example",
+				Engine: VaultSecretEngineKvV2,
+				Mount:  "secret",
+				Path:   "example",
+				Format: VaultSecretFormatFields,
+				Fields: VaultSecretFieldsConfiguration{
+					Username: "username",
+					Password: "password",
+				},
 			},
 		},
 	}
 
+	// auth configuration is copied, so test cases do not modify the default config
+	withAuth := func(modify func(auth *VaultAuthConfiguration)) Configuration {
+		cfg := defaultConfig
+		auth := defaultConfig.Vault.Auth[0]
+		modify(&auth)
+		cfg.Vault.Auth = []VaultAuthConfiguration{auth}
+		return cfg
+	}
+
 	tests := []struct {
 		name       string
 		config     Configuration
@@ -88,6 +143,15 @@ func TestValidate(t *testing.T) {
 			}(),
 			wantErrMsg: "log level is invalid. valid values are: debug, info, warn, error",
 		},
+		{
+			name: "invalid cache key type",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.CacheKeyType = "Repository"
+				return cfg
+			}(),
+			wantErrMsg: "cache key type is invalid. valid values are: Image, Registry, Global",
+		},
 		{
 			name: "missing vault address",
 			config: func() Configuration {
@@ -98,40 +162,219 @@ func TestValidate(t *testing.T) {
 			wantErrMsg: "vault address is required",
 		},
 		{
-			name: "missing vault auth method",
+			name: "unix socket vault address",
 			config: func() Configuration {
 				cfg := defaultConfig
-				cfg.Vault.Auth.Method = ""
+				cfg.Vault.Address = "unix:///var/run/vault-agent.sock"
 				return cfg
 			}(),
+			wantErrMsg: "",
+		},
+		{
+			name: "unix socket vault address without path",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Vault.Address = "unix://"
+				return cfg
+			}(),
+			wantErrMsg: "vault address is invalid. unix socket path is required",
+		},
+		{
+			name: "missing vault auth method",
+			config: withAuth(func(auth *VaultAuthConfiguration) {
+				auth.Method = ""
+			}),
 			wantErrMsg: "vault auth method is required",
 		},
 		{
 			name: "invalid vault auth method",
+			config: withAuth(func(auth *VaultAuthConfiguration) {
+				auth.Method = "invalid"
+			}),
+			wantErrMsg: "vault auth method is invalid. valid values are: kubernetes, jwt, approle, cert, token, agent, aws",
+		},
+		{
+			name: "missing vault auth mount",
+			config: withAuth(func(auth *VaultAuthConfiguration) {
+				auth.Mount = ""
+			}),
+			wantErrMsg: "vault auth mount is required",
+		},
+		{
+			name: "missing vault auth role",
+			config: withAuth(func(auth *VaultAuthConfiguration) {
+				auth.Role = ""
+			}),
+			wantErrMsg: "vault auth role is required",
+		},
+		{
+			name: "approle without vault auth role",
+			config: withAuth(func(auth *VaultAuthConfiguration) {
+				auth.Method = VaultAuthMethodAppRole
+				auth.Role = ""
+				auth.AppRole = VaultAppRoleAuthConfiguration{
+					RoleIDFile:   "/etc/vault/role-id",
+					SecretIDFile: "/etc/vault/secret-id",
+				}
+			}),
+			wantErrMsg: "",
+		},
+		{
+			name: "missing vault auth approle files",
+			config: withAuth(func(auth *VaultAuthConfiguration) {
+				auth.Method = VaultAuthMethodAppRole
+			}),
+			wantErrMsg: "vault auth approle role id file is required; vault auth approle secret id file is required",
+		},
+		{
+			name: "missing vault auth cert files",
+			config: withAuth(func(auth *VaultAuthConfiguration) {
+				auth.Method = VaultAuthMethodCert
+			}),
+			wantErrMsg: "vault auth cert file is required; vault auth cert key file is required",
+		},
+		{
+			name: "token without vault auth mount",
+			config: withAuth(func(auth *VaultAuthConfiguration) {
+				auth.Method = VaultAuthMethodToken
+				auth.Mount = ""
+			}),
+			wantErrMsg: "",
+		},
+		{
+			name: "agent without vault auth mount",
+			config: withAuth(func(auth *VaultAuthConfiguration) {
+				auth.Method = VaultAuthMethodAgent
+				auth.Mount = ""
+			}),
+			wantErrMsg: "",
+		},
+		{
+			name: "vault auth chain",
 			config: func() Configuration {
 				cfg := defaultConfig
-				cfg.Vault.Auth.Method = "invalid"
+				cfg.Vault.Auth = []VaultAuthConfiguration{
+					defaultConfig.Vault.Auth[0],
+					{
+						Method: VaultAuthMethodToken,
+						Token: VaultTokenAuthConfiguration{
+							File: "/var/run/vault-agent/token",
+						},
+					},
+				}
 				return cfg
 			}(),
-			wantErrMsg: "vault auth method is invalid. valid values are: kubernetes",
+			wantErrMsg: "",
 		},
 		{
-			name: "missing vault auth mount",
+			name: "invalid vault auth chain entry",
 			config: func() Configuration {
 				cfg := defaultConfig
-				cfg.Vault.Auth.Mount = ""
+				cfg.Vault.Auth = []VaultAuthConfiguration{
+					defaultConfig.Vault.Auth[0],
+					{
+						Method: VaultAuthMethodAppRole,
+						Mount:  "approle",
+					},
+				}
 				return cfg
 			}(),
-			wantErrMsg: "vault auth mount is required",
+			wantErrMsg: "vault auth[1] approle role id file is required; vault auth[1] approle secret id file is required",
 		},
 		{
-			name: "missing vault auth role",
+			name: "empty vault auth chain",
 			config: func() Configuration {
 				cfg := defaultConfig
-				cfg.Vault.Auth.Role = ""
+				cfg.Vault.Auth = nil
 				return cfg
 			}(),
-			wantErrMsg: "vault auth role is required",
+			wantErrMsg: "vault auth method is required",
+		},
+		{
+			name: "kv v1 vault secret engine",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Vault.Secret.Engine = VaultSecretEngineKvV1
+				return cfg
+			}(),
+			wantErrMsg: "",
+		},
+		{
+			name: "invalid vault secret engine",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Vault.Secret.Engine = "database"
+				return cfg
+			}(),
+			wantErrMsg: "vault secret engine is invalid. valid values are: kv-v1, kv-v2, generic",
+		},
+		{
+			name: "vault secret auth field",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Vault.Secret.Fields = VaultSecretFieldsConfiguration{
+					Auth: "auth",
+				}
+				return cfg
+			}(),
+			wantErrMsg: "",
+		},
+		{
+			name: "missing vault secret fields",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Vault.Secret.Fields = VaultSecretFieldsConfiguration{}
+				return cfg
+			}(),
+			wantErrMsg: "vault secret username field is required; vault secret password field is required",
+		},
+		{
+			name: "dockerconfigjson vault secret format without fields",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Vault.Secret.Format = VaultSecretFormatDockerConfigJSON
+				cfg.Vault.Secret.Fields = VaultSecretFieldsConfiguration{}
+				return cfg
+			}(),
+			wantErrMsg: "",
+		},
+		{
+			name: "invalid vault secret format",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Vault.Secret.Format = "yaml"
+				return cfg
+			}(),
+			wantErrMsg: "vault secret format is invalid. valid values are: fields, dockerconfigjson, jq",
+		},
+		{
+			name: "pinned vault secret version",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Vault.Secret.Version = 3
+				cfg.Vault.Secret.FallbackToPreviousVersion = true
+				return cfg
+			}(),
+			wantErrMsg: "",
+		},
+		{
+			name: "negative vault secret version",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Vault.Secret.Version = -1
+				return cfg
+			}(),
+			wantErrMsg: "vault secret version must not be negative",
+		},
+		{
+			name: "vault secret version with kv v1 secret engine",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Vault.Secret.Engine = VaultSecretEngineKvV1
+				cfg.Vault.Secret.Version = 3
+				return cfg
+			}(),
+			wantErrMsg: "vault secret version is only supported by the kv-v2 secret engine",
 		},
 		{
 			name: "missing vault secret mount",
@@ -142,6 +385,27 @@ func TestValidate(t *testing.T) {
 			}(),
 			wantErrMsg: "vault secret mount is required",
 		},
+		{
+			name: "valid vault service account annotation overrides",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Vault.ServiceAccountAnnotationOverrides = []ServiceAccountAnnotationOverride{
+					ServiceAccountAnnotationOverrideRole,
+					ServiceAccountAnnotationOverrideSecretPath,
+				}
+				return cfg
+			}(),
+			wantErrMsg: "",
+		},
+		{
+			name: "invalid vault service account annotation override",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Vault.ServiceAccountAnnotationOverrides = []ServiceAccountAnnotationOverride{"address"}
+				return cfg
+			}(),
+			wantErrMsg: "vault service account annotation override address is invalid. valid values are: role, secret-mount, secret-path",
+		},
 		{
 			name: "missing vault secret path",
 			config: func() Configuration {
@@ -151,6 +415,317 @@ func TestValidate(t *testing.T) {
 			}(),
 			wantErrMsg: "vault secret path is required",
 		},
+		{
+			name: "invalid vault secret path template",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Vault.Secret.Path = "registries/{{ .Registry"
+				return cfg
+			}(),
+			wantErrMsg: "vault secret path is not a valid template: template: path:1: unclosed action",
+		},
+		{
+			name: "vault secret jq format",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Vault.Secret.Engine = VaultSecretEngineGeneric
+				cfg.Vault.Secret.Format = VaultSecretFormatJQ
+				cfg.Vault.Secret.JQ = VaultSecretJQConfiguration{Username: ".username // \"token\"", Password: ".data.token"}
+				return cfg
+			}(),
+			wantErrMsg: "",
+		},
+		{
+			name: "invalid vault secret jq format",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Vault.Secret.Format = VaultSecretFormatJQ
+				cfg.Vault.Secret.JQ = VaultSecretJQConfiguration{Username: ".data[", Password: ""}
+				return cfg
+			}(),
+			wantErrMsg: "vault secret jq username and password or auth expressions are required; vault secret jq username expression is invalid: unexpected EOF",
+		},
+		{
+			name: "invalid registry aliases",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Vault.Secret.Format = VaultSecretFormatDockerConfigJSON
+				cfg.Registries = []RegistryConfiguration{
+					{
+						MatchImages: []string{"registry.example.com"},
+						Aliases:     []string{"mirror.example.com", "https://mirror.example.com", "[.example.com"},
+					},
+				}
+				return cfg
+			}(),
+			wantErrMsg: "registries[0] alias https://mirror.example.com must be a registry host without scheme and path; registries[0] alias [.example.com is invalid: parse \"https://[.example.com\": missing ']' in host; registries[0] aliases are not supported by the dockerconfigjson secret format",
+		},
+		{
+			name: "image cache key type with dockerconfigjson format",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.CacheKeyType = CacheKeyTypeImage
+				cfg.Vault.Secret.Format = VaultSecretFormatDockerConfigJSON
+				return cfg
+			}(),
+			wantErrMsg: "cache key type Image is not supported by the dockerconfigjson secret format",
+		},
+		{
+			name: "image cache key type of registry with dockerconfigjson format",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Registries = []RegistryConfiguration{
+					{
+						MatchImages:  []string{"registry.example.com"},
+						CacheKeyType: CacheKeyTypeImage,
+						Secret:       RegistrySecretConfiguration{Format: VaultSecretFormatDockerConfigJSON},
+					},
+					{
+						MatchImages:  []string{"registry.example.org"},
+						CacheKeyType: CacheKeyTypeRegistry,
+						Secret:       RegistrySecretConfiguration{Format: VaultSecretFormatDockerConfigJSON},
+					},
+				}
+				return cfg
+			}(),
+			wantErrMsg: "registries[0] cache key type Image is not supported by the dockerconfigjson secret format",
+		},
+		{
+			name: "invalid registry secret override",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Registries = []RegistryConfiguration{
+					{
+						MatchImages: []string{"*.example.com"},
+						Secret:      RegistrySecretConfiguration{Engine: VaultSecretEngineGeneric, Format: VaultSecretFormatJQ},
+					},
+				}
+				return cfg
+			}(),
+			wantErrMsg: "registries[0] secret jq username and password or auth expressions are required",
+		},
+		{
+			name: "negative vault cache duration",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Vault.CacheDuration = VaultCacheDurationConfiguration{Margin: -time.Minute}
+				return cfg
+			}(),
+			wantErrMsg: "vault cache duration margin, min and max must not be negative",
+		},
+		{
+			name: "vault cache duration min greater than max",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Vault.CacheDuration = VaultCacheDurationConfiguration{Min: time.Hour, Max: time.Minute}
+				return cfg
+			}(),
+			wantErrMsg: "vault cache duration min must not be greater than max",
+		},
+		{
+			name: "graceful",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Graceful = GracefulConfiguration{Enabled: true, CacheDuration: time.Minute}
+				return cfg
+			}(),
+			wantErrMsg: "",
+		},
+		{
+			name: "negative graceful cache duration",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Graceful = GracefulConfiguration{Enabled: true, CacheDuration: -time.Minute}
+				return cfg
+			}(),
+			wantErrMsg: "graceful cache duration must not be negative",
+		},
+		{
+			name: "daemon",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Daemon = DaemonConfiguration{Socket: "/run/kubelet-credential-provider-vault.sock", Timeout: 5 * time.Second}
+				return cfg
+			}(),
+			wantErrMsg: "",
+		},
+		{
+			name: "daemon without timeout",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Daemon = DaemonConfiguration{Socket: "/run/kubelet-credential-provider-vault.sock"}
+				return cfg
+			}(),
+			wantErrMsg: "daemon timeout must be greater than zero",
+		},
+		{
+			name: "registries without default secret",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Vault.Secret.Mount = ""
+				cfg.Vault.Secret.Path = ""
+				cfg.Registries = []RegistryConfiguration{
+					{
+						MatchImages: []string{"*.example.com"},
+						Secret:      RegistrySecretConfiguration{Mount: "registries", Path: "example"},
+					},
+				}
+				return cfg
+			}(),
+			wantErrMsg: "",
+		},
+		{
+			name: "invalid registry",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Vault.Secret.Path = ""
+				cfg.Registries = []RegistryConfiguration{
+					{
+						MatchImages:  []string{"[.example.com"},
+						Secret:       RegistrySecretConfiguration{Mount: "{{ .Registry"},
+						CacheKeyType: "Repository",
+					},
+					{},
+				}
+				return cfg
+			}(),
+			wantErrMsg: "registries[0] match image [.example.com is invalid: parse \"https://[.example.com\": missing ']' in host; registries[0] cache key type is invalid. valid values are: Image, Registry, Global; registries[0] secret mount is not a valid template: template: mount:1: unclosed action; registries[0] secret path is required; registries[1] match images are required; registries[1] secret path is required",
+		},
+		{
+			name: "missing vault token cache directory",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Vault.TokenCache = VaultTokenCacheConfiguration{
+					Enabled: true,
+					KeyFile: "/etc/kubelet-credential-provider-vault/token-cache.key",
+				}
+				return cfg
+			}(),
+			wantErrMsg: "vault token cache directory is required",
+		},
+		{
+			name: "missing vault token cache key file",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Vault.TokenCache = VaultTokenCacheConfiguration{
+					Enabled:   true,
+					Directory: "/var/lib/kubelet-credential-provider-vault/token-cache",
+				}
+				return cfg
+			}(),
+			wantErrMsg: "vault token cache key file is required",
+		},
+		{
+			name: "vault token cache key file inside the token cache directory",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Vault.TokenCache = VaultTokenCacheConfiguration{
+					Enabled:   true,
+					Directory: "/var/lib/kubelet-credential-provider-vault/token-cache/",
+					KeyFile:   "/var/lib/kubelet-credential-provider-vault/token-cache/sub/../key",
+				}
+				return cfg
+			}(),
+			wantErrMsg: "vault token cache key file must not be inside the token cache directory",
+		},
+		{
+			name: "vault revoke token with token cache",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Vault.TokenCache = VaultTokenCacheConfiguration{
+					Enabled:   true,
+					Directory: "/var/lib/kubelet-credential-provider-vault/token-cache",
+					KeyFile:   "/etc/kubelet-credential-provider-vault/token-cache.key",
+				}
+				cfg.Vault.RevokeToken = VaultRevokeTokenConfiguration{
+					Enabled: true,
+					Timeout: time.Second,
+				}
+				return cfg
+			}(),
+			wantErrMsg: "vault revoke token can not be combined with the vault token cache",
+		},
+		{
+			name: "vault auth token wrapped without token cache",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Vault.Auth = []VaultAuthConfiguration{
+					{Method: VaultAuthMethodKubernetes, Mount: "kubernetes", Role: "example"},
+					{Method: VaultAuthMethodToken, Token: VaultTokenAuthConfiguration{File: "/run/vault-agent/token", Wrapped: true}},
+				}
+				return cfg
+			}(),
+			wantErrMsg: "vault auth[1] token wrapped requires the vault token cache",
+		},
+		{
+			name: "vault auth approle secret id wrapped without token cache",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Vault.Auth = []VaultAuthConfiguration{
+					{Method: VaultAuthMethodAppRole, Mount: "approle", AppRole: VaultAppRoleAuthConfiguration{RoleIDFile: "/etc/vault/role-id", SecretIDFile: "/etc/vault/secret-id", SecretIDWrapped: true}},
+				}
+				return cfg
+			}(),
+			wantErrMsg: "vault auth approle secret id wrapped requires the vault token cache",
+		},
+		{
+			name: "vault auth token wrapped with token cache",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Vault.Auth = []VaultAuthConfiguration{
+					{Method: VaultAuthMethodToken, Token: VaultTokenAuthConfiguration{File: "/run/vault-agent/token", Wrapped: true}},
+				}
+				cfg.Vault.TokenCache = VaultTokenCacheConfiguration{
+					Enabled:   true,
+					Directory: "/var/lib/kubelet-credential-provider-vault/token-cache",
+					KeyFile:   "/etc/kubelet-credential-provider-vault/token-cache.key",
+				}
+				return cfg
+			}(),
+			wantErrMsg: "",
+		},
+		{
+			name: "vault revoke token with generic secret engine",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Vault.Secret.Engine = VaultSecretEngineGeneric
+				cfg.Vault.RevokeToken = VaultRevokeTokenConfiguration{
+					Enabled: true,
+					Timeout: time.Second,
+				}
+				return cfg
+			}(),
+			wantErrMsg: "vault revoke token can not be combined with the generic vault secret engine",
+		},
+		{
+			name: "vault revoke token with generic secret engine of registry",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Registries = []RegistryConfiguration{
+					{
+						MatchImages: []string{"artifactory.example.com"},
+						Secret:      RegistrySecretConfiguration{Engine: VaultSecretEngineGeneric, Mount: "artifactory", Path: "token/puller"},
+					},
+				}
+				cfg.Vault.RevokeToken = VaultRevokeTokenConfiguration{
+					Enabled: true,
+					Timeout: time.Second,
+				}
+				return cfg
+			}(),
+			wantErrMsg: "vault revoke token can not be combined with the generic secret engine of registries[0]",
+		},
+		{
+			name: "missing vault revoke token timeout",
+			config: func() Configuration {
+				cfg := defaultConfig
+				cfg.Vault.RevokeToken = VaultRevokeTokenConfiguration{
+					Enabled: true,
+				}
+				return cfg
+			}(),
+			wantErrMsg: "vault revoke token timeout must be greater than zero",
+		},
 	}
 
 	for _, tt := range tests {
@@ -162,3 +737,143 @@ func TestValidate(t *testing.T) {
 		})
 	}
 }
+
+func TestVaultAuthConfigurationDecodeHook(t *testing.T) {
+	tests := []struct {
+		name  string
+		input map[string]any
+		want  []VaultAuthConfiguration
+	}{
+		{
+			name: "single auth method",
+			input: map[string]any{
+				"auth": map[string]any{
+					"method": "kubernetes",
+					"mount":  "kubernetes",
+					"role":   "example",
+				},
+			},
+			want: []VaultAuthConfiguration{
+				{
+					Method: VaultAuthMethodKubernetes,
+					Mount:  "kubernetes",
+					Role:   "example",
+				},
+			},
+		},
+		{
+			name: "auth method chain",
+			input: map[string]any{
+				"auth": []any{
+					map[string]any{
+						"method": "kubernetes",
+						"mount":  "kubernetes",
+						"role":   "example",
+					},
+					map[string]any{
+						"method": "token",
+						"token": map[string]any{
+							"file": "/var/run/vault-agent/token",
+						},
+					},
+				},
+			},
+			want: []VaultAuthConfiguration{
+				{
+					Method: VaultAuthMethodKubernetes,
+					Mount:  "kubernetes",
+					Role:   "example",
+				},
+				{
+					Method: VaultAuthMethodToken,
+					Token: VaultTokenAuthConfiguration{
+						File: "/var/run/vault-agent/token",
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got VaultConfiguration
+			decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+				DecodeHook: vaultAuthConfigurationDecodeHook,
+				Result:     &got,
+			})
+			if err != nil {
+				t.Fatalf("failed to create decoder: %v", err)
+			}
+			if err := decoder.Decode(tt.input); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got.Auth, tt.want) {
+				t.Errorf("unexpected auth configuration: got %v, want %v", got.Auth, tt.want)
+			}
+		})
+	}
+}
+
+func TestStringToStringMapDecodeHook(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      map[string]any
+		want       map[string]string
+		wantErrMsg string
+	}{
+		{
+			name: "comma separated pairs",
+			input: map[string]any{
+				"namespaceMapping": "team-a=tenants/team-a, team-b=tenants/team-b",
+			},
+			want: map[string]string{
+				"team-a": "tenants/team-a",
+				"team-b": "tenants/team-b",
+			},
+		},
+		{
+			name: "map",
+			input: map[string]any{
+				"namespaceMapping": map[string]any{
+					"team-a": "tenants/team-a",
+				},
+			},
+			want: map[string]string{
+				"team-a": "tenants/team-a",
+			},
+		},
+		{
+			name: "invalid pair",
+			input: map[string]any{
+				"namespaceMapping": "team-a",
+			},
+			wantErrMsg: "invalid key=value pair: team-a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got VaultConfiguration
+			decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+				DecodeHook: stringToStringMapDecodeHook,
+				Result:     &got,
+			})
+			if err != nil {
+				t.Fatalf("failed to create decoder: %v", err)
+			}
+			err = decoder.Decode(tt.input)
+			if tt.wantErrMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrMsg) {
+					t.Errorf("unexpected error: got %v, want %v", err, tt.wantErrMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got.NamespaceMapping, tt.want) {
+				t.Errorf("unexpected namespace mapping: got %v, want %v", got.NamespaceMapping, tt.want)
+			}
+		})
+	}
+}
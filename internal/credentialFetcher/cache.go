@@ -0,0 +1,123 @@
+package credentialFetcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/logger"
+	credentialproviderV1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
+)
+
+// CredentialCache keeps credentials in memory until their cache duration expires, so a long running process like
+// the daemon answers repeated requests without vault. It is safe for concurrent use.
+type CredentialCache struct {
+	mu      sync.Mutex
+	entries map[string]credentialCacheEntry
+}
+
+type credentialCacheEntry struct {
+	credentials Credentials
+	expireTime  time.Time
+}
+
+func NewCredentialCache() *CredentialCache {
+	return &CredentialCache{
+		entries: map[string]credentialCacheEntry{},
+	}
+}
+
+// Get returns the credentials for the key with the remaining cache duration or nil if there are no valid credentials
+func (c *CredentialCache) Get(key string, now time.Time) *Credentials {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	remaining := entry.expireTime.Sub(now)
+	if remaining <= 0 {
+		delete(c.entries, key)
+		return nil
+	}
+	credentials := entry.credentials
+	credentials.CacheDuration = &remaining
+	return &credentials
+}
+
+// Set caches the credentials for their cache duration, credentials without cache duration are not cached
+// because the kubelet decides how long they are valid
+func (c *CredentialCache) Set(key string, credentials *Credentials, now time.Time) {
+	if credentials.CacheDuration == nil || *credentials.CacheDuration <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// expired entries are removed, so the cache does not grow with images that are not pulled again
+	for k, entry := range c.entries {
+		if !entry.expireTime.After(now) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = credentialCacheEntry{
+		credentials: *credentials,
+		expireTime:  now.Add(*credentials.CacheDuration),
+	}
+}
+
+// CachingCredentialFetcher answers requests from the credential cache and fetches the credentials of other requests
+// with the wrapped fetcher
+type CachingCredentialFetcher struct {
+	fetcher CredentialFetcher
+	cache   *CredentialCache
+}
+
+func NewCachingCredentialFetcher(fetcher CredentialFetcher, cache *CredentialCache) CredentialFetcher {
+	return &CachingCredentialFetcher{
+		fetcher: fetcher,
+		cache:   cache,
+	}
+}
+
+func (f *CachingCredentialFetcher) Fetch(ctx context.Context, log logger.Logger, request *credentialproviderV1.CredentialProviderRequest) (*Credentials, error) {
+	key, err := credentialCacheKey(request)
+	if err != nil {
+		log.Log(ctx, slog.LevelWarn, "Not using credential cache", "error", err)
+		return f.fetcher.Fetch(ctx, log, request)
+	}
+	if credentials := f.cache.Get(key, time.Now()); credentials != nil {
+		log.Log(ctx, slog.LevelDebug, "Using cached credentials", "cacheDuration", *credentials.CacheDuration)
+		return credentials, nil
+	}
+
+	credentials, err := f.fetcher.Fetch(ctx, log, request)
+	if err != nil {
+		return nil, err
+	}
+	f.cache.Set(key, credentials, time.Now())
+	return credentials, nil
+}
+
+func (f *CachingCredentialFetcher) Cleanup(ctx context.Context, log logger.Logger) error {
+	return f.fetcher.Cleanup(ctx, log)
+}
+
+// credentialCacheKey identifies the credentials of a request. Credentials are cached per service account token
+// instead of per service account, because the plugin does not verify the token (only vault does on login),
+// so a forged token with the claims of another service account must not get its cached credentials.
+func credentialCacheKey(request *credentialproviderV1.CredentialProviderRequest) (string, error) {
+	identity := ""
+	if request.ServiceAccountToken != "" {
+		identity = tokenHash(request.ServiceAccountToken)
+	}
+
+	// annotations may override the role and secret, so they are part of the key (maps are marshaled with sorted keys)
+	key, err := json.Marshal([]any{request.Image, identity, request.ServiceAccountAnnotations})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal cache key: %w", err)
+	}
+	return string(key), nil
+}
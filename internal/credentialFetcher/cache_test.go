@@ -0,0 +1,193 @@
+package credentialFetcher
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/logger"
+	credentialproviderV1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
+)
+
+func TestCredentialCache(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		cacheDuration *time.Duration
+		age           time.Duration
+		want          *time.Duration
+	}{
+		{
+			name:          "valid credentials",
+			cacheDuration: durationPtr(time.Hour),
+			age:           10 * time.Minute,
+			want:          durationPtr(50 * time.Minute),
+		},
+		{
+			name:          "expired credentials",
+			cacheDuration: durationPtr(time.Hour),
+			age:           time.Hour,
+			want:          nil,
+		},
+		{
+			name:          "credentials without cache duration",
+			cacheDuration: nil,
+			want:          nil,
+		},
+		{
+			name:          "credentials with zero cache duration",
+			cacheDuration: durationPtr(0),
+			want:          nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewCredentialCache()
+			cache.Set("key", &Credentials{
+				AuthConfig:    &credentialproviderV1.AuthConfig{Username: "user", Password: "password"},
+				CacheDuration: tt.cacheDuration,
+			}, now)
+
+			got := cache.Get("key", now.Add(tt.age))
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("unexpected credentials: %v", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatalf("credentials are not cached")
+			}
+			if *got.CacheDuration != *tt.want {
+				t.Errorf("unexpected cache duration: got %s, want %s", *got.CacheDuration, *tt.want)
+			}
+			if got.AuthConfig.Username != "user" {
+				t.Errorf("unexpected credentials: %v", got.AuthConfig)
+			}
+		})
+	}
+}
+
+func TestCachingCredentialFetcher(t *testing.T) {
+	cache := NewCredentialCache()
+	fetcher := NewCachingCredentialFetcher(NewMockCredentialFetcherWithCredentials(&Credentials{
+		AuthConfig:    &credentialproviderV1.AuthConfig{Username: "user", Password: "password"},
+		CacheDuration: durationPtr(time.Hour),
+	}), cache)
+	log, err := logger.NewFileLogger(false, "", "error")
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+
+	request := &credentialproviderV1.CredentialProviderRequest{Image: "registry.example.com/app"}
+	if _, err := fetcher.Fetch(t.Context(), log, request); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	key, err := credentialCacheKey(request)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cache.Get(key, time.Now()) == nil {
+		t.Errorf("fetched credentials are not cached")
+	}
+}
+
+func TestCredentialCacheKey(t *testing.T) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256"}`))
+	token := func(payload string) string {
+		return header + "." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".signature"
+	}
+	base := &credentialproviderV1.CredentialProviderRequest{
+		Image:               "registry.example.com/app",
+		ServiceAccountToken: token(`{"kubernetes.io":{"namespace":"team-a","serviceaccount":{"name":"puller","uid":"1234"},"pod":{"name":"a","uid":"1"}}}`),
+	}
+
+	tests := []struct {
+		name       string
+		request    *credentialproviderV1.CredentialProviderRequest
+		wantSame   bool
+		wantErrMsg string
+	}{
+		{
+			name: "same service account token",
+			request: &credentialproviderV1.CredentialProviderRequest{
+				Image:               "registry.example.com/app",
+				ServiceAccountToken: base.ServiceAccountToken,
+			},
+			wantSame: true,
+		},
+		{
+			name: "other pod of the service account",
+			request: &credentialproviderV1.CredentialProviderRequest{
+				Image:               "registry.example.com/app",
+				ServiceAccountToken: token(`{"kubernetes.io":{"namespace":"team-a","serviceaccount":{"name":"puller","uid":"1234"},"pod":{"name":"b","uid":"2"}}}`),
+			},
+			wantSame: false,
+		},
+		{
+			name: "forged token with the claims of the service account",
+			request: &credentialproviderV1.CredentialProviderRequest{
+				Image:               "registry.example.com/app",
+				ServiceAccountToken: strings.TrimSuffix(base.ServiceAccountToken, "signature") + "forged",
+			},
+			wantSame: false,
+		},
+		{
+			name: "other service account",
+			request: &credentialproviderV1.CredentialProviderRequest{
+				Image:               "registry.example.com/app",
+				ServiceAccountToken: token(`{"kubernetes.io":{"namespace":"team-b","serviceaccount":{"name":"puller","uid":"5678"}}}`),
+			},
+			wantSame: false,
+		},
+		{
+			name: "other image",
+			request: &credentialproviderV1.CredentialProviderRequest{
+				Image:               "registry.example.com/other",
+				ServiceAccountToken: base.ServiceAccountToken,
+			},
+			wantSame: false,
+		},
+		{
+			name: "service account annotations",
+			request: &credentialproviderV1.CredentialProviderRequest{
+				Image:                     "registry.example.com/app",
+				ServiceAccountToken:       base.ServiceAccountToken,
+				ServiceAccountAnnotations: map[string]string{ServiceAccountAnnotationPrefix + "role": "team-a"},
+			},
+			wantSame: false,
+		},
+		{
+			name: "no service account token",
+			request: &credentialproviderV1.CredentialProviderRequest{
+				Image: "registry.example.com/app",
+			},
+			wantSame: false,
+		},
+	}
+
+	baseKey, err := credentialCacheKey(base)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := credentialCacheKey(tt.request)
+			if tt.wantErrMsg != "" {
+				if err == nil || err.Error() != tt.wantErrMsg {
+					t.Fatalf("expected error %q, got %v", tt.wantErrMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (key == baseKey) != tt.wantSame {
+				t.Errorf("unexpected key: got %s, base %s, want same %v", key, baseKey, tt.wantSame)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package credentialFetcher
+
+import (
+	"sync"
+	"time"
+
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/vault"
+)
+
+// VaultClientCache keeps authenticated vault clients in memory, so a long running process like the daemon reuses
+// their tokens and connections instead of logging in for every request. It is safe for concurrent use.
+type VaultClientCache struct {
+	mu      sync.Mutex
+	entries map[string]vaultClientCacheEntry
+}
+
+type vaultClientCacheEntry struct {
+	client vault.Client
+	// expireTime is zero if the token of the client does not expire
+	expireTime time.Time
+}
+
+func NewVaultClientCache() *VaultClientCache {
+	return &VaultClientCache{
+		entries: map[string]vaultClientCacheEntry{},
+	}
+}
+
+// Get returns the client for the key or nil if there is no client or its token expires within renewBefore
+func (c *VaultClientCache) Get(key string, now time.Time, renewBefore time.Duration) vault.Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	if !entry.expireTime.IsZero() && entry.expireTime.Sub(now) <= renewBefore {
+		// the token is renewed (or replaced by a new login) through the token cache
+		c.remove(key)
+		return nil
+	}
+	return entry.client
+}
+
+func (c *VaultClientCache) Set(key string, client vault.Client, expireTime time.Time, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// clients with expired tokens are removed, so the cache does not grow with service accounts that are not used again
+	for k, entry := range c.entries {
+		if !entry.expireTime.IsZero() && !entry.expireTime.After(now) {
+			c.remove(k)
+		}
+	}
+	if entry, ok := c.entries[key]; ok && entry.client != client {
+		c.remove(key)
+	}
+	c.entries[key] = vaultClientCacheEntry{
+		client:     client,
+		expireTime: expireTime,
+	}
+}
+
+func (c *VaultClientCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(key)
+}
+
+// remove removes the client and closes its idle connections, requests of fetchers that still use it are not affected
+func (c *VaultClientCache) remove(key string) {
+	if entry, ok := c.entries[key]; ok {
+		entry.client.CloseIdleConnections()
+		delete(c.entries, key)
+	}
+}
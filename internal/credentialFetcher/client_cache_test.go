@@ -0,0 +1,146 @@
+package credentialFetcher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/config"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/logger"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/tokenCache"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/vault"
+)
+
+func TestVaultClientCache(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		expireTime time.Time
+		want       bool
+	}{
+		{
+			name:       "valid token",
+			expireTime: now.Add(time.Hour),
+			want:       true,
+		},
+		{
+			name:       "token without expiry",
+			expireTime: time.Time{},
+			want:       true,
+		},
+		{
+			name:       "token near expiry",
+			expireTime: now.Add(30 * time.Second),
+			want:       false,
+		},
+		{
+			name:       "expired token",
+			expireTime: now.Add(-time.Minute),
+			want:       false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := vault.NewMockClientBuilder(nil).WithAgentAuth().Build(t.Context())
+			if err != nil {
+				t.Fatalf("failed to build client: %v", err)
+			}
+			cache := NewVaultClientCache()
+			if got := cache.Get("key", now, time.Minute); got != nil {
+				t.Fatalf("unexpected client in empty cache: %v", got)
+			}
+
+			cache.Set("key", client, tt.expireTime, now)
+			got := cache.Get("key", now, time.Minute)
+			if (got != nil) != tt.want {
+				t.Errorf("unexpected client: got %v, want client %v", got, tt.want)
+			}
+			if got != nil && got != client {
+				t.Errorf("unexpected client: got %v, want %v", got, client)
+			}
+
+			cache.Delete("key")
+			if got := cache.Get("key", now, time.Minute); got != nil {
+				t.Errorf("unexpected client after delete: %v", got)
+			}
+			if !client.(*vault.MockClient).Closed() {
+				t.Errorf("connections of removed client are not closed")
+			}
+		})
+	}
+}
+
+func TestVaultClientCacheRemovesExpiredClients(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clients := map[string]*vault.MockClient{}
+	for _, key := range []string{"expired", "valid", "without expiry", "new"} {
+		client, err := vault.NewMockClientBuilder(nil).WithAgentAuth().Build(t.Context())
+		if err != nil {
+			t.Fatalf("failed to build client: %v", err)
+		}
+		clients[key] = client.(*vault.MockClient)
+	}
+
+	cache := NewVaultClientCache()
+	cache.Set("expired", clients["expired"], now.Add(time.Minute), now)
+	cache.Set("valid", clients["valid"], now.Add(time.Hour), now)
+	cache.Set("without expiry", clients["without expiry"], time.Time{}, now)
+	// the token of the first client is expired when the last client is added, so it is removed without being looked up again
+	cache.Set("new", clients["new"], now.Add(time.Hour), now.Add(2*time.Minute))
+
+	if len(cache.entries) != 3 {
+		t.Errorf("unexpected number of cached clients: got %d, want 3", len(cache.entries))
+	}
+	for key, client := range clients {
+		_, cached := cache.entries[key]
+		if cached == (key == "expired") {
+			t.Errorf("unexpected client %s: cached %v", key, cached)
+		}
+		if client.Closed() != (key == "expired") {
+			t.Errorf("unexpected client %s: connections closed %v", key, client.Closed())
+		}
+	}
+}
+
+func TestSetupVaultClientWithClientCache(t *testing.T) {
+	auth := config.VaultAuthConfiguration{
+		Method: config.VaultAuthMethodAppRole,
+		Mount:  "approle",
+		AppRole: config.VaultAppRoleAuthConfiguration{
+			RoleIDFile:   writeTempFile(t, "role-id"),
+			SecretIDFile: writeTempFile(t, "secret-id"),
+		},
+	}
+	fetcher := VaultCredentialFetcher{
+		vaultConfig: &config.VaultConfiguration{
+			Address: "http://localhost:8200",
+			Auth:    []config.VaultAuthConfiguration{auth},
+			TokenCache: config.VaultTokenCacheConfiguration{
+				RenewBefore: time.Minute,
+			},
+		},
+		newVaultClientBuilder: func() vault.ClientBuilder { return vault.NewMockClientBuilder(nil) },
+		tokenCache:            tokenCache.NewMemoryTokenCache(),
+		vaultClientCache:      NewVaultClientCache(),
+	}
+	log, err := logger.NewFileLogger(false, "", "error")
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+
+	first, err := fetcher.setupVaultClient(t.Context(), log, fetcher.vaultConfig.Auth, "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fetcher.vaultClientCacheKey == "" {
+		t.Fatalf("client of the login is not cached")
+	}
+	second, err := fetcher.setupVaultClient(t.Context(), log, fetcher.vaultConfig.Auth, "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first != second {
+		t.Errorf("client is not reused: got %v, want %v", second, first)
+	}
+}
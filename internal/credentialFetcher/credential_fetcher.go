@@ -2,10 +2,66 @@ package credentialFetcher
 
 import (
 	"context"
+	"errors"
+	"time"
 
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/config"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/logger"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/vault"
 	credentialproviderV1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
 )
 
+// ErrServiceAccountTokenRequired is returned if an auth method needs the service account token, but the request does not contain it
+var ErrServiceAccountTokenRequired = errors.New("service account token is required")
+
+// ErrNoRegistryMatch is returned if no registry matches the image and there is no default secret
+var ErrNoRegistryMatch = errors.New("no registry matches image")
+
+// IsNoCredentials reports whether a fetch failed because there are no credentials for the request
+// (no service account token, no matching registry or a missing secret), instead of an error of the plugin or vault.
+// Joined errors (e.g. of an auth chain) only count if all of them are caused by missing credentials,
+// otherwise a vault outage of one auth method would be hidden by another method without a service account token.
+func IsNoCredentials(err error) bool {
+	switch err {
+	case nil:
+		return false
+	case ErrServiceAccountTokenRequired, ErrNoRegistryMatch, vault.ErrSecretNotFound, vault.ErrSecretVersionNotFound:
+		return true
+	}
+	switch wrapped := err.(type) {
+	case interface{ Unwrap() []error }:
+		errs := wrapped.Unwrap()
+		if len(errs) == 0 {
+			return false
+		}
+		for _, err := range errs {
+			if !IsNoCredentials(err) {
+				return false
+			}
+		}
+		return true
+	case interface{ Unwrap() error }:
+		return IsNoCredentials(wrapped.Unwrap())
+	}
+	return false
+}
+
+// Credentials are the result of a fetch
+type Credentials struct {
+	// AuthConfig is used for the registry of the requested image (may be nil if Auth is set)
+	AuthConfig *credentialproviderV1.AuthConfig
+	// Auth contains credentials keyed by registry (in kubelet matchImages format), e.g. from a docker config
+	Auth map[string]credentialproviderV1.AuthConfig
+	// CacheDuration is nil if the kubelet should use the defaultCacheDuration of the provider config
+	CacheDuration *time.Duration
+	// CacheKeyType defaults to Registry if it is empty
+	CacheKeyType config.CacheKeyType
+	// Aliases are registries that share AuthConfig with the registry of the requested image, e.g. mirrors
+	Aliases []string
+}
+
 type CredentialFetcher interface {
-	Fetch(ctx context.Context, request *credentialproviderV1.CredentialProviderRequest) (*credentialproviderV1.AuthConfig, error)
+	Fetch(ctx context.Context, log logger.Logger, request *credentialproviderV1.CredentialProviderRequest) (*Credentials, error)
+	// Cleanup releases the resources of the last fetch, it is called after the response is written
+	Cleanup(ctx context.Context, log logger.Logger) error
 }
@@ -0,0 +1,66 @@
+package credentialFetcher
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/vault"
+)
+
+func TestIsNoCredentials(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "missing service account token",
+			err:  fmt.Errorf("%w for jwt auth method", ErrServiceAccountTokenRequired),
+			want: true,
+		},
+		{
+			name: "missing service account token for all methods of auth chain",
+			err:  errors.Join(fmt.Errorf("kubernetes: %w for kubernetes auth method", ErrServiceAccountTokenRequired), fmt.Errorf("jwt: %w for jwt auth method", ErrServiceAccountTokenRequired)),
+			want: true,
+		},
+		{
+			name: "missing service account token and vault outage in auth chain",
+			err:  errors.Join(fmt.Errorf("kubernetes: %w for kubernetes auth method", ErrServiceAccountTokenRequired), errors.New("approle: failed to login: connection refused")),
+			want: false,
+		},
+		{
+			name: "wrapped auth chain with vault outage",
+			err:  fmt.Errorf("failed to setup vault client: %w", errors.Join(fmt.Errorf("kubernetes: %w for kubernetes auth method", ErrServiceAccountTokenRequired), errors.New("approle: failed to login: connection refused"))),
+			want: false,
+		},
+		{
+			name: "no registry match",
+			err:  fmt.Errorf("%w %s", ErrNoRegistryMatch, "registry.example.com/app"),
+			want: true,
+		},
+		{
+			name: "missing secret",
+			err:  fmt.Errorf("failed to read secret from vault: %w", fmt.Errorf("failed to read secret: %w", vault.ErrSecretNotFound)),
+			want: true,
+		},
+		{
+			name: "missing kv v2 secret version",
+			err:  fmt.Errorf("failed to read secret from vault: %w", vault.ErrSecretVersionNotFound),
+			want: true,
+		},
+		{
+			name: "other error",
+			err:  errors.New("failed to read secret from vault: permission denied"),
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsNoCredentials(tt.err); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -3,19 +3,43 @@ package credentialFetcher
 import (
 	"context"
 
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/logger"
 	credentialproviderV1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
 )
 
 type MockCredentialFetcher struct {
-	authConfig *credentialproviderV1.AuthConfig
+	credentials Credentials
+	err         error
 }
 
 func NewMockCredentialFetcher(authConfig *credentialproviderV1.AuthConfig) CredentialFetcher {
+	return NewMockCredentialFetcherWithCredentials(&Credentials{
+		AuthConfig: authConfig,
+	})
+}
+
+// NewMockCredentialFetcherWithCredentials returns a fetcher that returns a copy of the credentials
+func NewMockCredentialFetcherWithCredentials(credentials *Credentials) CredentialFetcher {
 	return &MockCredentialFetcher{
-		authConfig: authConfig,
+		credentials: *credentials,
+	}
+}
+
+// NewMockCredentialFetcherWithError returns a fetcher that fails with the error
+func NewMockCredentialFetcherWithError(err error) CredentialFetcher {
+	return &MockCredentialFetcher{
+		err: err,
+	}
+}
+
+func (f *MockCredentialFetcher) Fetch(_ context.Context, _ logger.Logger, _ *credentialproviderV1.CredentialProviderRequest) (*Credentials, error) {
+	if f.err != nil {
+		return nil, f.err
 	}
+	credentials := f.credentials
+	return &credentials, nil
 }
 
-func (f *MockCredentialFetcher) Fetch(_ context.Context, _ *credentialproviderV1.CredentialProviderRequest) (*credentialproviderV1.AuthConfig, error) {
-	return f.authConfig, nil
+func (f *MockCredentialFetcher) Cleanup(_ context.Context, _ logger.Logger) error {
+	return nil
 }
@@ -0,0 +1,240 @@
+package credentialFetcher
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/config"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/imageReference"
+	credentialproviderV1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
+)
+
+// parseAuthConfig reads the credentials from the configured fields of the secret data
+func parseAuthConfig(secretData map[string]any, fields *config.VaultSecretFieldsConfiguration) (*credentialproviderV1.AuthConfig, error) {
+	if fields.Auth != "" {
+		auth, ok := lookupSecretField(secretData, fields.Auth).(string)
+		if !ok {
+			return nil, fmt.Errorf("failed to read auth from secret data")
+		}
+		return parseAuth(auth)
+	}
+
+	username, ok := lookupSecretField(secretData, fields.Username).(string)
+	if !ok {
+		return nil, fmt.Errorf("failed to read username from secret data")
+	}
+	password, ok := lookupSecretField(secretData, fields.Password).(string)
+	if !ok {
+		return nil, fmt.Errorf("failed to read password from secret data")
+	}
+
+	return &credentialproviderV1.AuthConfig{
+		Username: username,
+		Password: password,
+	}, nil
+}
+
+// parseAuthConfigJQ reads the credentials with the configured jq expressions from the secret data
+func parseAuthConfigJQ(secretData map[string]any, expressions *config.VaultSecretJQConfiguration) (*credentialproviderV1.AuthConfig, error) {
+	// gojq only supports the types of encoding/json without json.Number, so the data is normalized first
+	data, err := json.Marshal(secretData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal secret data: %w", err)
+	}
+	var input any
+	if err := json.Unmarshal(data, &input); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal secret data: %w", err)
+	}
+
+	if expressions.Auth != "" {
+		auth, err := evaluateJQ(input, expressions.Auth)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read auth from secret data: %w", err)
+		}
+		return parseAuth(auth)
+	}
+
+	username, err := evaluateJQ(input, expressions.Username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read username from secret data: %w", err)
+	}
+	password, err := evaluateJQ(input, expressions.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read password from secret data: %w", err)
+	}
+
+	return &credentialproviderV1.AuthConfig{
+		Username: username,
+		Password: password,
+	}, nil
+}
+
+// evaluateJQ returns the first result of the jq expression, which must be a string
+func evaluateJQ(input any, expression string) (string, error) {
+	query, err := gojq.Parse(expression)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse expression %s: %w", expression, err)
+	}
+	result, ok := query.Run(input).Next()
+	if !ok {
+		return "", fmt.Errorf("expression %s did not return a value", expression)
+	}
+	if err, ok := result.(error); ok {
+		return "", fmt.Errorf("failed to evaluate expression %s: %w", expression, err)
+	}
+	value, ok := result.(string)
+	if !ok {
+		return "", fmt.Errorf("expression %s returned %T instead of a string", expression, result)
+	}
+	return value, nil
+}
+
+// lookupSecretField returns the value of the field, nested fields are separated by dots.
+// Keys that contain dots themselves (e.g. registry hosts) are matched as well, longer keys first.
+func lookupSecretField(data map[string]any, field string) any {
+	if value, ok := data[field]; ok {
+		return value
+	}
+	for i := strings.LastIndex(field, "."); i > 0; i = strings.LastIndex(field[:i], ".") {
+		nested, ok := data[field[:i]].(map[string]any)
+		if !ok {
+			continue
+		}
+		if value := lookupSecretField(nested, field[i+1:]); value != nil {
+			return value
+		}
+	}
+	return nil
+}
+
+// parseAuth parses "username:password" or its base64 encoding as used by the auth field of docker config files
+func parseAuth(auth string) (*credentialproviderV1.AuthConfig, error) {
+	// base64 encoded values never contain a colon
+	if !strings.Contains(auth, ":") {
+		decoded, err := base64.StdEncoding.DecodeString(auth)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode auth: %w", err)
+		}
+		auth = string(decoded)
+	}
+
+	username, password, ok := strings.Cut(auth, ":")
+	if !ok {
+		return nil, fmt.Errorf("auth is not in username:password format")
+	}
+	return &credentialproviderV1.AuthConfig{
+		Username: username,
+		Password: password,
+	}, nil
+}
+
+type dockerConfig struct {
+	Auths map[string]dockerConfigEntry `json:"auths"`
+}
+
+type dockerConfigEntry struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Auth     string `json:"auth"`
+}
+
+// parseDockerConfig reads the credentials of all registries of the docker config in the field of the secret data.
+// The field may contain the json document or structured data, if it is not set the secret data itself is used.
+func parseDockerConfig(secretData map[string]any, field string) (map[string]credentialproviderV1.AuthConfig, error) {
+	var document []byte
+	switch value := lookupSecretField(secretData, field).(type) {
+	case string:
+		document = []byte(value)
+	case map[string]any:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal docker config: %w", err)
+		}
+		document = data
+	case nil:
+		if _, ok := secretData["auths"]; !ok {
+			return nil, fmt.Errorf("failed to read docker config from secret data")
+		}
+		data, err := json.Marshal(secretData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal docker config: %w", err)
+		}
+		document = data
+	default:
+		return nil, fmt.Errorf("failed to read docker config from secret data: unexpected type %T", value)
+	}
+
+	var cfg dockerConfig
+	if err := json.Unmarshal(document, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal docker config: %w", err)
+	}
+	if len(cfg.Auths) == 0 {
+		return nil, fmt.Errorf("docker config does not contain any auths")
+	}
+
+	auth := make(map[string]credentialproviderV1.AuthConfig, len(cfg.Auths))
+	for key, entry := range cfg.Auths {
+		authConfig, err := entry.authConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read docker config entry %s: %w", key, err)
+		}
+		auth[normalizeDockerConfigKey(key)] = *authConfig
+	}
+	return auth, nil
+}
+
+func (e *dockerConfigEntry) authConfig() (*credentialproviderV1.AuthConfig, error) {
+	if e.Auth != "" {
+		return parseAuth(e.Auth)
+	}
+	if e.Username == "" && e.Password == "" {
+		return nil, fmt.Errorf("entry does not contain credentials")
+	}
+	return &credentialproviderV1.AuthConfig{
+		Username: e.Username,
+		Password: e.Password,
+	}, nil
+}
+
+// normalizeDockerConfigKey converts docker config keys like https://index.docker.io/v1/ to registries like index.docker.io
+func normalizeDockerConfigKey(key string) string {
+	key = strings.TrimPrefix(key, "https://")
+	key = strings.TrimPrefix(key, "http://")
+	key = strings.TrimSuffix(key, "/")
+	key = strings.TrimSuffix(key, "/v1")
+	key = strings.TrimSuffix(key, "/v2")
+	return key
+}
+
+// matchDockerConfig returns the most specific registry of the docker config that matches the image
+func matchDockerConfig(auth map[string]credentialproviderV1.AuthConfig, image string) (string, bool) {
+	ref, err := imageReference.Parse(image)
+	if err != nil {
+		return "", false
+	}
+	repository := normalizeDockerHubRegistry(ref.Name())
+	match := ""
+	for registry := range auth {
+		normalized := normalizeDockerHubRegistry(registry)
+		if repository != normalized && !strings.HasPrefix(repository, normalized+"/") {
+			continue
+		}
+		if len(registry) > len(match) {
+			match = registry
+		}
+	}
+	return match, match != ""
+}
+
+// normalizeDockerHubRegistry replaces the different docker hub hosts with docker.io
+func normalizeDockerHubRegistry(repository string) string {
+	for _, host := range []string{"index.docker.io", "registry-1.docker.io"} {
+		if rest, ok := strings.CutPrefix(repository, host); ok && (rest == "" || strings.HasPrefix(rest, "/")) {
+			return "docker.io" + rest
+		}
+	}
+	return repository
+}
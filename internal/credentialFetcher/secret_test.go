@@ -0,0 +1,443 @@
+package credentialFetcher
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/config"
+	credentialproviderV1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
+)
+
+func TestParseAuthConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		secretData map[string]any
+		fields     config.VaultSecretFieldsConfiguration
+		want       *credentialproviderV1.AuthConfig
+		wantErrMsg string
+	}{
+		{
+			name: "custom fields",
+			secretData: map[string]any{
+				"robot_name": "robot$example",
+				"token":      "secret",
+			},
+			fields: config.VaultSecretFieldsConfiguration{
+				Username: "robot_name",
+				Password: "token",
+			},
+			want: &credentialproviderV1.AuthConfig{
+				Username: "robot$example",
+				Password: "secret",
+			},
+			wantErrMsg: "",
+		},
+		{
+			name: "nested fields",
+			secretData: map[string]any{
+				"registry": map[string]any{
+					"login":  "login",
+					"secret": "secret",
+				},
+			},
+			fields: config.VaultSecretFieldsConfiguration{
+				Username: "registry.login",
+				Password: "registry.secret",
+			},
+			want: &credentialproviderV1.AuthConfig{
+				Username: "login",
+				Password: "secret",
+			},
+			wantErrMsg: "",
+		},
+		{
+			name: "field with dots in key",
+			secretData: map[string]any{
+				"registry.example.com": map[string]any{
+					"username": "username",
+				},
+				"password": "password",
+			},
+			fields: config.VaultSecretFieldsConfiguration{
+				Username: "registry.example.com.username",
+				Password: "password",
+			},
+			want: &credentialproviderV1.AuthConfig{
+				Username: "username",
+				Password: "password",
+			},
+			wantErrMsg: "",
+		},
+		{
+			name: "missing nested field",
+			secretData: map[string]any{
+				"registry": "registry.example.com",
+			},
+			fields: config.VaultSecretFieldsConfiguration{
+				Username: "registry.login",
+				Password: "registry.secret",
+			},
+			want:       nil,
+			wantErrMsg: "failed to read username from secret data",
+		},
+		{
+			name: "combined auth field",
+			secretData: map[string]any{
+				"auth": "username:pass:word",
+			},
+			fields: config.VaultSecretFieldsConfiguration{
+				Auth: "auth",
+			},
+			want: &credentialproviderV1.AuthConfig{
+				Username: "username",
+				Password: "pass:word",
+			},
+			wantErrMsg: "",
+		},
+		{
+			name: "base64 encoded auth field",
+			secretData: map[string]any{
+				"auth": "dXNlcm5hbWU6cGFzc3dvcmQ=",
+			},
+			fields: config.VaultSecretFieldsConfiguration{
+				Auth: "auth",
+			},
+			want: &credentialproviderV1.AuthConfig{
+				Username: "username",
+				Password: "password",
+			},
+			wantErrMsg: "",
+		},
+		{
+			name: "invalid base64 encoded auth field",
+			secretData: map[string]any{
+				"auth": "!!!",
+			},
+			fields: config.VaultSecretFieldsConfiguration{
+				Auth: "auth",
+			},
+			want:       nil,
+			wantErrMsg: "failed to decode auth: illegal base64 data at input byte 0",
+		},
+		{
+			name: "base64 encoded auth field without colon",
+			secretData: map[string]any{
+				"auth": "dXNlcm5hbWU=",
+			},
+			fields: config.VaultSecretFieldsConfiguration{
+				Auth: "auth",
+			},
+			want:       nil,
+			wantErrMsg: "auth is not in username:password format",
+		},
+		{
+			name: "missing auth field",
+			secretData: map[string]any{
+				"username": "username",
+				"password": "password",
+			},
+			fields: config.VaultSecretFieldsConfiguration{
+				Username: "username",
+				Password: "password",
+				Auth:     "auth",
+			},
+			want:       nil,
+			wantErrMsg: "failed to read auth from secret data",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAuthConfig(tt.secretData, &tt.fields)
+			if err != nil && err.Error() != tt.wantErrMsg {
+				t.Errorf("unexpected error: got %v, want %v", err, tt.wantErrMsg)
+			}
+			if err == nil && tt.wantErrMsg != "" {
+				t.Errorf("expected error: %v", tt.wantErrMsg)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unexpected auth config: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAuthConfigJQ(t *testing.T) {
+	tests := []struct {
+		name        string
+		secretData  map[string]any
+		expressions config.VaultSecretJQConfiguration
+		want        *credentialproviderV1.AuthConfig
+		wantErrMsg  string
+	}{
+		{
+			name: "username and password expressions",
+			secretData: map[string]any{
+				"username": "robot",
+				"tokens": []any{
+					map[string]any{"scope": "push", "token": "push-token"},
+					map[string]any{"scope": "pull", "token": "pull-token"},
+				},
+			},
+			expressions: config.VaultSecretJQConfiguration{
+				Username: ".username",
+				Password: `.tokens[] | select(.scope == "pull") | .token`,
+			},
+			want: &credentialproviderV1.AuthConfig{
+				Username: "robot",
+				Password: "pull-token",
+			},
+			wantErrMsg: "",
+		},
+		{
+			name: "constant username",
+			secretData: map[string]any{
+				"access_token": "token",
+			},
+			expressions: config.VaultSecretJQConfiguration{
+				Username: `"oauth2accesstoken"`,
+				Password: ".access_token",
+			},
+			want: &credentialproviderV1.AuthConfig{
+				Username: "oauth2accesstoken",
+				Password: "token",
+			},
+			wantErrMsg: "",
+		},
+		{
+			name: "auth expression",
+			secretData: map[string]any{
+				"user":  "username",
+				"token": "password",
+			},
+			expressions: config.VaultSecretJQConfiguration{
+				Auth: `.user + ":" + .token`,
+			},
+			want: &credentialproviderV1.AuthConfig{
+				Username: "username",
+				Password: "password",
+			},
+			wantErrMsg: "",
+		},
+		{
+			name: "expression without result",
+			secretData: map[string]any{
+				"username": "username",
+			},
+			expressions: config.VaultSecretJQConfiguration{
+				Username: ".username",
+				Password: "empty",
+			},
+			want:       nil,
+			wantErrMsg: "failed to read password from secret data: expression empty did not return a value",
+		},
+		{
+			name: "expression with non string result",
+			secretData: map[string]any{
+				"username": "username",
+				"password": 1234,
+			},
+			expressions: config.VaultSecretJQConfiguration{
+				Username: ".username",
+				Password: ".password",
+			},
+			want:       nil,
+			wantErrMsg: "failed to read password from secret data: expression .password returned float64 instead of a string",
+		},
+		{
+			name: "expression with error",
+			secretData: map[string]any{
+				"username": "username",
+			},
+			expressions: config.VaultSecretJQConfiguration{
+				Username: ".username.nested",
+				Password: ".password",
+			},
+			want:       nil,
+			wantErrMsg: "failed to read username from secret data: failed to evaluate expression .username.nested: expected an object but got: string (\"username\")",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAuthConfigJQ(tt.secretData, &tt.expressions)
+			if err != nil && err.Error() != tt.wantErrMsg {
+				t.Errorf("unexpected error: got %v, want %v", err, tt.wantErrMsg)
+			}
+			if err == nil && tt.wantErrMsg != "" {
+				t.Errorf("expected error: %v", tt.wantErrMsg)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unexpected auth config: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDockerConfig(t *testing.T) {
+	want := map[string]credentialproviderV1.AuthConfig{
+		"registry.example.com": {
+			Username: "username",
+			Password: "password",
+		},
+		"index.docker.io": {
+			Username: "hub-user",
+			Password: "hub-password",
+		},
+	}
+
+	tests := []struct {
+		name       string
+		secretData map[string]any
+		field      string
+		want       map[string]credentialproviderV1.AuthConfig
+		wantErrMsg string
+	}{
+		{
+			name: "json string field",
+			secretData: map[string]any{
+				".dockerconfigjson": `{"auths":{"registry.example.com":{"username":"username","password":"password"},"https://index.docker.io/v1/":{"auth":"aHViLXVzZXI6aHViLXBhc3N3b3Jk"}}}`,
+			},
+			field:      ".dockerconfigjson",
+			want:       want,
+			wantErrMsg: "",
+		},
+		{
+			name: "structured field",
+			secretData: map[string]any{
+				"config": map[string]any{
+					"auths": map[string]any{
+						"registry.example.com":        map[string]any{"username": "username", "password": "password"},
+						"https://index.docker.io/v1/": map[string]any{"auth": "aHViLXVzZXI6aHViLXBhc3N3b3Jk"},
+					},
+				},
+			},
+			field:      "config",
+			want:       want,
+			wantErrMsg: "",
+		},
+		{
+			name: "structured secret data",
+			secretData: map[string]any{
+				"auths": map[string]any{
+					"registry.example.com":        map[string]any{"username": "username", "password": "password"},
+					"https://index.docker.io/v1/": map[string]any{"auth": "aHViLXVzZXI6aHViLXBhc3N3b3Jk"},
+				},
+			},
+			field:      ".dockerconfigjson",
+			want:       want,
+			wantErrMsg: "",
+		},
+		{
+			name: "missing docker config",
+			secretData: map[string]any{
+				"username": "username",
+			},
+			field:      ".dockerconfigjson",
+			want:       nil,
+			wantErrMsg: "failed to read docker config from secret data",
+		},
+		{
+			name: "invalid json",
+			secretData: map[string]any{
+				".dockerconfigjson": `{"auths":`,
+			},
+			field:      ".dockerconfigjson",
+			want:       nil,
+			wantErrMsg: "failed to unmarshal docker config: unexpected end of JSON input",
+		},
+		{
+			name: "empty auths",
+			secretData: map[string]any{
+				".dockerconfigjson": `{"auths":{}}`,
+			},
+			field:      ".dockerconfigjson",
+			want:       nil,
+			wantErrMsg: "docker config does not contain any auths",
+		},
+		{
+			name: "entry without credentials",
+			secretData: map[string]any{
+				".dockerconfigjson": `{"auths":{"registry.example.com":{"email":"user@example.com"}}}`,
+			},
+			field:      ".dockerconfigjson",
+			want:       nil,
+			wantErrMsg: "failed to read docker config entry registry.example.com: entry does not contain credentials",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDockerConfig(tt.secretData, tt.field)
+			if err != nil && err.Error() != tt.wantErrMsg {
+				t.Errorf("unexpected error: got %v, want %v", err, tt.wantErrMsg)
+			}
+			if err == nil && tt.wantErrMsg != "" {
+				t.Errorf("expected error: %v", tt.wantErrMsg)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unexpected auth: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchDockerConfig(t *testing.T) {
+	auth := map[string]credentialproviderV1.AuthConfig{
+		"registry.example.com":        {Username: "registry"},
+		"registry.example.com/team-a": {Username: "team-a"},
+		"registry.example.com:5000":   {Username: "port"},
+		"index.docker.io":             {Username: "hub"},
+	}
+
+	tests := []struct {
+		name  string
+		image string
+		want  string
+	}{
+		{
+			name:  "registry",
+			image: "registry.example.com/team-b/app:latest",
+			want:  "registry.example.com",
+		},
+		{
+			name:  "most specific path",
+			image: "registry.example.com/team-a/app@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+			want:  "registry.example.com/team-a",
+		},
+		{
+			name:  "registry with port",
+			image: "registry.example.com:5000/app:1.0",
+			want:  "registry.example.com:5000",
+		},
+		{
+			name:  "docker hub image",
+			image: "nginx:latest",
+			want:  "index.docker.io",
+		},
+		{
+			name:  "docker hub image with organization",
+			image: "docker.io/library/nginx",
+			want:  "index.docker.io",
+		},
+		{
+			name:  "no match",
+			image: "other.example.com/app",
+			want:  "",
+		},
+		{
+			name:  "no match for registry prefix",
+			image: "registry.example.com.evil.com/app",
+			want:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := matchDockerConfig(auth, tt.image)
+			if got != tt.want || ok != (tt.want != "") {
+				t.Errorf("unexpected match: got %v (%v), want %v", got, ok, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package credentialFetcher
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/config"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/imageReference"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/serviceAccountToken"
+)
+
+// SecretTemplateData are the variables of the secret mount and path templates, e.g. registries/{{ .Namespace }}/{{ .Registry }}
+type SecretTemplateData struct {
+	// Registry is the registry host of the image, e.g. registry.example.com (docker.io for docker hub images)
+	Registry string
+	// Repository is the repository path of the image without registry, e.g. team/app
+	Repository string
+	Tag        string
+	Digest     string
+	// serviceAccount is nil if the plugin is not configured to receive a service account token
+	serviceAccount *serviceAccountTemplateData
+}
+
+// serviceAccountTemplateData are read from the service account token claims
+type serviceAccountTemplateData struct {
+	namespace string
+	name      string
+	uid       string
+}
+
+// Namespace, ServiceAccountName and ServiceAccountUID fail the rendering without a service account token,
+// instead of rendering an empty value that would resolve to another secret (e.g. registries//app)
+func (d *SecretTemplateData) Namespace() (string, error) {
+	if d.serviceAccount == nil {
+		return "", fmt.Errorf("%w for template variable Namespace", ErrServiceAccountTokenRequired)
+	}
+	return d.serviceAccount.namespace, nil
+}
+
+func (d *SecretTemplateData) ServiceAccountName() (string, error) {
+	if d.serviceAccount == nil {
+		return "", fmt.Errorf("%w for template variable ServiceAccountName", ErrServiceAccountTokenRequired)
+	}
+	return d.serviceAccount.name, nil
+}
+
+func (d *SecretTemplateData) ServiceAccountUID() (string, error) {
+	if d.serviceAccount == nil {
+		return "", fmt.Errorf("%w for template variable ServiceAccountUID", ErrServiceAccountTokenRequired)
+	}
+	return d.serviceAccount.uid, nil
+}
+
+// newSecretTemplateData returns the template variables of the image and service account token
+func newSecretTemplateData(image string, token string) (*SecretTemplateData, error) {
+	ref, err := imageReference.Parse(image)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image: %w", err)
+	}
+	data := &SecretTemplateData{
+		Registry:   ref.Registry,
+		Repository: ref.Repository,
+		Tag:        ref.Tag,
+		Digest:     ref.Digest,
+	}
+
+	if token != "" {
+		claims, err := serviceAccountToken.ParseClaims(token)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse service account token claims: %w", err)
+		}
+		data.serviceAccount = &serviceAccountTemplateData{
+			namespace: claims.Kubernetes.Namespace,
+			name:      claims.Kubernetes.ServiceAccount.Name,
+			uid:       claims.Kubernetes.ServiceAccount.UID,
+		}
+	}
+
+	return data, nil
+}
+
+// renderSecretConfig returns a copy of the secret configuration with the mount and path templates rendered
+func renderSecretConfig(secretConfig config.VaultSecretConfiguration, data *SecretTemplateData) (config.VaultSecretConfiguration, error) {
+	mount, err := renderTemplate("mount", secretConfig.Mount, data)
+	if err != nil {
+		return secretConfig, fmt.Errorf("failed to render secret mount: %w", err)
+	}
+	path, err := renderTemplate("path", secretConfig.Path, data)
+	if err != nil {
+		return secretConfig, fmt.Errorf("failed to render secret path: %w", err)
+	}
+
+	secretConfig.Mount = mount
+	secretConfig.Path = path
+	return secretConfig, nil
+}
+
+// isTemplate reports whether the value contains template actions, plain values are used as they are
+func isTemplate(text string) bool {
+	return strings.Contains(text, "{{")
+}
+
+func renderTemplate(name string, text string, data *SecretTemplateData) (string, error) {
+	if !isTemplate(text) {
+		return text, nil
+	}
+
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template: %w", err)
+	}
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", fmt.Errorf("failed to execute template: %w", err)
+	}
+	if rendered.Len() == 0 {
+		return "", fmt.Errorf("template rendered an empty value")
+	}
+	return rendered.String(), nil
+}
@@ -0,0 +1,106 @@
+package credentialFetcher
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/config"
+)
+
+func TestRenderSecretConfig(t *testing.T) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"kubernetes.io":{"namespace":"team-a","serviceaccount":{"name":"app","uid":"1234"}}}`))
+	token := header + "." + payload + ".signature"
+
+	tests := []struct {
+		name                string
+		mount               string
+		path                string
+		image               string
+		serviceAccountToken string
+		wantMount           string
+		wantPath            string
+		wantErrMsg          string
+		// wantNoCredentials is set if the error must be treated as missing credentials (e.g. by the graceful mode)
+		wantNoCredentials bool
+	}{
+		{
+			name:                "plain values",
+			mount:               "secret",
+			path:                "registries/example",
+			image:               "registry.example.com/team/app:1.0",
+			serviceAccountToken: "",
+			wantMount:           "secret",
+			wantPath:            "registries/example",
+			wantErrMsg:          "",
+		},
+		{
+			name:                "image variables",
+			mount:               "secret",
+			path:                "registries/{{ .Registry }}/{{ .Repository }}/{{ .Tag }}",
+			image:               "registry.example.com/team/app:1.0",
+			serviceAccountToken: "",
+			wantMount:           "secret",
+			wantPath:            "registries/registry.example.com/team/app/1.0",
+			wantErrMsg:          "",
+		},
+		{
+			name:                "service account variables",
+			mount:               "{{ .Namespace }}-secrets",
+			path:                "registries/{{ .Namespace }}/{{ .ServiceAccountName }}/{{ .ServiceAccountUID }}/{{ .Registry }}",
+			image:               "nginx@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+			serviceAccountToken: token,
+			wantMount:           "team-a-secrets",
+			wantPath:            "registries/team-a/app/1234/docker.io",
+			wantErrMsg:          "",
+		},
+		{
+			name:                "unknown variable",
+			mount:               "secret",
+			path:                "registries/{{ .Unknown }}",
+			image:               "registry.example.com/team/app:1.0",
+			serviceAccountToken: "",
+			wantErrMsg:          "failed to render secret path: failed to execute template: template: path:1:14: executing \"path\" at <.Unknown>: can't evaluate field Unknown in type *credentialFetcher.SecretTemplateData",
+		},
+		{
+			name:                "service account variable without service account token",
+			mount:               "secret",
+			path:                "registries/{{ .Namespace }}/{{ .Repository }}",
+			image:               "registry.example.com/team/app:1.0",
+			serviceAccountToken: "",
+			wantErrMsg:          "failed to render secret path: failed to execute template: template: path:1:14: executing \"path\" at <.Namespace>: error calling Namespace: service account token is required for template variable Namespace",
+			wantNoCredentials:   true,
+		},
+		{
+			name:                "empty value",
+			mount:               "secret",
+			path:                "{{ .Digest }}",
+			image:               "registry.example.com/team/app:1.0",
+			serviceAccountToken: "",
+			wantErrMsg:          "failed to render secret path: template rendered an empty value",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := newSecretTemplateData(tt.image, tt.serviceAccountToken)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got, err := renderSecretConfig(config.VaultSecretConfiguration{Mount: tt.mount, Path: tt.path}, data)
+			if err != nil && err.Error() != tt.wantErrMsg {
+				t.Errorf("unexpected error: got %v, want %v", err, tt.wantErrMsg)
+			}
+			if err == nil && tt.wantErrMsg != "" {
+				t.Errorf("expected error: %v", tt.wantErrMsg)
+			}
+			if err != nil && IsNoCredentials(err) != tt.wantNoCredentials {
+				t.Errorf("unexpected no credentials error: got %v, want %v", IsNoCredentials(err), tt.wantNoCredentials)
+			}
+			if err == nil && (got.Mount != tt.wantMount || got.Path != tt.wantPath) {
+				t.Errorf("unexpected secret: got %v/%v, want %v/%v", got.Mount, got.Path, tt.wantMount, tt.wantPath)
+			}
+		})
+	}
+}
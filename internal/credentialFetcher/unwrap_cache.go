@@ -0,0 +1,55 @@
+package credentialFetcher
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/config"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/logger"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/tokenCache"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/vault"
+)
+
+// tokenCacheUnwrapCache keeps the secret of a wrapping token in the token cache. There is one entry per file the
+// wrapping tokens are read from, so the entry is replaced when the file contains a new wrapping token.
+type tokenCacheUnwrapCache struct {
+	ctx        context.Context
+	log        logger.Logger
+	tokenCache tokenCache.TokenCache
+	key        string
+}
+
+// newUnwrapCache returns the unwrap cache for the wrapping tokens read from the given file (empty for VAULT_TOKEN)
+func (f *VaultCredentialFetcher) newUnwrapCache(ctx context.Context, log logger.Logger, auth *config.VaultAuthConfiguration, namespace string, file string) vault.UnwrapCache {
+	return &tokenCacheUnwrapCache{
+		ctx:        ctx,
+		log:        log,
+		tokenCache: f.tokenCache,
+		key:        strings.Join([]string{"unwrap", f.vaultConfig.Address, namespace, string(auth.Method), auth.Mount, file}, "|"),
+	}
+}
+
+func (c *tokenCacheUnwrapCache) Get(wrappingToken string) string {
+	entry, err := c.tokenCache.Get(c.key)
+	if err != nil {
+		c.log.Log(c.ctx, slog.LevelWarn, "Failed to read unwrapped secret from cache", "error", err)
+		return ""
+	}
+	if entry == nil || entry.WrappingTokenHash != tokenHash(wrappingToken) {
+		return ""
+	}
+	c.log.Log(c.ctx, slog.LevelDebug, "Using cached secret of wrapping token")
+	return entry.Token
+}
+
+func (c *tokenCacheUnwrapCache) Set(wrappingToken string, secret string) {
+	entry := &tokenCache.Entry{
+		Token:             secret,
+		WrappingTokenHash: tokenHash(wrappingToken),
+	}
+	// the wrapping token is not valid anymore, so the following invocations fail until it is replaced
+	if err := c.tokenCache.Set(c.key, entry); err != nil {
+		c.log.Log(c.ctx, slog.LevelWarn, "Failed to write unwrapped secret to cache", "error", err)
+	}
+}
@@ -2,85 +2,701 @@ package credentialFetcher
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/config"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/helpers"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/imageReference"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/logger"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/serviceAccountToken"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/tokenCache"
 	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/vault"
 	credentialproviderV1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
 )
 
+// ServiceAccountAnnotationPrefix is the prefix of service account annotations that override the configuration,
+// e.g. vault.credential-provider/role
+const ServiceAccountAnnotationPrefix = "vault.credential-provider/"
+
 type VaultCredentialFetcher struct {
-	vaultClientBuilder vault.ClientBuilder
-	vaultConfig        *config.VaultConfiguration
+	// newVaultClientBuilder returns a fresh builder for every login attempt, because builders keep the state of their options
+	newVaultClientBuilder func() vault.ClientBuilder
+	vaultConfig           *config.VaultConfiguration
+	registries            []config.RegistryConfiguration
+	cacheKeyType          config.CacheKeyType
+	// tokenCache is nil if tokens should not be cached between invocations
+	tokenCache tokenCache.TokenCache
+	// vaultClientCache is nil if clients should not be reused, it is only used together with the token cache
+	vaultClientCache *VaultClientCache
+	// vaultClient is the client of the last fetch, its token is revoked on cleanup (and its connections closed if it is not cached)
+	vaultClient vault.Client
+	// vaultClientCacheKey is the key of the client of the last fetch in the client cache (empty if it is not cached)
+	vaultClientCacheKey string
 }
 
-func NewVaultCredentialFetcher(vaultClientBuilder vault.ClientBuilder, vaultConfig *config.VaultConfiguration) CredentialFetcher {
+func NewVaultCredentialFetcher(newVaultClientBuilder func() vault.ClientBuilder, vaultConfig *config.VaultConfiguration, registries []config.RegistryConfiguration, cacheKeyType config.CacheKeyType, tokenCache tokenCache.TokenCache, vaultClientCache *VaultClientCache) CredentialFetcher {
 	return &VaultCredentialFetcher{
-		vaultClientBuilder: vaultClientBuilder,
-		vaultConfig:        vaultConfig,
+		newVaultClientBuilder: newVaultClientBuilder,
+		vaultConfig:           vaultConfig,
+		registries:            registries,
+		cacheKeyType:          cacheKeyType,
+		tokenCache:            tokenCache,
+		vaultClientCache:      vaultClientCache,
 	}
 }
 
-func (f *VaultCredentialFetcher) Fetch(ctx context.Context, request *credentialproviderV1.CredentialProviderRequest) (*credentialproviderV1.AuthConfig, error) {
-	// get service account token from request
-	serviceAccountToken := request.ServiceAccountToken
-	if serviceAccountToken == "" {
-		return nil, fmt.Errorf("service account token is required")
+func (f *VaultCredentialFetcher) Fetch(ctx context.Context, log logger.Logger, request *credentialproviderV1.CredentialProviderRequest) (*Credentials, error) {
+	// apply overrides of the registry the image is routed to
+	registry, authChain, secretConfig, err := f.resolveRegistry(ctx, log, request.Image)
+	if err != nil {
+		return nil, err
+	}
+
+	// apply overrides from service account annotations (only for allowed settings)
+	authChain, secretConfig = f.applyServiceAccountAnnotations(ctx, log, authChain, secretConfig, request.ServiceAccountAnnotations)
+
+	// render secret mount and path templates for the requested image and service account
+	if isTemplate(secretConfig.Mount) || isTemplate(secretConfig.Path) {
+		templateData, err := newSecretTemplateData(request.Image, request.ServiceAccountToken)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve secret template variables: %w", err)
+		}
+		secretConfig, err = renderSecretConfig(secretConfig, templateData)
+		if err != nil {
+			return nil, err
+		}
+		log.Log(ctx, slog.LevelDebug, "Rendered vault secret templates", "mount", secretConfig.Mount, "path", secretConfig.Path)
+	}
+
+	// resolve vault namespace (may depend on the kubernetes namespace of the service account)
+	namespace, err := f.resolveNamespace(request.ServiceAccountToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve vault namespace: %w", err)
+	}
+	if namespace != "" {
+		log.Log(ctx, slog.LevelDebug, "Using vault namespace", "namespace", namespace)
 	}
 
-	// setup vault client
-	vaultClient, err := f.setupVaultClient(ctx, serviceAccountToken)
+	// setup vault client (service account token may be empty, e.g. for auth methods that use a node identity)
+	vaultClient, err := f.setupVaultClient(ctx, log, authChain, namespace, request.ServiceAccountToken)
 	if err != nil {
 		return nil, fmt.Errorf("failed to setup vault client: %w", err)
 	}
+	f.vaultClient = vaultClient
 
-	// read auth config from vault
-	authConfig, err := f.readAuthConfig(ctx, vaultClient)
+	// read credentials from vault
+	credentials, err := f.readCredentials(ctx, log, vaultClient, &secretConfig, request.Image)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read auth config from vault: %w", err)
+		// a reused client may have lost its token (e.g. it was revoked), so the next fetch authenticates again
+		if f.vaultClientCacheKey != "" && !IsNoCredentials(err) {
+			f.vaultClientCache.Delete(f.vaultClientCacheKey)
+		}
+		return nil, fmt.Errorf("failed to read credentials from vault: %w", err)
+	}
+
+	credentials.CacheKeyType = f.cacheKeyType
+	if registry != nil {
+		if registry.CacheKeyType != "" {
+			credentials.CacheKeyType = registry.CacheKeyType
+		}
+		credentials.Aliases = registry.Aliases
+	}
+
+	return credentials, nil
+}
+
+func (f *VaultCredentialFetcher) Cleanup(ctx context.Context, log logger.Logger) error {
+	if f.vaultClient == nil {
+		return nil
+	}
+	vaultClient := f.vaultClient
+	f.vaultClient = nil
+	if f.vaultClientCacheKey == "" {
+		// the client is not reused, so its connections are not kept open (e.g. in the daemon)
+		defer vaultClient.CloseIdleConnections()
+	}
+	if !f.vaultConfig.RevokeToken.Enabled {
+		return nil
+	}
+
+	// revocation must not delay the shutdown, the token expires anyway if it fails
+	ctx, cancel := context.WithTimeout(ctx, f.vaultConfig.RevokeToken.Timeout)
+	defer cancel()
+	if err := vaultClient.RevokeToken(ctx); err != nil {
+		return fmt.Errorf("failed to revoke vault token: %w", err)
+	}
+	log.Log(ctx, slog.LevelDebug, "Revoked vault token")
+	return nil
+}
+
+// resolveRegistry returns the first registry matching the image (nil if none matches) and copies of the auth chain
+// and secret configuration with its overrides applied. Images without matching registry use the vault configuration,
+// if it contains a secret.
+func (f *VaultCredentialFetcher) resolveRegistry(ctx context.Context, log logger.Logger, image string) (*config.RegistryConfiguration, []config.VaultAuthConfiguration, config.VaultSecretConfiguration, error) {
+	authChain := slices.Clone(f.vaultConfig.Auth)
+	secretConfig := f.vaultConfig.Secret
+
+	for i := range f.registries {
+		registry := &f.registries[i]
+		matched, err := matchRegistry(registry, image)
+		if err != nil {
+			return nil, nil, secretConfig, fmt.Errorf("failed to match image against registries[%d]: %w", i, err)
+		}
+		if !matched {
+			continue
+		}
+		if registry.Role != "" {
+			setAuthRole(authChain, registry.Role)
+		}
+		log.Log(ctx, slog.LevelDebug, "Image matches registry", "registry", i)
+		return registry, authChain, registry.ApplySecret(secretConfig), nil
+	}
+
+	if len(f.registries) > 0 && (secretConfig.Mount == "" || secretConfig.Path == "") {
+		return nil, nil, secretConfig, fmt.Errorf("%w %s", ErrNoRegistryMatch, image)
+	}
+	return nil, authChain, secretConfig, nil
+}
+
+func matchRegistry(registry *config.RegistryConfiguration, image string) (bool, error) {
+	for _, pattern := range registry.MatchImages {
+		matched, err := imageReference.MatchImage(pattern, image)
+		if err != nil || matched {
+			return matched, err
+		}
+	}
+	return false, nil
+}
+
+// setAuthRole sets the role of the auth methods that authenticate the service account itself,
+// node identities (e.g. approle, cert, aws) must not be selectable per image or workload
+func setAuthRole(authChain []config.VaultAuthConfiguration, role string) {
+	for i := range authChain {
+		if authChain[i].Method == config.VaultAuthMethodKubernetes || authChain[i].Method == config.VaultAuthMethodJWT {
+			authChain[i].Role = role
+		}
+	}
+}
+
+// applyServiceAccountAnnotations returns the auth chain and secret configuration
+// with the overrides of the service account annotations applied
+func (f *VaultCredentialFetcher) applyServiceAccountAnnotations(ctx context.Context, log logger.Logger, authChain []config.VaultAuthConfiguration, secretConfig config.VaultSecretConfiguration, annotations map[string]string) ([]config.VaultAuthConfiguration, config.VaultSecretConfiguration) {
+	for key, value := range annotations {
+		override, ok := strings.CutPrefix(key, ServiceAccountAnnotationPrefix)
+		if !ok || value == "" {
+			continue
+		}
+		if !slices.Contains(f.vaultConfig.ServiceAccountAnnotationOverrides, config.ServiceAccountAnnotationOverride(override)) {
+			log.Log(ctx, slog.LevelWarn, "Ignoring service account annotation because override is not allowed", "annotation", key)
+			continue
+		}
+
+		switch config.ServiceAccountAnnotationOverride(override) {
+		case config.ServiceAccountAnnotationOverrideRole:
+			setAuthRole(authChain, value)
+		case config.ServiceAccountAnnotationOverrideSecretMount:
+			secretConfig.Mount = value
+		case config.ServiceAccountAnnotationOverrideSecretPath:
+			secretConfig.Path = value
+		}
+		log.Log(ctx, slog.LevelDebug, "Applied service account annotation override", "annotation", key, "value", value)
+	}
+
+	return authChain, secretConfig
+}
+
+// resolveNamespace returns the configured vault namespace, joined with the child namespace
+// the kubernetes namespace of the service account is mapped to (if any)
+func (f *VaultCredentialFetcher) resolveNamespace(token string) (string, error) {
+	if len(f.vaultConfig.NamespaceMapping) == 0 || token == "" {
+		return f.vaultConfig.Namespace, nil
+	}
+
+	claims, err := serviceAccountToken.ParseClaims(token)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse service account token claims: %w", err)
+	}
+	childNamespace, ok := f.vaultConfig.NamespaceMapping[claims.Kubernetes.Namespace]
+	if !ok {
+		return f.vaultConfig.Namespace, nil
+	}
+	return path.Join(f.vaultConfig.Namespace, childNamespace), nil
+}
+
+func (f *VaultCredentialFetcher) setupVaultClient(ctx context.Context, log logger.Logger, authChain []config.VaultAuthConfiguration, namespace string, serviceAccountToken string) (vault.Client, error) {
+	// try the configured auth methods in order, the first successful login wins
+	f.vaultClientCacheKey = ""
+	var errs []error
+	for i, auth := range authChain {
+		vaultClient, err := f.setupVaultClientWithCache(ctx, log, &auth, namespace, serviceAccountToken)
+		if err == nil {
+			log.Log(ctx, slog.LevelDebug, "Authenticated with vault", "method", auth.Method, "index", i)
+			return vaultClient, nil
+		}
+		log.Log(ctx, slog.LevelInfo, "Failed to authenticate with vault auth method", "method", auth.Method, "index", i, "error", err)
+		errs = append(errs, fmt.Errorf("%s: %w", auth.Method, err))
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("no vault auth method configured")
+	}
+	return nil, errors.Join(errs...)
+}
+
+// setupVaultClientWithCache reuses the token of a previous invocation for auth methods that log in,
+// otherwise it logs in and caches the new token
+func (f *VaultCredentialFetcher) setupVaultClientWithCache(ctx context.Context, log logger.Logger, auth *config.VaultAuthConfiguration, namespace string, serviceAccountToken string) (vault.Client, error) {
+	if f.tokenCache == nil || !loginCreatesToken(auth.Method) {
+		return f.setupVaultClientWithAuth(ctx, log, auth, namespace, serviceAccountToken)
+	}
+
+	cacheKey, err := f.tokenCacheKey(auth, namespace, serviceAccountToken)
+	if err != nil {
+		log.Log(ctx, slog.LevelWarn, "Not using token cache", "method", auth.Method, "error", err)
+		return f.setupVaultClientWithAuth(ctx, log, auth, namespace, serviceAccountToken)
+	}
+	if f.vaultClientCache != nil {
+		if vaultClient := f.vaultClientCache.Get(cacheKey, time.Now(), f.vaultConfig.TokenCache.RenewBefore); vaultClient != nil {
+			log.Log(ctx, slog.LevelDebug, "Reusing vault client")
+			f.vaultClientCacheKey = cacheKey
+			return vaultClient, nil
+		}
+	}
+	if vaultClient := f.cachedVaultClient(ctx, log, cacheKey, namespace); vaultClient != nil {
+		f.keepVaultClient(cacheKey, vaultClient)
+		return vaultClient, nil
+	}
+
+	vaultClient, err := f.setupVaultClientWithAuth(ctx, log, auth, namespace, serviceAccountToken)
+	if err != nil {
+		return nil, err
+	}
+	f.cacheToken(ctx, log, cacheKey, vaultClient.Token())
+	f.keepVaultClient(cacheKey, vaultClient)
+	return vaultClient, nil
+}
+
+// keepVaultClient adds the client to the client cache (if any), it is reused until its cached token is about to expire
+func (f *VaultCredentialFetcher) keepVaultClient(cacheKey string, vaultClient vault.Client) {
+	if f.vaultClientCache == nil {
+		return
+	}
+	entry, err := f.tokenCache.Get(cacheKey)
+	if err != nil || entry == nil || entry.Token != vaultClient.Token().Token {
+		// the token was not cached, so its expiry is unknown
+		return
+	}
+	f.vaultClientCache.Set(cacheKey, vaultClient, entry.ExpireTime, time.Now())
+	f.vaultClientCacheKey = cacheKey
+}
+
+// cachedVaultClient returns a client authenticated with the cached token or nil if a new login is needed
+func (f *VaultCredentialFetcher) cachedVaultClient(ctx context.Context, log logger.Logger, cacheKey string, namespace string) vault.Client {
+	entry, err := f.tokenCache.Get(cacheKey)
+	if err != nil {
+		log.Log(ctx, slog.LevelWarn, "Failed to read vault token from cache", "error", err)
+		return nil
+	}
+	if entry == nil {
+		return nil
+	}
+	expires := !entry.ExpireTime.IsZero()
+	if expires && entry.TTL(time.Now()) <= 0 {
+		log.Log(ctx, slog.LevelDebug, "Cached vault token is expired")
+		return nil
+	}
+
+	// the token is looked up, so a token that was revoked in the meantime is not used
+	vaultClient, err := f.baseVaultClientBuilder(namespace).
+		WithTokenAuth(entry.Token, false, true, 0).
+		Build(ctx)
+	if err != nil {
+		log.Log(ctx, slog.LevelInfo, "Failed to use cached vault token", "error", err)
+		return nil
+	}
+	if !expires || entry.TTL(time.Now()) > f.vaultConfig.TokenCache.RenewBefore {
+		log.Log(ctx, slog.LevelDebug, "Using cached vault token", "expireTime", entry.ExpireTime)
+		return vaultClient
+	}
+
+	// token is near its expiry, renew it if possible, otherwise log in again
+	if !entry.Renewable {
+		log.Log(ctx, slog.LevelDebug, "Cached vault token is about to expire and not renewable")
+		return nil
+	}
+	tokenInfo, err := vaultClient.RenewToken(ctx)
+	if err != nil {
+		log.Log(ctx, slog.LevelInfo, "Failed to renew cached vault token", "error", err)
+		return nil
+	}
+	if tokenInfo.TTL <= f.vaultConfig.TokenCache.RenewBefore {
+		// max ttl of the token is reached
+		log.Log(ctx, slog.LevelDebug, "Renewed vault token is about to expire", "ttl", tokenInfo.TTL)
+		return nil
+	}
+	f.cacheToken(ctx, log, cacheKey, tokenInfo)
+	log.Log(ctx, slog.LevelDebug, "Renewed cached vault token", "ttl", tokenInfo.TTL)
+	return vaultClient
+}
+
+func (f *VaultCredentialFetcher) cacheToken(ctx context.Context, log logger.Logger, cacheKey string, tokenInfo vault.TokenInfo) {
+	if tokenInfo.Token == "" {
+		return
 	}
+	entry := &tokenCache.Entry{
+		Token:      tokenInfo.Token,
+		ExpireTime: tokenInfo.ExpireTime,
+		Renewable:  tokenInfo.Renewable,
+	}
+	// a failing cache must not fail the request, the next invocation simply logs in again
+	if err := f.tokenCache.Set(cacheKey, entry); err != nil {
+		log.Log(ctx, slog.LevelWarn, "Failed to write vault token to cache", "error", err)
+	}
+}
+
+// tokenCacheKey identifies the token of a login, tokens of service account based auth methods are cached per service account token
+func (f *VaultCredentialFetcher) tokenCacheKey(auth *config.VaultAuthConfiguration, namespace string, token string) (string, error) {
+	identity := ""
+	switch auth.Method {
+	case config.VaultAuthMethodKubernetes, config.VaultAuthMethodJWT:
+		if token == "" {
+			return "", fmt.Errorf("service account token is required")
+		}
+		// the claims are not verified by the plugin, so the token itself is the identity
+		// (otherwise a forged token with the claims of another service account would get its vault token)
+		identity = tokenHash(token)
+	case config.VaultAuthMethodAppRole:
+		identity = auth.AppRole.RoleIDFile
+	case config.VaultAuthMethodCert:
+		identity = auth.Cert.CertFile
+	}
+	return strings.Join([]string{f.vaultConfig.Address, namespace, string(auth.Method), auth.Mount, auth.Role, identity}, "|"), nil
+}
+
+// tokenHash identifies a token (e.g. a service account token or wrapping token) without keeping the token itself
+func tokenHash(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
 
-	return authConfig, nil
+// loginCreatesToken reports whether the auth method creates a new vault token on every login
+func loginCreatesToken(method config.VaultAuthMethod) bool {
+	return method != config.VaultAuthMethodToken && method != config.VaultAuthMethodAgent
 }
 
-func (f *VaultCredentialFetcher) setupVaultClient(ctx context.Context, serviceAccountToken string) (vault.Client, error) {
+func (f *VaultCredentialFetcher) setupVaultClientWithAuth(ctx context.Context, log logger.Logger, auth *config.VaultAuthConfiguration, namespace string, serviceAccountToken string) (vault.Client, error) {
 	// authenticate with vault
-	switch f.vaultConfig.Auth.Method {
+	switch auth.Method {
 	case config.VaultAuthMethodKubernetes:
 		// kubernetes auth method not possible when service account token is not provided
 		if serviceAccountToken == "" {
-			return nil, fmt.Errorf("service account token is required for kubernetes auth method")
+			return nil, fmt.Errorf("%w for kubernetes auth method", ErrServiceAccountTokenRequired)
 		}
 
 		// authenticate with kubernetes auth method
-		return f.vaultClientBuilder.
-			WithAddress(f.vaultConfig.Address).
-			InsecureSkipVerify(f.vaultConfig.InsecureSkipVerify).
-			WithKubernetesAuth(f.vaultConfig.Auth.Mount, f.vaultConfig.Auth.Role, serviceAccountToken).
+		return f.baseVaultClientBuilder(namespace).
+			WithKubernetesAuth(auth.Mount, auth.Role, serviceAccountToken).
+			Build(ctx)
+	case config.VaultAuthMethodJWT:
+		// jwt auth method not possible when service account token is not provided
+		if serviceAccountToken == "" {
+			return nil, fmt.Errorf("%w for jwt auth method", ErrServiceAccountTokenRequired)
+		}
+
+		// authenticate with jwt auth method (service account token is validated by vault, e.g. against the cluster jwks)
+		return f.baseVaultClientBuilder(namespace).
+			WithJWTAuth(auth.Mount, auth.Role, serviceAccountToken).
+			Build(ctx)
+	case config.VaultAuthMethodAppRole:
+		// read approle credentials from the node (on every invocation, so rotated files are picked up)
+		roleID, err := helpers.ReadTrimmedFile(auth.AppRole.RoleIDFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read approle role id: %w", err)
+		}
+		secretID, err := helpers.ReadTrimmedFile(auth.AppRole.SecretIDFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read approle secret id: %w", err)
+		}
+
+		// a wrapping token can only be unwrapped once, but the secret id is needed for every login
+		vaultClientBuilder := f.baseVaultClientBuilder(namespace)
+		if auth.AppRole.SecretIDWrapped {
+			if f.tokenCache == nil {
+				return nil, fmt.Errorf("token cache is required for wrapped secret ids, because they can only be unwrapped once")
+			}
+			vaultClientBuilder = vaultClientBuilder.WithUnwrapCache(f.newUnwrapCache(ctx, log, auth, namespace, auth.AppRole.SecretIDFile))
+		}
+
+		// authenticate with approle auth method
+		return vaultClientBuilder.
+			WithAppRoleAuth(auth.Mount, roleID, secretID, auth.AppRole.SecretIDWrapped).
+			Build(ctx)
+	case config.VaultAuthMethodCert:
+		// authenticate with cert auth method (client certificate is read by the vault client)
+		return f.baseVaultClientBuilder(namespace).
+			WithCertAuth(auth.Mount, auth.Role, auth.Cert.CertFile, auth.Cert.KeyFile).
+			Build(ctx)
+	case config.VaultAuthMethodToken:
+		// read token from file (e.g. a vault agent sink) or fall back to the environment
+		token, wrapped, err := readToken(&auth.Token)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token: %w", err)
+		}
+
+		// a wrapping token can only be unwrapped once, but is read by every invocation until the sink is rewritten
+		vaultClientBuilder := f.baseVaultClientBuilder(namespace)
+		if wrapped {
+			if f.tokenCache == nil {
+				return nil, fmt.Errorf("token cache is required for wrapped tokens, because they can only be unwrapped once")
+			}
+			vaultClientBuilder = vaultClientBuilder.WithUnwrapCache(f.newUnwrapCache(ctx, log, auth, namespace, auth.Token.File))
+		}
+
+		// authenticate with existing token
+		return vaultClientBuilder.
+			WithTokenAuth(token, wrapped, auth.Token.LookupSelf, auth.Token.MinTTL).
+			Build(ctx)
+	case config.VaultAuthMethodAgent:
+		// rely on a local vault agent / proxy to authenticate the requests
+		return f.baseVaultClientBuilder(namespace).
+			WithAgentAuth().
+			Build(ctx)
+	case config.VaultAuthMethodAWS:
+		// authenticate with aws auth method (iam type) using the instance credentials of the node
+		return f.baseVaultClientBuilder(namespace).
+			WithAWSAuth(auth.Mount, auth.Role, auth.AWS.Region, auth.AWS.STSEndpoint, auth.AWS.HeaderValue).
 			Build(ctx)
 	default:
-		return nil, fmt.Errorf("unsupported vault auth method: %s", f.vaultConfig.Auth.Method)
+		return nil, fmt.Errorf("unsupported vault auth method: %s", auth.Method)
+	}
+}
+
+// readToken returns the token and whether it is a wrapping token (configured or detected from the sink content)
+func readToken(tokenConfig *config.VaultTokenAuthConfiguration) (string, bool, error) {
+	if tokenConfig.File == "" {
+		token := os.Getenv("VAULT_TOKEN")
+		if token == "" {
+			return "", false, fmt.Errorf("neither token file nor VAULT_TOKEN is set")
+		}
+		return token, tokenConfig.Wrapped, nil
+	}
+
+	content, err := helpers.ReadTrimmedFile(tokenConfig.File)
+	if err != nil {
+		return "", false, err
+	}
+	token, wrapInfo, err := parseTokenSinkContent(content)
+	if err != nil {
+		return "", false, err
 	}
+	return token, tokenConfig.Wrapped || wrapInfo, nil
 }
 
-func (f *VaultCredentialFetcher) readAuthConfig(ctx context.Context, vaultClient vault.Client) (*credentialproviderV1.AuthConfig, error) {
-	// read vault secret
-	secretData, err := vaultClient.Secrets().KvV2(f.vaultConfig.Secret.Mount, f.vaultConfig.Secret.Path).Read(ctx)
+// parseTokenSinkContent extracts the token from the content of a vault agent file sink.
+// Plain sinks contain the token itself, sinks with wrap_ttl contain the json encoded wrap info of a wrapping token.
+func parseTokenSinkContent(content string) (string, bool, error) {
+	if !strings.HasPrefix(content, "{") {
+		return content, false, nil
+	}
+
+	var wrapInfo struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal([]byte(content), &wrapInfo); err != nil {
+		return "", false, fmt.Errorf("failed to unmarshal wrapped token: %w", err)
+	}
+	if wrapInfo.Token == "" {
+		return "", false, fmt.Errorf("wrapped token does not contain a token")
+	}
+	return wrapInfo.Token, true, nil
+}
+
+func (f *VaultCredentialFetcher) baseVaultClientBuilder(namespace string) vault.ClientBuilder {
+	return f.newVaultClientBuilder().
+		WithAddress(f.vaultConfig.Address).
+		InsecureSkipVerify(f.vaultConfig.InsecureSkipVerify).
+		WithCACert(f.vaultConfig.CACert).
+		WithTLSServerName(f.vaultConfig.TLSServerName).
+		WithNamespace(namespace)
+}
+
+func (f *VaultCredentialFetcher) readCredentials(ctx context.Context, log logger.Logger, vaultClient vault.Client, secretConfig *config.VaultSecretConfiguration, image string) (*Credentials, error) {
+	secret, err := readSecret(ctx, log, vaultClient, secretConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := parseCredentials(secret.Data, secretConfig, image)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials.CacheDuration, err = f.cacheDuration(ctx, log, vaultClient, secretConfig, secret, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine cache duration: %w", err)
+	}
+	return credentials, nil
+}
+
+func readSecret(ctx context.Context, log logger.Logger, vaultClient vault.Client, secretConfig *config.VaultSecretConfiguration) (*vault.Secret, error) {
+	var secret *vault.Secret
+	var err error
+	switch secretConfig.Engine {
+	case config.VaultSecretEngineKvV1:
+		var secretData map[string]any
+		secretData, err = vaultClient.Secrets().KvV1(secretConfig.Mount, secretConfig.Path).Read(ctx)
+		secret = &vault.Secret{Data: secretData}
+	case config.VaultSecretEngineKvV2:
+		var secretData map[string]any
+		secretData, err = readKvV2Secret(ctx, log, vaultClient, secretConfig)
+		secret = &vault.Secret{Data: secretData}
+	case config.VaultSecretEngineGeneric:
+		secret, err = vaultClient.Secrets().Generic(secretConfig.Mount, secretConfig.Path).Read(ctx)
+	default:
+		return nil, fmt.Errorf("unsupported vault secret engine: %s", secretConfig.Engine)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to read secret from vault: %w", err)
 	}
+	return secret, nil
+}
 
-	username, ok := secretData["username"].(string)
-	if !ok {
-		return nil, fmt.Errorf("failed to read username from secret data")
+func parseCredentials(secretData map[string]any, secretConfig *config.VaultSecretConfiguration, image string) (*Credentials, error) {
+	switch secretConfig.Format {
+	case config.VaultSecretFormatFields:
+		authConfig, err := parseAuthConfig(secretData, &secretConfig.Fields)
+		if err != nil {
+			return nil, err
+		}
+		return &Credentials{AuthConfig: authConfig}, nil
+	case config.VaultSecretFormatJQ:
+		authConfig, err := parseAuthConfigJQ(secretData, &secretConfig.JQ)
+		if err != nil {
+			return nil, err
+		}
+		return &Credentials{AuthConfig: authConfig}, nil
+	case config.VaultSecretFormatDockerConfigJSON:
+		auth, err := parseDockerConfig(secretData, secretConfig.DockerConfigJSON.Field)
+		if err != nil {
+			return nil, err
+		}
+		if secretConfig.DockerConfigJSON.AllRegistries {
+			return &Credentials{Auth: auth}, nil
+		}
+		registry, ok := matchDockerConfig(auth, image)
+		if !ok {
+			return nil, fmt.Errorf("docker config does not contain credentials for image %s", image)
+		}
+		return &Credentials{Auth: map[string]credentialproviderV1.AuthConfig{registry: auth[registry]}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported vault secret format: %s", secretConfig.Format)
+	}
+}
+
+// cacheDuration returns how long the kubelet may cache the credentials, it is nil if the validity of the credentials
+// is unknown and no maximum is configured (the kubelet uses the defaultCacheDuration of the provider config then)
+func (f *VaultCredentialFetcher) cacheDuration(ctx context.Context, log logger.Logger, vaultClient vault.Client, secretConfig *config.VaultSecretConfiguration, secret *vault.Secret, now time.Time) (*time.Duration, error) {
+	cfg := &f.vaultConfig.CacheDuration
+
+	var validity []time.Duration
+	if secret.LeaseDuration > 0 {
+		validity = append(validity, secret.LeaseDuration)
+		// leases are revoked together with the token that created them (the expire time is also correct for reused tokens)
+		if expireTime := vaultClient.Token().ExpireTime; !expireTime.IsZero() {
+			validity = append(validity, expireTime.Sub(now))
+		}
 	}
-	password, ok := secretData["password"].(string)
+	if cfg.ExpiresAtKey != "" {
+		expiresAt, err := secretExpiresAt(ctx, log, vaultClient, secretConfig, secret.Data, cfg.ExpiresAtKey)
+		if err != nil {
+			return nil, err
+		}
+		if !expiresAt.IsZero() {
+			validity = append(validity, expiresAt.Sub(now))
+		}
+	}
+
+	if len(validity) == 0 {
+		if cfg.Max > 0 {
+			return &cfg.Max, nil
+		}
+		return nil, nil
+	}
+	duration := max(slices.Min(validity)-cfg.Margin, cfg.Min, 0)
+	if cfg.Max > 0 {
+		duration = min(duration, cfg.Max)
+	}
+	return &duration, nil
+}
+
+// secretExpiresAt returns the expiry of the secret from the field of the secret data or the kv v2 custom metadata,
+// it is zero if the secret does not contain an expiry or the metadata can not be read
+func secretExpiresAt(ctx context.Context, log logger.Logger, vaultClient vault.Client, secretConfig *config.VaultSecretConfiguration, secretData map[string]any, key string) (time.Time, error) {
+	value := lookupSecretField(secretData, key)
+	if value == nil && secretConfig.Engine == config.VaultSecretEngineKvV2 {
+		// the credentials are already read, so a missing permission for the metadata (e.g. policies that only grant data/)
+		// must not fail the request
+		metadata, err := vaultClient.Secrets().KvV2(secretConfig.Mount, secretConfig.Path).ReadMetadata(ctx)
+		if err != nil {
+			log.Log(ctx, slog.LevelWarn, "Failed to read secret metadata, the expiry of the secret is unknown", "error", err)
+			return time.Time{}, nil
+		}
+		if customMetadata, ok := metadata.CustomMetadata[key]; ok {
+			value = customMetadata
+		}
+	}
+	if value == nil {
+		return time.Time{}, nil
+	}
+
+	expiresAt, ok := value.(string)
 	if !ok {
-		return nil, fmt.Errorf("failed to read password from secret data")
+		return time.Time{}, fmt.Errorf("%s of secret is not a RFC 3339 timestamp", key)
+	}
+	parsed, err := time.Parse(time.RFC3339, expiresAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse %s of secret: %w", key, err)
+	}
+	return parsed, nil
+}
+
+// readKvV2Secret reads the configured version of the secret and falls back to the previous available version
+// if the version is deleted or destroyed (and the fallback is enabled)
+func readKvV2Secret(ctx context.Context, log logger.Logger, vaultClient vault.Client, secretConfig *config.VaultSecretConfiguration) (map[string]any, error) {
+	kvV2Client := vaultClient.Secrets().KvV2(secretConfig.Mount, secretConfig.Path)
+	secretData, err := kvV2Client.Read(ctx, secretConfig.Version)
+	if err == nil || !secretConfig.FallbackToPreviousVersion || !errors.Is(err, vault.ErrSecretVersionNotFound) {
+		return secretData, err
+	}
+
+	metadata, metadataErr := kvV2Client.ReadMetadata(ctx)
+	if metadataErr != nil {
+		return nil, errors.Join(err, metadataErr)
+	}
+	version := secretConfig.Version
+	if version == 0 {
+		version = metadata.CurrentVersion
+	}
+	// available versions are sorted, so the last version below the requested one is the previous version
+	previousVersion := 0
+	for _, v := range metadata.AvailableVersions {
+		if v < version {
+			previousVersion = v
+		}
+	}
+	if previousVersion == 0 {
+		return nil, fmt.Errorf("no previous secret version of version %d available: %w", version, err)
 	}
 
-	return &credentialproviderV1.AuthConfig{
-		Username: username,
-		Password: password,
-	}, nil
+	log.Log(ctx, slog.LevelWarn, "Secret version not found, falling back to previous version", "version", version, "previousVersion", previousVersion)
+	return kvV2Client.Read(ctx, previousVersion)
 }
@@ -1,23 +1,34 @@
 package credentialFetcher
 
 import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
 	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/config"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/logger"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/tokenCache"
 	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/vault"
 	credentialproviderV1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
 )
 
-func TestReadAuthConfig(t *testing.T) {
+func TestReadCredentials(t *testing.T) {
 	tests := []struct {
 		name            string
+		engine          config.VaultSecretEngine
 		vaultSecretData map[string]any
 		want            *credentialproviderV1.AuthConfig
 		wantErrMsg      string
 	}{
 		{
-			name: "successful read",
+			name:   "successful read",
+			engine: config.VaultSecretEngineKvV2,
 			vaultSecretData: map[string]any{
 				"username": "username",
 				"password": "password",
@@ -29,7 +40,8 @@ func TestReadAuthConfig(t *testing.T) {
 			wantErrMsg: "",
 		},
 		{
-			name: "missing username",
+			name:   "missing username",
+			engine: config.VaultSecretEngineKvV2,
 			vaultSecretData: map[string]any{
 				"password": "password",
 			},
@@ -37,7 +49,8 @@ func TestReadAuthConfig(t *testing.T) {
 			wantErrMsg: "failed to read username from secret data",
 		},
 		{
-			name: "missing password",
+			name:   "missing password",
+			engine: config.VaultSecretEngineKvV2,
 			vaultSecretData: map[string]any{
 				"username": "username",
 			},
@@ -46,10 +59,47 @@ func TestReadAuthConfig(t *testing.T) {
 		},
 		{
 			name:            "empty vault secret data",
+			engine:          config.VaultSecretEngineKvV2,
 			vaultSecretData: map[string]any{},
 			want:            nil,
 			wantErrMsg:      "failed to read username from secret data",
 		},
+		{
+			name:   "successful generic read",
+			engine: config.VaultSecretEngineGeneric,
+			vaultSecretData: map[string]any{
+				"username": "username",
+				"password": "password",
+			},
+			want: &credentialproviderV1.AuthConfig{
+				Username: "username",
+				Password: "password",
+			},
+			wantErrMsg: "",
+		},
+		{
+			name:   "successful kv v1 read",
+			engine: config.VaultSecretEngineKvV1,
+			vaultSecretData: map[string]any{
+				"username": "username",
+				"password": "password",
+			},
+			want: &credentialproviderV1.AuthConfig{
+				Username: "username",
+				Password: "password",
+			},
+			wantErrMsg: "",
+		},
+		{
+			name:   "unsupported secret engine",
+			engine: "database",
+			vaultSecretData: map[string]any{
+				"username": "username",
+				"password": "password",
+			},
+			want:       nil,
+			wantErrMsg: "unsupported vault secret engine: database",
+		},
 	}
 
 	for _, tt := range tests {
@@ -59,17 +109,25 @@ func TestReadAuthConfig(t *testing.T) {
 				vaultConfig: &config.VaultConfiguration{
 					Address:            "http://localhost:8200",
 					InsecureSkipVerify: false,
-					Auth: config.VaultAuthConfiguration{
-						Method: config.VaultAuthMethodKubernetes,
-						Mount:  "kubernetes",
-						Role:   "example",
+					Auth: []config.VaultAuthConfiguration{
+						{
+							Method: config.VaultAuthMethodKubernetes,
+							Mount:  "kubernetes",
+							Role:   "example",
+						},
 					},
 					Secret: config.VaultSecretConfiguration{
-						Mount: "secret",
-						Path:  "example",
+						Engine: tt.engine,
+						Mount:  "secret",
+						Path:   "example",
+						Format: config.VaultSecretFormatFields,
+						Fields: config.VaultSecretFieldsConfiguration{
+							Username: "username",
+							Password: "password",
+						},
 					},
 				},
-				vaultClientBuilder: nil,
+				newVaultClientBuilder: nil,
 			}
 
 			// create vault client mock
@@ -77,13 +135,1212 @@ func TestReadAuthConfig(t *testing.T) {
 			if err != nil {
 				t.Fatalf("failed to create vault client: %v", err)
 			}
+			log, err := logger.NewFileLogger(false, "", "error")
+			if err != nil {
+				t.Fatalf("failed to create logger: %v", err)
+			}
+
+			got, err := fetcher.readCredentials(t.Context(), log, vaultClient, &fetcher.vaultConfig.Secret, "registry.example.com/my-image:latest")
+			if err != nil && err.Error() != tt.wantErrMsg {
+				t.Errorf("unexpected error: got %v, want %v", err, tt.wantErrMsg)
+			}
+			if got != nil && !reflect.DeepEqual(got.AuthConfig, tt.want) {
+				t.Errorf("unexpected auth config: got %v, want %v", got.AuthConfig, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheDuration(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	defaultConfig := config.VaultCacheDurationConfiguration{
+		ExpiresAtKey: "expires_at",
+		Margin:       time.Minute,
+	}
+
+	tests := []struct {
+		name            string
+		config          config.VaultCacheDurationConfiguration
+		engine          config.VaultSecretEngine
+		secretData      map[string]any
+		leaseDuration   time.Duration
+		tokenTTL        time.Duration
+		tokenExpireTime time.Time
+		customMetadata  map[string]string
+		metadataError   error
+		want            *time.Duration
+		wantErrMsg      string
+	}{
+		{
+			name:       "unknown validity",
+			config:     defaultConfig,
+			engine:     config.VaultSecretEngineKvV1,
+			secretData: map[string]any{},
+			tokenTTL:   time.Hour,
+			want:       nil,
+			wantErrMsg: "",
+		},
+		{
+			name:       "unknown validity with max",
+			config:     config.VaultCacheDurationConfiguration{Margin: time.Minute, Max: 12 * time.Hour},
+			engine:     config.VaultSecretEngineKvV2,
+			secretData: map[string]any{},
+			want:       durationPtr(12 * time.Hour),
+			wantErrMsg: "",
+		},
+		{
+			name:          "lease duration",
+			config:        defaultConfig,
+			engine:        config.VaultSecretEngineGeneric,
+			secretData:    map[string]any{},
+			leaseDuration: 10 * time.Minute,
+			tokenTTL:      time.Hour,
+			want:          durationPtr(9 * time.Minute),
+			wantErrMsg:    "",
+		},
+		{
+			name:            "token ttl shorter than lease duration",
+			config:          defaultConfig,
+			engine:          config.VaultSecretEngineGeneric,
+			secretData:      map[string]any{},
+			leaseDuration:   time.Hour,
+			tokenTTL:        10 * time.Minute,
+			tokenExpireTime: now.Add(10 * time.Minute),
+			want:            durationPtr(9 * time.Minute),
+			wantErrMsg:      "",
+		},
+		{
+			name:            "reused client with token created earlier",
+			config:          defaultConfig,
+			engine:          config.VaultSecretEngineGeneric,
+			secretData:      map[string]any{},
+			leaseDuration:   time.Hour,
+			tokenTTL:        time.Hour,
+			tokenExpireTime: now.Add(10 * time.Minute),
+			want:            durationPtr(9 * time.Minute),
+			wantErrMsg:      "",
+		},
+		{
+			name:          "lease duration with token without ttl",
+			config:        defaultConfig,
+			engine:        config.VaultSecretEngineGeneric,
+			secretData:    map[string]any{},
+			leaseDuration: time.Hour,
+			tokenTTL:      0,
+			want:          durationPtr(59 * time.Minute),
+			wantErrMsg:    "",
+		},
+		{
+			name:       "expires at field",
+			config:     defaultConfig,
+			engine:     config.VaultSecretEngineKvV2,
+			secretData: map[string]any{"expires_at": "2025-01-01T00:30:00Z"},
+			want:       durationPtr(29 * time.Minute),
+			wantErrMsg: "",
+		},
+		{
+			name:           "expires at custom metadata",
+			config:         defaultConfig,
+			engine:         config.VaultSecretEngineKvV2,
+			secretData:     map[string]any{},
+			customMetadata: map[string]string{"expires_at": "2025-01-01T02:00:00+01:00"},
+			want:           durationPtr(59 * time.Minute),
+			wantErrMsg:     "",
+		},
+		{
+			name:          "expires at custom metadata without permission",
+			config:        defaultConfig,
+			engine:        config.VaultSecretEngineKvV2,
+			secretData:    map[string]any{},
+			metadataError: errors.New("permission denied"),
+			want:          nil,
+			wantErrMsg:    "",
+		},
+		{
+			name:       "margin exceeds validity",
+			config:     config.VaultCacheDurationConfiguration{ExpiresAtKey: "expires_at", Margin: time.Minute, Min: 10 * time.Second},
+			engine:     config.VaultSecretEngineKvV2,
+			secretData: map[string]any{"expires_at": "2025-01-01T00:00:30Z"},
+			want:       durationPtr(10 * time.Second),
+			wantErrMsg: "",
+		},
+		{
+			name:       "expired",
+			config:     defaultConfig,
+			engine:     config.VaultSecretEngineKvV2,
+			secretData: map[string]any{"expires_at": "2024-12-31T00:00:00Z"},
+			want:       durationPtr(0),
+			wantErrMsg: "",
+		},
+		{
+			name:       "max",
+			config:     config.VaultCacheDurationConfiguration{ExpiresAtKey: "expires_at", Margin: time.Minute, Max: time.Hour},
+			engine:     config.VaultSecretEngineKvV2,
+			secretData: map[string]any{"expires_at": "2025-02-01T00:00:00Z"},
+			want:       durationPtr(time.Hour),
+			wantErrMsg: "",
+		},
+		{
+			name:       "invalid expires at",
+			config:     defaultConfig,
+			engine:     config.VaultSecretEngineKvV2,
+			secretData: map[string]any{"expires_at": "tomorrow"},
+			want:       nil,
+			wantErrMsg: "failed to parse expires_at of secret: parsing time \"tomorrow\" as \"2006-01-02T15:04:05Z07:00\": cannot parse \"tomorrow\" as \"2006\"",
+		},
+		{
+			name:       "expires at is not a string",
+			config:     defaultConfig,
+			engine:     config.VaultSecretEngineKvV2,
+			secretData: map[string]any{"expires_at": 1735689600},
+			want:       nil,
+			wantErrMsg: "expires_at of secret is not a RFC 3339 timestamp",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetcher := VaultCredentialFetcher{
+				vaultConfig: &config.VaultConfiguration{
+					CacheDuration: tt.config,
+				},
+			}
+			vaultClient, err := vault.NewMockClientBuilder(tt.secretData).(*vault.MockClientBuilder).
+				WithMockSecretCustomMetadata(tt.customMetadata).
+				WithMockSecretMetadataError(tt.metadataError).
+				WithMockTokenTTL(tt.tokenTTL).
+				WithMockTokenExpireTime(tt.tokenExpireTime).
+				Build(t.Context())
+			if err != nil {
+				t.Fatalf("failed to build vault client: %v", err)
+			}
+			secret := &vault.Secret{Data: tt.secretData, LeaseDuration: tt.leaseDuration}
+
+			log, err := logger.NewFileLogger(false, "", "error")
+			if err != nil {
+				t.Fatalf("failed to create logger: %v", err)
+			}
+
+			got, err := fetcher.cacheDuration(t.Context(), log, vaultClient, &config.VaultSecretConfiguration{Engine: tt.engine}, secret, now)
+			if err != nil && err.Error() != tt.wantErrMsg {
+				t.Errorf("unexpected error: got %v, want %v", err, tt.wantErrMsg)
+			}
+			if err == nil && tt.wantErrMsg != "" {
+				t.Errorf("expected error: %v", tt.wantErrMsg)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unexpected cache duration: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func durationPtr(duration time.Duration) *time.Duration {
+	return &duration
+}
+
+func TestReadKvV2Secret(t *testing.T) {
+	secretVersions := map[int]map[string]any{
+		1: {"username": "v1"},
+		2: {"username": "v2"},
+		3: nil,
+		4: {"username": "v4"},
+		5: nil,
+	}
+
+	tests := []struct {
+		name                      string
+		secretVersions            map[int]map[string]any
+		version                   int
+		fallbackToPreviousVersion bool
+		want                      map[string]any
+		wantErrMsg                string
+	}{
+		{
+			name:           "latest version",
+			secretVersions: map[int]map[string]any{1: {"username": "v1"}, 2: {"username": "v2"}},
+			version:        0,
+			want:           map[string]any{"username": "v2"},
+			wantErrMsg:     "",
+		},
+		{
+			name:           "pinned version",
+			secretVersions: secretVersions,
+			version:        2,
+			want:           map[string]any{"username": "v2"},
+			wantErrMsg:     "",
+		},
+		{
+			name:           "deleted latest version without fallback",
+			secretVersions: secretVersions,
+			version:        0,
+			want:           nil,
+			wantErrMsg:     "failed to read secret: secret version not found",
+		},
+		{
+			name:                      "deleted latest version with fallback",
+			secretVersions:            secretVersions,
+			version:                   0,
+			fallbackToPreviousVersion: true,
+			want:                      map[string]any{"username": "v4"},
+			wantErrMsg:                "",
+		},
+		{
+			name:                      "deleted pinned version with fallback",
+			secretVersions:            secretVersions,
+			version:                   3,
+			fallbackToPreviousVersion: true,
+			want:                      map[string]any{"username": "v2"},
+			wantErrMsg:                "",
+		},
+		{
+			name:                      "no previous version",
+			secretVersions:            map[int]map[string]any{1: nil},
+			version:                   0,
+			fallbackToPreviousVersion: true,
+			want:                      nil,
+			wantErrMsg:                "no previous secret version of version 1 available: failed to read secret: secret version not found",
+		},
+		{
+			name:                      "secret does not exist with fallback",
+			secretVersions:            nil,
+			version:                   0,
+			fallbackToPreviousVersion: true,
+			want:                      nil,
+			wantErrMsg:                "failed to read secret: secret version not found\nfailed to read secret metadata: secret not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vaultClient, err := vault.NewMockClientBuilderWithSecretVersions(tt.secretVersions).Build(t.Context())
+			if err != nil {
+				t.Fatalf("failed to create vault client: %v", err)
+			}
+			log, err := logger.NewFileLogger(false, "", "error")
+			if err != nil {
+				t.Fatalf("failed to create logger: %v", err)
+			}
 
-			got, err := fetcher.readAuthConfig(t.Context(), vaultClient)
+			got, err := readKvV2Secret(t.Context(), log, vaultClient, &config.VaultSecretConfiguration{
+				Engine:                    config.VaultSecretEngineKvV2,
+				Mount:                     "secret",
+				Path:                      "example",
+				Version:                   tt.version,
+				FallbackToPreviousVersion: tt.fallbackToPreviousVersion,
+			})
+			if err != nil && err.Error() != tt.wantErrMsg {
+				t.Errorf("unexpected error: got %v, want %v", err, tt.wantErrMsg)
+			}
+			if err == nil && tt.wantErrMsg != "" {
+				t.Errorf("expected error: %v", tt.wantErrMsg)
+			}
+			// missing secrets and versions are answered without credentials in graceful mode
+			if err != nil && !IsNoCredentials(err) {
+				t.Errorf("error is not caused by missing credentials: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unexpected secret data: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetupVaultClient(t *testing.T) {
+	kubernetesAuth := config.VaultAuthConfiguration{
+		Method: config.VaultAuthMethodKubernetes,
+		Mount:  "kubernetes",
+		Role:   "example",
+	}
+	jwtAuth := config.VaultAuthConfiguration{
+		Method: config.VaultAuthMethodJWT,
+		Mount:  "oidc",
+		Role:   "puller",
+	}
+	agentAuth := config.VaultAuthConfiguration{
+		Method: config.VaultAuthMethodAgent,
+	}
+
+	tests := []struct {
+		name                string
+		auth                []config.VaultAuthConfiguration
+		serviceAccountToken string
+		loginErr            error
+		wantLogin           vault.MockLogin
+		wantErrMsg          string
+	}{
+		{
+			name:                "single auth method",
+			auth:                []config.VaultAuthConfiguration{kubernetesAuth},
+			serviceAccountToken: "token",
+			wantLogin:           vault.MockLogin{Method: vault.HashiCorpClientAuthMethodKubernetes, Mount: "kubernetes", Role: "example", ServiceAccountToken: "token"},
+			wantErrMsg:          "",
+		},
+		{
+			name:                "jwt auth method",
+			auth:                []config.VaultAuthConfiguration{jwtAuth},
+			serviceAccountToken: "token",
+			wantLogin:           vault.MockLogin{Method: vault.HashiCorpClientAuthMethodJWT, Mount: "oidc", Role: "puller", ServiceAccountToken: "token"},
+			wantErrMsg:          "",
+		},
+		{
+			name:                "jwt auth method without service account token",
+			auth:                []config.VaultAuthConfiguration{jwtAuth},
+			serviceAccountToken: "",
+			wantErrMsg:          "jwt: service account token is required for jwt auth method",
+		},
+		{
+			name:                "single auth method without service account token",
+			auth:                []config.VaultAuthConfiguration{kubernetesAuth},
+			serviceAccountToken: "",
+			wantErrMsg:          "kubernetes: service account token is required for kubernetes auth method",
+		},
+		{
+			name:                "fallback to next auth method",
+			auth:                []config.VaultAuthConfiguration{kubernetesAuth, agentAuth},
+			serviceAccountToken: "",
+			wantLogin:           vault.MockLogin{Method: vault.HashiCorpClientAuthMethodAgent},
+			wantErrMsg:          "",
+		},
+		{
+			name:                "fallback to next auth method after failed login",
+			auth:                []config.VaultAuthConfiguration{jwtAuth, kubernetesAuth},
+			serviceAccountToken: "token",
+			loginErr:            errors.New("permission denied"),
+			wantLogin:           vault.MockLogin{Method: vault.HashiCorpClientAuthMethodKubernetes, Mount: "kubernetes", Role: "example", ServiceAccountToken: "token"},
+			wantErrMsg:          "",
+		},
+		{
+			name:                "all auth methods failed",
+			auth:                []config.VaultAuthConfiguration{kubernetesAuth, jwtAuth},
+			serviceAccountToken: "",
+			wantErrMsg:          "kubernetes: service account token is required for kubernetes auth method\njwt: service account token is required for jwt auth method",
+		},
+		{
+			name:                "no auth method",
+			auth:                nil,
+			serviceAccountToken: "token",
+			wantErrMsg:          "no vault auth method configured",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetcher := VaultCredentialFetcher{
+				vaultConfig: &config.VaultConfiguration{
+					Address: "http://localhost:8200",
+					Auth:    tt.auth,
+				},
+				newVaultClientBuilder: func() vault.ClientBuilder {
+					return vault.NewMockClientBuilder(nil).(*vault.MockClientBuilder).WithMockLoginError(vault.HashiCorpClientAuthMethodJWT, tt.loginErr)
+				},
+			}
+			log, err := logger.NewFileLogger(false, "", "error")
+			if err != nil {
+				t.Fatalf("failed to create logger: %v", err)
+			}
+
+			vaultClient, err := fetcher.setupVaultClient(t.Context(), log, tt.auth, "", tt.serviceAccountToken)
+			if err != nil && err.Error() != tt.wantErrMsg {
+				t.Errorf("unexpected error: got %v, want %v", err, tt.wantErrMsg)
+			}
+			if err == nil && tt.wantErrMsg != "" {
+				t.Errorf("expected error: %v", tt.wantErrMsg)
+			}
+			if err == nil && vaultClient.(*vault.MockClient).Login() != tt.wantLogin {
+				t.Errorf("unexpected login: got %+v, want %+v", vaultClient.(*vault.MockClient).Login(), tt.wantLogin)
+			}
+		})
+	}
+}
+
+func TestSetupVaultClientWithCache(t *testing.T) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"kubernetes.io":{"namespace":"team-a","serviceaccount":{"name":"puller","uid":"1234"}}}`))
+	serviceAccountToken := header + "." + payload + ".signature"
+
+	kubernetesAuth := config.VaultAuthConfiguration{
+		Method: config.VaultAuthMethodKubernetes,
+		Mount:  "kubernetes",
+		Role:   "example",
+	}
+	jwtAuth := config.VaultAuthConfiguration{
+		Method: config.VaultAuthMethodJWT,
+		Mount:  "oidc",
+		Role:   "puller",
+	}
+
+	tests := []struct {
+		name        string
+		auth        config.VaultAuthConfiguration
+		cachedEntry *tokenCache.Entry
+		wantToken   string
+		wantCached  string
+		wantExpires bool
+	}{
+		{
+			name:        "no cached token",
+			auth:        kubernetesAuth,
+			cachedEntry: nil,
+			wantToken:   "mock-token",
+			wantCached:  "mock-token",
+			wantExpires: true,
+		},
+		{
+			name:        "valid cached token",
+			auth:        kubernetesAuth,
+			cachedEntry: &tokenCache.Entry{Token: "cached-token", ExpireTime: time.Now().Add(time.Hour)},
+			wantToken:   "cached-token",
+			wantCached:  "cached-token",
+			wantExpires: true,
+		},
+		{
+			name:        "cached token without expiry",
+			auth:        kubernetesAuth,
+			cachedEntry: &tokenCache.Entry{Token: "cached-token"},
+			wantToken:   "cached-token",
+			wantCached:  "cached-token",
+			wantExpires: true,
+		},
+		{
+			name:        "expired cached token",
+			auth:        kubernetesAuth,
+			cachedEntry: &tokenCache.Entry{Token: "cached-token", ExpireTime: time.Now().Add(-time.Minute)},
+			wantToken:   "mock-token",
+			wantCached:  "mock-token",
+			wantExpires: true,
+		},
+		{
+			name:        "renewable cached token near expiry",
+			auth:        kubernetesAuth,
+			cachedEntry: &tokenCache.Entry{Token: "cached-token", ExpireTime: time.Now().Add(30 * time.Second), Renewable: true},
+			wantToken:   "cached-token",
+			wantCached:  "cached-token",
+			wantExpires: true,
+		},
+		{
+			name:        "not renewable cached token near expiry",
+			auth:        kubernetesAuth,
+			cachedEntry: &tokenCache.Entry{Token: "cached-token", ExpireTime: time.Now().Add(30 * time.Second), Renewable: false},
+			wantToken:   "mock-token",
+			wantCached:  "mock-token",
+			wantExpires: true,
+		},
+		{
+			name:        "jwt auth method without cached token",
+			auth:        jwtAuth,
+			cachedEntry: nil,
+			wantToken:   "mock-token",
+			wantCached:  "mock-token",
+			wantExpires: true,
+		},
+		{
+			name:        "jwt auth method with valid cached token",
+			auth:        jwtAuth,
+			cachedEntry: &tokenCache.Entry{Token: "cached-token", ExpireTime: time.Now().Add(time.Hour)},
+			wantToken:   "cached-token",
+			wantCached:  "cached-token",
+			wantExpires: true,
+		},
+		{
+			name:        "token auth method is not cached",
+			auth:        config.VaultAuthConfiguration{Method: config.VaultAuthMethodToken, Token: config.VaultTokenAuthConfiguration{File: writeTempFile(t, "hvs.example")}},
+			cachedEntry: nil,
+			wantToken:   "hvs.example",
+			wantCached:  "",
+			wantExpires: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetcher := VaultCredentialFetcher{
+				vaultConfig: &config.VaultConfiguration{
+					Address: "http://localhost:8200",
+					Auth:    []config.VaultAuthConfiguration{tt.auth},
+					TokenCache: config.VaultTokenCacheConfiguration{
+						Enabled:     true,
+						RenewBefore: time.Minute,
+					},
+				},
+				newVaultClientBuilder: func() vault.ClientBuilder { return vault.NewMockClientBuilder(nil) },
+				tokenCache:            tokenCache.NewFileTokenCache(filepath.Join(t.TempDir(), "cache"), filepath.Join(t.TempDir(), "key")),
+			}
+			log, err := logger.NewFileLogger(false, "", "error")
+			if err != nil {
+				t.Fatalf("failed to create logger: %v", err)
+			}
+
+			cacheKey, err := fetcher.tokenCacheKey(&tt.auth, "", serviceAccountToken)
+			if err != nil {
+				t.Fatalf("failed to create cache key: %v", err)
+			}
+			if tt.cachedEntry != nil {
+				if err := fetcher.tokenCache.Set(cacheKey, tt.cachedEntry); err != nil {
+					t.Fatalf("failed to set cache entry: %v", err)
+				}
+			}
+
+			vaultClient, err := fetcher.setupVaultClientWithCache(t.Context(), log, &tt.auth, "", serviceAccountToken)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := vaultClient.Token().Token; got != tt.wantToken {
+				t.Errorf("unexpected token: got %v, want %v", got, tt.wantToken)
+			}
+			// cached tokens are looked up, so their remaining ttl bounds the cache duration of responses
+			if got := !vaultClient.Token().ExpireTime.IsZero(); got != tt.wantExpires {
+				t.Errorf("unexpected token expiry: got %v, want %v", got, tt.wantExpires)
+			}
+
+			entry, err := fetcher.tokenCache.Get(cacheKey)
+			if err != nil {
+				t.Fatalf("failed to get cache entry: %v", err)
+			}
+			gotCached := ""
+			if entry != nil {
+				gotCached = entry.Token
+				if !entry.ExpireTime.IsZero() && entry.TTL(time.Now()) <= time.Minute {
+					t.Errorf("cached token is about to expire: %v", entry.ExpireTime)
+				}
+			}
+			if gotCached != tt.wantCached {
+				t.Errorf("unexpected cached token: got %v, want %v", gotCached, tt.wantCached)
+			}
+		})
+	}
+}
+
+func TestTokenCacheKey(t *testing.T) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"kubernetes.io":{"namespace":"team-a","serviceaccount":{"name":"puller","uid":"1234"}}}`))
+	serviceAccountToken := header + "." + payload + ".signature"
+
+	kubernetesAuth := config.VaultAuthConfiguration{Method: config.VaultAuthMethodKubernetes, Mount: "kubernetes", Role: "example"}
+	fetcher := VaultCredentialFetcher{
+		vaultConfig: &config.VaultConfiguration{Address: "http://localhost:8200"},
+	}
+	baseKey, err := fetcher.tokenCacheKey(&kubernetesAuth, "", serviceAccountToken)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		auth       config.VaultAuthConfiguration
+		token      string
+		wantSame   bool
+		wantErrMsg string
+	}{
+		{
+			name:     "same service account token",
+			auth:     kubernetesAuth,
+			token:    serviceAccountToken,
+			wantSame: true,
+		},
+		{
+			name:     "forged service account token with the same claims",
+			auth:     kubernetesAuth,
+			token:    header + "." + payload + ".forged",
+			wantSame: false,
+		},
+		{
+			name:     "different role",
+			auth:     config.VaultAuthConfiguration{Method: config.VaultAuthMethodKubernetes, Mount: "kubernetes", Role: "other"},
+			token:    serviceAccountToken,
+			wantSame: false,
+		},
+		{
+			name:     "jwt auth method with the same mount and role",
+			auth:     config.VaultAuthConfiguration{Method: config.VaultAuthMethodJWT, Mount: "kubernetes", Role: "example"},
+			token:    serviceAccountToken,
+			wantSame: false,
+		},
+		{
+			name:       "jwt auth method without service account token",
+			auth:       config.VaultAuthConfiguration{Method: config.VaultAuthMethodJWT, Mount: "oidc", Role: "puller"},
+			token:      "",
+			wantErrMsg: "service account token is required",
+		},
+		{
+			name:       "missing service account token",
+			auth:       kubernetesAuth,
+			token:      "",
+			wantErrMsg: "service account token is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := fetcher.tokenCacheKey(&tt.auth, "", tt.token)
+			if tt.wantErrMsg != "" {
+				if err == nil || err.Error() != tt.wantErrMsg {
+					t.Fatalf("expected error %q, got %v", tt.wantErrMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.Contains(key, tt.token) {
+				t.Errorf("cache key contains the service account token: %s", key)
+			}
+			if (key == baseKey) != tt.wantSame {
+				t.Errorf("unexpected key: got %s, base %s, want same %v", key, baseKey, tt.wantSame)
+			}
+		})
+	}
+}
+
+func writeTempFile(t *testing.T, content string) string {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	return file
+}
+
+func TestCleanup(t *testing.T) {
+	tests := []struct {
+		name        string
+		auth        config.VaultAuthConfiguration
+		revokeToken bool
+		wantRevoked bool
+	}{
+		{
+			name:        "revoke token of login",
+			auth:        config.VaultAuthConfiguration{Method: config.VaultAuthMethodKubernetes, Mount: "kubernetes", Role: "example"},
+			revokeToken: true,
+			wantRevoked: true,
+		},
+		{
+			name:        "revoke token disabled",
+			auth:        config.VaultAuthConfiguration{Method: config.VaultAuthMethodKubernetes, Mount: "kubernetes", Role: "example"},
+			revokeToken: false,
+			wantRevoked: false,
+		},
+		{
+			name:        "token of token auth method is not revoked",
+			auth:        config.VaultAuthConfiguration{Method: config.VaultAuthMethodToken, Token: config.VaultTokenAuthConfiguration{File: writeTempFile(t, "hvs.example")}},
+			revokeToken: true,
+			wantRevoked: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetcher := VaultCredentialFetcher{
+				vaultConfig: &config.VaultConfiguration{
+					Address: "http://localhost:8200",
+					Auth:    []config.VaultAuthConfiguration{tt.auth},
+					Secret: config.VaultSecretConfiguration{
+						Engine: config.VaultSecretEngineKvV2,
+						Mount:  "secret",
+						Path:   "example",
+						Format: config.VaultSecretFormatFields,
+						Fields: config.VaultSecretFieldsConfiguration{
+							Username: "username",
+							Password: "password",
+						},
+					},
+					RevokeToken: config.VaultRevokeTokenConfiguration{
+						Enabled: tt.revokeToken,
+						Timeout: time.Second,
+					},
+				},
+				newVaultClientBuilder: func() vault.ClientBuilder {
+					return vault.NewMockClientBuilder(map[string]any{
+						"username": "username",
+						"password": "password",
+					})
+				},
+			}
+			log, err := logger.NewFileLogger(false, "", "error")
+			if err != nil {
+				t.Fatalf("failed to create logger: %v", err)
+			}
+
+			_, err = fetcher.Fetch(t.Context(), log, &credentialproviderV1.CredentialProviderRequest{
+				Image:               "registry.example.com/my-image:latest",
+				ServiceAccountToken: "token",
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			vaultClient := fetcher.vaultClient.(*vault.MockClient)
+
+			if err := fetcher.Cleanup(t.Context(), log); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if vaultClient.TokenRevoked() != tt.wantRevoked {
+				t.Errorf("unexpected token revocation: got %v, want %v", vaultClient.TokenRevoked(), tt.wantRevoked)
+			}
+			// the client is not cached, so its connections are closed
+			if !vaultClient.Closed() {
+				t.Errorf("connections of vault client are not closed")
+			}
+		})
+	}
+}
+
+func TestResolveNamespace(t *testing.T) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256"}`))
+	newToken := func(namespace string) string {
+		payload := base64.RawURLEncoding.EncodeToString([]byte(`{"kubernetes.io":{"namespace":"` + namespace + `"}}`))
+		return header + "." + payload + ".signature"
+	}
+
+	tests := []struct {
+		name                string
+		namespace           string
+		namespaceMapping    map[string]string
+		serviceAccountToken string
+		want                string
+		wantErrMsg          string
+	}{
+		{
+			name:                "no namespace",
+			serviceAccountToken: newToken("team-a"),
+			want:                "",
+			wantErrMsg:          "",
+		},
+		{
+			name:                "namespace without mapping",
+			namespace:           "platform",
+			serviceAccountToken: newToken("team-a"),
+			want:                "platform",
+			wantErrMsg:          "",
+		},
+		{
+			name:                "mapped namespace",
+			namespace:           "platform",
+			namespaceMapping:    map[string]string{"team-a": "tenants/team-a"},
+			serviceAccountToken: newToken("team-a"),
+			want:                "platform/tenants/team-a",
+			wantErrMsg:          "",
+		},
+		{
+			name:                "mapped namespace without base namespace",
+			namespaceMapping:    map[string]string{"team-a": "tenants/team-a"},
+			serviceAccountToken: newToken("team-a"),
+			want:                "tenants/team-a",
+			wantErrMsg:          "",
+		},
+		{
+			name:                "unmapped namespace",
+			namespace:           "platform",
+			namespaceMapping:    map[string]string{"team-a": "tenants/team-a"},
+			serviceAccountToken: newToken("team-b"),
+			want:                "platform",
+			wantErrMsg:          "",
+		},
+		{
+			name:                "mapping without service account token",
+			namespace:           "platform",
+			namespaceMapping:    map[string]string{"team-a": "tenants/team-a"},
+			serviceAccountToken: "",
+			want:                "platform",
+			wantErrMsg:          "",
+		},
+		{
+			name:                "invalid service account token",
+			namespaceMapping:    map[string]string{"team-a": "tenants/team-a"},
+			serviceAccountToken: "token",
+			want:                "",
+			wantErrMsg:          "failed to parse service account token claims: token is not a jwt",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetcher := VaultCredentialFetcher{
+				vaultConfig: &config.VaultConfiguration{
+					Namespace:        tt.namespace,
+					NamespaceMapping: tt.namespaceMapping,
+				},
+				newVaultClientBuilder: nil,
+			}
+
+			got, err := fetcher.resolveNamespace(tt.serviceAccountToken)
+			if err != nil && err.Error() != tt.wantErrMsg {
+				t.Errorf("unexpected error: got %v, want %v", err, tt.wantErrMsg)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("unexpected namespace: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyServiceAccountAnnotations(t *testing.T) {
+	vaultConfig := &config.VaultConfiguration{
+		Address: "http://localhost:8200",
+		Auth: []config.VaultAuthConfiguration{
+			{
+				Method: config.VaultAuthMethodKubernetes,
+				Mount:  "kubernetes",
+				Role:   "example",
+			},
+			{
+				Method: config.VaultAuthMethodAWS,
+				Mount:  "aws",
+				Role:   "node",
+			},
+		},
+		Secret: config.VaultSecretConfiguration{
+			Mount: "secret",
+			Path:  "example",
+		},
+		ServiceAccountAnnotationOverrides: []config.ServiceAccountAnnotationOverride{
+			config.ServiceAccountAnnotationOverrideRole,
+			config.ServiceAccountAnnotationOverrideSecretPath,
+		},
+	}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		wantRoles   []string
+		wantSecret  config.VaultSecretConfiguration
+	}{
+		{
+			name:        "no annotations",
+			annotations: nil,
+			wantRoles:   []string{"example", "node"},
+			wantSecret:  config.VaultSecretConfiguration{Mount: "secret", Path: "example"},
+		},
+		{
+			name: "allowed overrides",
+			annotations: map[string]string{
+				"vault.credential-provider/role":        "team-a",
+				"vault.credential-provider/secret-path": "registries/team-a",
+			},
+			wantRoles:  []string{"team-a", "node"},
+			wantSecret: config.VaultSecretConfiguration{Mount: "secret", Path: "registries/team-a"},
+		},
+		{
+			name: "not allowed override",
+			annotations: map[string]string{
+				"vault.credential-provider/secret-mount": "other",
+			},
+			wantRoles:  []string{"example", "node"},
+			wantSecret: config.VaultSecretConfiguration{Mount: "secret", Path: "example"},
+		},
+		{
+			name: "unrelated and empty annotations",
+			annotations: map[string]string{
+				"example.com/role":               "team-a",
+				"vault.credential-provider/role": "",
+			},
+			wantRoles:  []string{"example", "node"},
+			wantSecret: config.VaultSecretConfiguration{Mount: "secret", Path: "example"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetcher := VaultCredentialFetcher{
+				vaultConfig:           vaultConfig,
+				newVaultClientBuilder: nil,
+			}
+			log, err := logger.NewFileLogger(false, "", "error")
+			if err != nil {
+				t.Fatalf("failed to create logger: %v", err)
+			}
+
+			authChain, secretConfig := fetcher.applyServiceAccountAnnotations(t.Context(), log, slices.Clone(vaultConfig.Auth), vaultConfig.Secret, tt.annotations)
+			for i, auth := range authChain {
+				if auth.Role != tt.wantRoles[i] {
+					t.Errorf("unexpected role for auth method %d: got %v, want %v", i, auth.Role, tt.wantRoles[i])
+				}
+			}
+			if !reflect.DeepEqual(secretConfig, tt.wantSecret) {
+				t.Errorf("unexpected secret config: got %v, want %v", secretConfig, tt.wantSecret)
+			}
+			if vaultConfig.Auth[0].Role != "example" || vaultConfig.Secret.Path != "example" {
+				t.Errorf("configuration was modified")
+			}
+		})
+	}
+}
+
+func TestResolveRegistry(t *testing.T) {
+	vaultConfig := &config.VaultConfiguration{
+		Auth: []config.VaultAuthConfiguration{
+			{Method: config.VaultAuthMethodKubernetes, Mount: "kubernetes", Role: "example"},
+			{Method: config.VaultAuthMethodAppRole, Mount: "approle", Role: "node"},
+		},
+		Secret: config.VaultSecretConfiguration{
+			Mount:  "secret",
+			Path:   "example",
+			Fields: config.VaultSecretFieldsConfiguration{Username: "username", Password: "password"},
+		},
+	}
+	registries := []config.RegistryConfiguration{
+		{
+			MatchImages: []string{"registry.example.com/team-a"},
+			Role:        "team-a",
+			Secret: config.RegistrySecretConfiguration{
+				Path:   "registries/team-a",
+				Fields: config.VaultSecretFieldsConfiguration{Auth: "auth"},
+			},
+		},
+		{
+			MatchImages: []string{"quay.io", "*.example.com"},
+			Secret:      config.RegistrySecretConfiguration{Mount: "registries", Path: "{{ .Registry }}"},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		registries    []config.RegistryConfiguration
+		defaultSecret bool
+		image         string
+		wantRegistry  int
+		wantRoles     []string
+		wantSecret    config.VaultSecretConfiguration
+		wantErrMsg    string
+	}{
+		{
+			name:          "first matching registry",
+			registries:    registries,
+			defaultSecret: true,
+			image:         "registry.example.com/team-a/app:1.0",
+			wantRegistry:  0,
+			wantRoles:     []string{"team-a", "node"},
+			wantSecret:    config.VaultSecretConfiguration{Mount: "secret", Path: "registries/team-a", Fields: config.VaultSecretFieldsConfiguration{Auth: "auth"}},
+			wantErrMsg:    "",
+		},
+		{
+			name:          "second registry",
+			registries:    registries,
+			defaultSecret: true,
+			image:         "registry.example.com/team-b/app:1.0",
+			wantRegistry:  1,
+			wantRoles:     []string{"example", "node"},
+			wantSecret:    config.VaultSecretConfiguration{Mount: "registries", Path: "{{ .Registry }}", Fields: config.VaultSecretFieldsConfiguration{Username: "username", Password: "password"}},
+			wantErrMsg:    "",
+		},
+		{
+			name:          "no matching registry uses default secret",
+			registries:    registries,
+			defaultSecret: true,
+			image:         "ghcr.io/app:1.0",
+			wantRegistry:  -1,
+			wantRoles:     []string{"example", "node"},
+			wantSecret:    vaultConfig.Secret,
+			wantErrMsg:    "",
+		},
+		{
+			name:          "no matching registry without default secret",
+			registries:    registries,
+			defaultSecret: false,
+			image:         "ghcr.io/app:1.0",
+			wantRegistry:  -1,
+			wantErrMsg:    "no registry matches image ghcr.io/app:1.0",
+		},
+		{
+			name:          "no registries",
+			registries:    nil,
+			defaultSecret: true,
+			image:         "ghcr.io/app:1.0",
+			wantRegistry:  -1,
+			wantRoles:     []string{"example", "node"},
+			wantSecret:    vaultConfig.Secret,
+			wantErrMsg:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := *vaultConfig
+			if !tt.defaultSecret {
+				cfg.Secret.Mount = ""
+				cfg.Secret.Path = ""
+			}
+			fetcher := VaultCredentialFetcher{
+				vaultConfig:           &cfg,
+				registries:            tt.registries,
+				newVaultClientBuilder: nil,
+			}
+			log, err := logger.NewFileLogger(false, "", "error")
+			if err != nil {
+				t.Fatalf("failed to create logger: %v", err)
+			}
+
+			registry, authChain, secretConfig, err := fetcher.resolveRegistry(t.Context(), log, tt.image)
+			if err != nil && err.Error() != tt.wantErrMsg {
+				t.Errorf("unexpected error: got %v, want %v", err, tt.wantErrMsg)
+			}
+			if err == nil && tt.wantErrMsg != "" {
+				t.Errorf("expected error: %v", tt.wantErrMsg)
+			}
+			if err != nil {
+				return
+			}
+			if (tt.wantRegistry < 0 && registry != nil) || (tt.wantRegistry >= 0 && registry != &tt.registries[tt.wantRegistry]) {
+				t.Errorf("unexpected registry: got %v, want registries[%d]", registry, tt.wantRegistry)
+			}
+			for i, auth := range authChain {
+				if auth.Role != tt.wantRoles[i] {
+					t.Errorf("unexpected role for auth method %d: got %v, want %v", i, auth.Role, tt.wantRoles[i])
+				}
+			}
+			if !reflect.DeepEqual(secretConfig, tt.wantSecret) {
+				t.Errorf("unexpected secret config: got %v, want %v", secretConfig, tt.wantSecret)
+			}
+			if vaultConfig.Auth[0].Role != "example" {
+				t.Errorf("configuration was modified")
+			}
+		})
+	}
+}
+
+func TestSetupVaultClientWithWrappedToken(t *testing.T) {
+	sink := writeTempFile(t, `{"token":"hvs.wrapping","ttl":300}`)
+	auth := config.VaultAuthConfiguration{
+		Method: config.VaultAuthMethodToken,
+		Token:  config.VaultTokenAuthConfiguration{File: sink},
+	}
+	wrappedSecrets := map[string]string{
+		"hvs.wrapping":     "hvs.unwrapped",
+		"hvs.new-wrapping": "hvs.new-unwrapped",
+	}
+	fetcher := VaultCredentialFetcher{
+		vaultConfig: &config.VaultConfiguration{
+			Address: "http://localhost:8200",
+			Auth:    []config.VaultAuthConfiguration{auth},
+		},
+		newVaultClientBuilder: func() vault.ClientBuilder {
+			return vault.NewMockClientBuilder(nil).(*vault.MockClientBuilder).WithMockWrappedSecrets(wrappedSecrets)
+		},
+		tokenCache: tokenCache.NewMemoryTokenCache(),
+	}
+	log, err := logger.NewFileLogger(false, "", "error")
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+
+	// the wrapping token is only unwrapped once, following invocations read the same sink until it is rewritten
+	for _, want := range []string{"hvs.unwrapped", "hvs.unwrapped"} {
+		vaultClient, err := fetcher.setupVaultClient(t.Context(), log, fetcher.vaultConfig.Auth, "", "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if vaultClient.Token().Token != want {
+			t.Errorf("unexpected token: got %s, want %s", vaultClient.Token().Token, want)
+		}
+	}
+	if err := os.WriteFile(sink, []byte(`{"token":"hvs.new-wrapping","ttl":300}`), 0o600); err != nil {
+		t.Fatalf("failed to rewrite sink: %v", err)
+	}
+	vaultClient, err := fetcher.setupVaultClient(t.Context(), log, fetcher.vaultConfig.Auth, "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if vaultClient.Token().Token != "hvs.new-unwrapped" {
+		t.Errorf("unexpected token after rewrite of the sink: got %s, want hvs.new-unwrapped", vaultClient.Token().Token)
+	}
+
+	// without token cache, the wrapping token could only be used by a single invocation
+	fetcher.tokenCache = nil
+	wantErrMsg := "token: token cache is required for wrapped tokens, because they can only be unwrapped once"
+	if _, err := fetcher.setupVaultClient(t.Context(), log, fetcher.vaultConfig.Auth, "", ""); err == nil || err.Error() != wantErrMsg {
+		t.Errorf("unexpected error: got %v, want %v", err, wantErrMsg)
+	}
+}
+
+func TestSetupVaultClientWithWrappedSecretID(t *testing.T) {
+	auth := config.VaultAuthConfiguration{
+		Method: config.VaultAuthMethodAppRole,
+		Mount:  "approle",
+		AppRole: config.VaultAppRoleAuthConfiguration{
+			RoleIDFile:      writeTempFile(t, "role-id"),
+			SecretIDFile:    writeTempFile(t, "hvs.wrapping"),
+			SecretIDWrapped: true,
+		},
+	}
+	wrappedSecrets := map[string]string{
+		"hvs.wrapping": "secret-id",
+	}
+	fetcher := VaultCredentialFetcher{
+		vaultConfig: &config.VaultConfiguration{
+			Address: "http://localhost:8200",
+			Auth:    []config.VaultAuthConfiguration{auth},
+		},
+		newVaultClientBuilder: func() vault.ClientBuilder {
+			return vault.NewMockClientBuilder(nil).(*vault.MockClientBuilder).WithMockWrappedSecrets(wrappedSecrets)
+		},
+		tokenCache: tokenCache.NewMemoryTokenCache(),
+	}
+	log, err := logger.NewFileLogger(false, "", "error")
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+
+	// every login (e.g. after the cached token expired) needs the secret id, but the wrapping token is only unwrapped once
+	for range 2 {
+		vaultClient, err := fetcher.setupVaultClientWithAuth(t.Context(), log, &auth, "", "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if secretID := vaultClient.(*vault.MockClient).Login().SecretID; secretID != "secret-id" {
+			t.Errorf("unexpected secret id: got %s, want secret-id", secretID)
+		}
+	}
+
+	// without token cache, the wrapping token could only be used by a single login
+	fetcher.tokenCache = nil
+	wantErrMsg := "token cache is required for wrapped secret ids, because they can only be unwrapped once"
+	if _, err := fetcher.setupVaultClientWithAuth(t.Context(), log, &auth, "", ""); err == nil || err.Error() != wantErrMsg {
+		t.Errorf("unexpected error: got %v, want %v", err, wantErrMsg)
+	}
+}
+
+func TestParseTokenSinkContent(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		want        string
+		wantWrapped bool
+		wantErrMsg  string
+	}{
+		{
+			name:        "plain token",
+			content:     "hvs.example",
+			want:        "hvs.example",
+			wantWrapped: false,
+			wantErrMsg:  "",
+		},
+		{
+			name:        "wrapped token",
+			content:     `{"token":"hvs.wrapping","accessor":"accessor","ttl":300,"creation_path":"sys/wrapping/wrap"}`,
+			want:        "hvs.wrapping",
+			wantWrapped: true,
+			wantErrMsg:  "",
+		},
+		{
+			name:       "wrapped token without token",
+			content:    `{"accessor":"accessor"}`,
+			want:       "",
+			wantErrMsg: "wrapped token does not contain a token",
+		},
+		{
+			name:       "invalid json",
+			content:    `{"token":`,
+			want:       "",
+			wantErrMsg: "failed to unmarshal wrapped token: unexpected end of JSON input",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, wrapped, err := parseTokenSinkContent(tt.content)
 			if err != nil && err.Error() != tt.wantErrMsg {
 				t.Errorf("unexpected error: got %v, want %v", err, tt.wantErrMsg)
 			}
-			if got != nil && !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("unexpected auth config: got %v, want %v", got, tt.want)
+			if err == nil && (got != tt.want || wrapped != tt.wantWrapped) {
+				t.Errorf("unexpected token: got %v (wrapped %v), want %v (wrapped %v)", got, wrapped, tt.want, tt.wantWrapped)
 			}
 		})
 	}
@@ -0,0 +1,89 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/communicationInterface"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/logger"
+	credentialproviderV1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
+)
+
+// ErrDaemonUnavailable is returned if the daemon is not reachable or does not reply in time,
+// so the request can be handled in-process instead
+var ErrDaemonUnavailable = errors.New("daemon is not available")
+
+// Client forwards the request of the kubelet to the daemon
+type Client struct {
+	socket  string
+	timeout time.Duration
+}
+
+func NewClient(socket string, timeout time.Duration) *Client {
+	return &Client{
+		socket:  socket,
+		timeout: timeout,
+	}
+}
+
+// Forward reads the request, forwards it to the daemon and writes the response of the daemon
+func (c *Client) Forward(ctx context.Context, log logger.Logger, communicationInterface communicationInterface.CommunicationInterface) error {
+	request, err := communicationInterface.ReadRequest(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read request: %w", err)
+	}
+
+	response, err := c.send(ctx, request)
+	if err != nil {
+		return err
+	}
+	log.Log(ctx, slog.LevelDebug, "Received response from daemon", "response", response)
+
+	if err := communicationInterface.WriteResponse(ctx, response); err != nil {
+		return fmt.Errorf("failed to write response: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) send(ctx context.Context, request *credentialproviderV1.CredentialProviderRequest) (*credentialproviderV1.CredentialProviderResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "unix", c.socket)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to connect to daemon: %w", ErrDaemonUnavailable, err)
+	}
+	// nolint:errcheck
+	defer conn.Close() //gosec:disable G104
+	if deadline, ok := ctx.Deadline(); ok {
+		// nolint:errcheck
+		conn.SetDeadline(deadline) //gosec:disable G104
+	}
+
+	// the request is sent as v1, so the daemon replies with a v1 response
+	if err := communicationInterface.WriteSocketMessage(conn, request); err != nil {
+		return nil, fmt.Errorf("%w: failed to send request: %w", ErrDaemonUnavailable, err)
+	}
+	data, err := communicationInterface.ReadSocketMessage(conn)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read reply: %w", ErrDaemonUnavailable, err)
+	}
+
+	reply := &communicationInterface.SocketReply{}
+	if err := json.Unmarshal(data, reply); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal reply of daemon: %w", err)
+	}
+	if reply.Error != "" {
+		return nil, fmt.Errorf("daemon failed to handle request: %s", reply.Error)
+	}
+	response := &credentialproviderV1.CredentialProviderResponse{}
+	if err := json.Unmarshal(reply.Response, response); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response of daemon: %w", err)
+	}
+	return response, nil
+}
@@ -0,0 +1,206 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/communicationInterface"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/config"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/credentialFetcher"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/logger"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	credentialproviderV1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
+)
+
+func TestForward(t *testing.T) {
+	request := credentialproviderV1.CredentialProviderRequest{
+		TypeMeta: metaV1.TypeMeta{
+			APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+			Kind:       "CredentialProviderRequest",
+		},
+		Image: "registry.example.com/my-image:latest",
+	}
+
+	tests := []struct {
+		name string
+		// fetchErr is returned by the credential fetcher of the daemon
+		fetchErr        error
+		noDaemon        bool
+		want            *credentialproviderV1.CredentialProviderResponse
+		wantErrMsg      string
+		wantUnavailable bool
+	}{
+		{
+			name: "valid request",
+			want: &credentialproviderV1.CredentialProviderResponse{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderResponse",
+				},
+				Auth: map[string]credentialproviderV1.AuthConfig{
+					"registry.example.com": {
+						Username: "user",
+						Password: "password",
+					},
+				},
+				CacheKeyType: credentialproviderV1.RegistryPluginCacheKeyType,
+			},
+		},
+		{
+			name:       "daemon fails",
+			fetchErr:   errors.New("permission denied"),
+			wantErrMsg: "daemon failed to handle request: failed to fetch credentials: permission denied",
+		},
+		{
+			name:            "daemon not running",
+			noDaemon:        true,
+			wantUnavailable: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, err := logger.NewFileLogger(false, "", "error")
+			if err != nil {
+				t.Fatalf("failed to create logger: %v", err)
+			}
+			socket := filepath.Join(t.TempDir(), "daemon.sock")
+
+			if !tt.noDaemon {
+				server := NewServer(socket, time.Second, func() credentialFetcher.CredentialFetcher {
+					if tt.fetchErr != nil {
+						return credentialFetcher.NewMockCredentialFetcherWithError(tt.fetchErr)
+					}
+					return credentialFetcher.NewMockCredentialFetcher(&credentialproviderV1.AuthConfig{
+						Username: "user",
+						Password: "password",
+					})
+				}, &config.GracefulConfiguration{})
+				ctx, cancel := context.WithCancel(t.Context())
+				done := make(chan error, 1)
+				go func() {
+					done <- server.Serve(ctx, log)
+				}()
+				t.Cleanup(func() {
+					cancel()
+					if err := <-done; err != nil {
+						t.Errorf("unexpected error of server: %v", err)
+					}
+					if _, err := os.Stat(socket); !errors.Is(err, os.ErrNotExist) {
+						t.Errorf("socket is not removed on shutdown: %v", err)
+					}
+				})
+				waitForSocket(t, socket)
+			}
+
+			communicationInterface := communicationInterface.NewMockCommunicationInterface(&request)
+			err = NewClient(socket, time.Second).Forward(t.Context(), log, communicationInterface)
+			if tt.wantUnavailable {
+				if !errors.Is(err, ErrDaemonUnavailable) {
+					t.Errorf("expected daemon to be unavailable, got %v", err)
+				}
+				return
+			}
+			if tt.wantErrMsg != "" {
+				if err == nil || err.Error() != tt.wantErrMsg {
+					t.Fatalf("expected error %q, got %v", tt.wantErrMsg, err)
+				}
+				if errors.Is(err, ErrDaemonUnavailable) {
+					t.Errorf("failed request must not be handled in-process: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(communicationInterface.LastResponse(), tt.want) {
+				t.Errorf("unexpected response: got %v, want %v", communicationInterface.LastResponse(), tt.want)
+			}
+		})
+	}
+}
+
+// failingListener fails the first accepts, like a listener that temporarily hits the limit of open files
+type failingListener struct {
+	net.Listener
+	failures atomic.Int32
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	if l.failures.Add(-1) >= 0 {
+		return nil, errors.New("accept: too many open files")
+	}
+	return l.Listener.Accept()
+}
+
+func TestServeAcceptErrors(t *testing.T) {
+	request := credentialproviderV1.CredentialProviderRequest{
+		TypeMeta: metaV1.TypeMeta{
+			APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+			Kind:       "CredentialProviderRequest",
+		},
+		Image: "registry.example.com/my-image:latest",
+	}
+	log, err := logger.NewFileLogger(false, "", "error")
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	socket := filepath.Join(t.TempDir(), "daemon.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("failed to listen on socket: %v", err)
+	}
+	failingListener := &failingListener{Listener: listener}
+	failingListener.failures.Store(3)
+
+	server := NewServer(socket, time.Second, func() credentialFetcher.CredentialFetcher {
+		return credentialFetcher.NewMockCredentialFetcher(&credentialproviderV1.AuthConfig{
+			Username: "user",
+			Password: "password",
+		})
+	}, &config.GracefulConfiguration{})
+	done := make(chan error, 1)
+	go func() {
+		done <- server.serve(t.Context(), log, failingListener)
+	}()
+
+	// the server keeps accepting after failed accepts
+	communicationInterface := communicationInterface.NewMockCommunicationInterface(&request)
+	if err := NewClient(socket, time.Second).Forward(t.Context(), log, communicationInterface); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if communicationInterface.LastResponse() == nil {
+		t.Errorf("no response after failed accepts")
+	}
+
+	// a closed listener stops the server, even if the context is not done
+	if err := listener.Close(); err != nil {
+		t.Fatalf("failed to close listener: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err == nil || !errors.Is(err, net.ErrClosed) {
+			t.Errorf("expected error of closed listener, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("server did not stop after the listener was closed")
+	}
+}
+
+func waitForSocket(t *testing.T, socket string) {
+	t.Helper()
+	for range 100 {
+		if _, err := os.Stat(socket); err == nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("daemon did not create socket %s", socket)
+}
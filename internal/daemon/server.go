@@ -0,0 +1,125 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/communicationInterface"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/config"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/credentialFetcher"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/logger"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/provider"
+)
+
+// socketMode restricts the socket to its owner, because every client can request credentials
+const socketMode = 0o600
+
+// failed accepts (e.g. too many open files) are retried with an exponential backoff between these durations
+const (
+	minAcceptBackoff = 5 * time.Millisecond
+	maxAcceptBackoff = time.Second
+)
+
+// Server handles the requests of the exec'd clients on a unix socket
+type Server struct {
+	socket  string
+	timeout time.Duration
+	// newCredentialFetcher returns a fetcher for a single request, fetchers share their caches but not their state
+	newCredentialFetcher func() credentialFetcher.CredentialFetcher
+	gracefulConfig       *config.GracefulConfiguration
+}
+
+func NewServer(socket string, timeout time.Duration, newCredentialFetcher func() credentialFetcher.CredentialFetcher, gracefulConfig *config.GracefulConfiguration) *Server {
+	return &Server{
+		socket:               socket,
+		timeout:              timeout,
+		newCredentialFetcher: newCredentialFetcher,
+		gracefulConfig:       gracefulConfig,
+	}
+}
+
+// Serve handles requests concurrently until the context is done, then it waits for the running requests
+func (s *Server) Serve(ctx context.Context, log logger.Logger) error {
+	// the socket of a daemon that was not shut down cleanly prevents listening
+	if err := os.Remove(s.socket); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+	listener, err := net.Listen("unix", s.socket)
+	if err != nil {
+		return fmt.Errorf("failed to listen on socket: %w", err)
+	}
+	// closing the listener also removes the socket
+	// nolint:errcheck
+	defer listener.Close() //gosec:disable G104
+	if err := os.Chmod(s.socket, socketMode); err != nil {
+		return fmt.Errorf("failed to set mode of socket: %w", err)
+	}
+	log.Log(ctx, slog.LevelInfo, "Listening for requests", "socket", s.socket)
+	return s.serve(ctx, log, listener)
+}
+
+// serve accepts connections until the context is done or the listener is closed, other accept errors are retried
+func (s *Server) serve(ctx context.Context, log logger.Logger, listener net.Listener) error {
+	// accept is only interrupted by closing the listener
+	go func() {
+		<-ctx.Done()
+		// nolint:errcheck
+		listener.Close() //gosec:disable G104
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	backoff := time.Duration(0)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return fmt.Errorf("failed to accept connection: %w", err)
+			}
+			backoff = min(max(2*backoff, minAcceptBackoff), maxAcceptBackoff)
+			log.Log(ctx, slog.LevelWarn, "Failed to accept connection, retrying", "error", err, "backoff", backoff)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(backoff):
+			}
+			continue
+		}
+		backoff = 0
+		wg.Go(func() {
+			s.handle(ctx, log, conn)
+		})
+	}
+}
+
+func (s *Server) handle(ctx context.Context, log logger.Logger, conn net.Conn) {
+	// nolint:errcheck
+	defer conn.Close() //gosec:disable G104
+
+	// running requests are finished on shutdown, but never take longer than the client waits for them
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.timeout)
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); ok {
+		// nolint:errcheck
+		conn.SetDeadline(deadline) //gosec:disable G104
+	}
+
+	communicationInterface := communicationInterface.NewSocketCommunicationInterface(conn)
+	provider := provider.NewKubeletCredentialProvider(communicationInterface, s.newCredentialFetcher(), s.gracefulConfig)
+	if err := provider.Run(ctx, log); err != nil {
+		log.Log(ctx, slog.LevelError, "Failed to handle request", "error", err)
+		if err := communicationInterface.WriteError(ctx, err); err != nil {
+			log.Log(ctx, slog.LevelWarn, "Failed to write error to client", "error", err)
+		}
+	}
+}
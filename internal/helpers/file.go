@@ -0,0 +1,20 @@
+package helpers
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ReadTrimmedFile reads the file at the given path and returns its content without surrounding whitespace
+func ReadTrimmedFile(path string) (string, error) {
+	data, err := os.ReadFile(path) //gosec:disable G304
+	if err != nil {
+		return "", fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	content := strings.TrimSpace(string(data))
+	if content == "" {
+		return "", fmt.Errorf("file %s is empty", path)
+	}
+	return content, nil
+}
@@ -0,0 +1,49 @@
+package imageReference
+
+import (
+	"fmt"
+
+	"github.com/distribution/reference"
+)
+
+// DefaultRegistry is the registry of images without registry (docker hub)
+const DefaultRegistry = "docker.io"
+
+// Reference is a parsed image reference, e.g. registry.example.com/team/app:1.0
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// Parse splits the image into registry, repository, tag and digest, following the normalization of docker and the kubelet:
+// images without registry are docker hub images (index.docker.io is replaced by docker.io),
+// single component docker hub images are official images (library/).
+func Parse(image string) (*Reference, error) {
+	if image == "" {
+		return nil, fmt.Errorf("image is empty")
+	}
+
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return nil, err
+	}
+
+	ref := &Reference{
+		Registry:   reference.Domain(named),
+		Repository: reference.Path(named),
+	}
+	if tagged, ok := named.(reference.Tagged); ok {
+		ref.Tag = tagged.Tag()
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		ref.Digest = digested.Digest().String()
+	}
+	return ref, nil
+}
+
+// Name returns the registry and repository of the reference
+func (r *Reference) Name() string {
+	return r.Registry + "/" + r.Repository
+}
@@ -0,0 +1,118 @@
+package imageReference
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name       string
+		image      string
+		want       *Reference
+		wantErrMsg string
+	}{
+		{
+			name:  "registry with tag",
+			image: "registry.example.com/team/app:1.0",
+			want: &Reference{
+				Registry:   "registry.example.com",
+				Repository: "team/app",
+				Tag:        "1.0",
+			},
+			wantErrMsg: "",
+		},
+		{
+			name:  "registry with port and digest",
+			image: "registry.example.com:5000/app@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+			want: &Reference{
+				Registry:   "registry.example.com:5000",
+				Repository: "app",
+				Digest:     "sha256:0000000000000000000000000000000000000000000000000000000000000000",
+			},
+			wantErrMsg: "",
+		},
+		{
+			name:  "tag and digest",
+			image: "localhost/app:1.0@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+			want: &Reference{
+				Registry:   "localhost",
+				Repository: "app",
+				Tag:        "1.0",
+				Digest:     "sha256:0000000000000000000000000000000000000000000000000000000000000000",
+			},
+			wantErrMsg: "",
+		},
+		{
+			name:  "official docker hub image",
+			image: "nginx:latest",
+			want: &Reference{
+				Registry:   "docker.io",
+				Repository: "library/nginx",
+				Tag:        "latest",
+			},
+			wantErrMsg: "",
+		},
+		{
+			name:  "docker hub image with organization",
+			image: "bitnami/nginx",
+			want: &Reference{
+				Registry:   "docker.io",
+				Repository: "bitnami/nginx",
+			},
+			wantErrMsg: "",
+		},
+		{
+			name:  "legacy docker hub registry",
+			image: "index.docker.io/library/nginx:latest",
+			want: &Reference{
+				Registry:   "docker.io",
+				Repository: "library/nginx",
+				Tag:        "latest",
+			},
+			wantErrMsg: "",
+		},
+		{
+			name:  "registry with port and nested repository",
+			image: "localhost:5000/team/sub/app",
+			want: &Reference{
+				Registry:   "localhost:5000",
+				Repository: "team/sub/app",
+			},
+			wantErrMsg: "",
+		},
+		{
+			name:       "uppercase repository",
+			image:      "registry.example.com/Team/app",
+			want:       nil,
+			wantErrMsg: "invalid reference format: repository name (Team/app) must be lowercase",
+		},
+		{
+			name:       "empty image",
+			image:      "",
+			want:       nil,
+			wantErrMsg: "image is empty",
+		},
+		{
+			name:       "registry without repository",
+			image:      "registry.example.com/",
+			want:       nil,
+			wantErrMsg: "invalid reference format",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.image)
+			if err != nil && err.Error() != tt.wantErrMsg {
+				t.Errorf("unexpected error: got %v, want %v", err, tt.wantErrMsg)
+			}
+			if err == nil && tt.wantErrMsg != "" {
+				t.Errorf("expected error: %v", tt.wantErrMsg)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unexpected reference: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
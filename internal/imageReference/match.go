@@ -0,0 +1,72 @@
+package imageReference
+
+import (
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// MatchImage reports whether the image matches the pattern, using the same semantics as the matchImages of the kubelet
+// CredentialProviderConfig: host labels are matched as globs (e.g. *.registry.io), the port must be equal
+// and the path of the pattern must be a prefix of the image path.
+func MatchImage(pattern string, image string) (bool, error) {
+	patternURL, err := parseSchemelessURL(pattern)
+	if err != nil {
+		return false, err
+	}
+	imageURL, err := parseSchemelessURL(image)
+	if err != nil {
+		return false, err
+	}
+
+	patternParts, patternPort := splitURL(patternURL)
+	imageParts, imagePort := splitURL(imageURL)
+	if patternPort != imagePort {
+		return false, nil
+	}
+	if len(patternParts) != len(imageParts) {
+		return false, nil
+	}
+	if !strings.HasPrefix(imageURL.Path, patternURL.Path) {
+		return false, nil
+	}
+	for i, patternPart := range patternParts {
+		matched, err := filepath.Match(patternPart, imageParts[i])
+		if err != nil {
+			return false, err
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// ValidatePattern returns an error if the pattern can not be used with MatchImage
+func ValidatePattern(pattern string) error {
+	patternURL, err := parseSchemelessURL(pattern)
+	if err != nil {
+		return err
+	}
+	patternParts, _ := splitURL(patternURL)
+	for _, patternPart := range patternParts {
+		if _, err := filepath.Match(patternPart, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseSchemelessURL(schemelessURL string) (*url.URL, error) {
+	return url.Parse("https://" + schemelessURL)
+}
+
+// splitURL returns the labels of the host and the port of the url
+func splitURL(u *url.URL) ([]string, string) {
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		host, port = u.Host, ""
+	}
+	return strings.Split(host, "."), port
+}
@@ -0,0 +1,94 @@
+package imageReference
+
+import (
+	"testing"
+)
+
+func TestMatchImage(t *testing.T) {
+	tests := []struct {
+		name       string
+		pattern    string
+		image      string
+		want       bool
+		wantErrMsg string
+	}{
+		{
+			name:       "exact registry",
+			pattern:    "registry.example.com",
+			image:      "registry.example.com/team/app:1.0",
+			want:       true,
+			wantErrMsg: "",
+		},
+		{
+			name:       "wildcard subdomain",
+			pattern:    "*.example.com",
+			image:      "registry.example.com/team/app:1.0",
+			want:       true,
+			wantErrMsg: "",
+		},
+		{
+			name:       "wildcard does not match multiple labels",
+			pattern:    "*.example.com",
+			image:      "eu.registry.example.com/team/app:1.0",
+			want:       false,
+			wantErrMsg: "",
+		},
+		{
+			name:       "wildcard does not match parent domain",
+			pattern:    "*.example.com",
+			image:      "example.com/team/app:1.0",
+			want:       false,
+			wantErrMsg: "",
+		},
+		{
+			name:       "path prefix",
+			pattern:    "registry.example.com/team",
+			image:      "registry.example.com/team/app:1.0",
+			want:       true,
+			wantErrMsg: "",
+		},
+		{
+			name:       "other path",
+			pattern:    "registry.example.com/team",
+			image:      "registry.example.com/other/app:1.0",
+			want:       false,
+			wantErrMsg: "",
+		},
+		{
+			name:       "port",
+			pattern:    "registry.example.com:5000",
+			image:      "registry.example.com:5000/app:1.0",
+			want:       true,
+			wantErrMsg: "",
+		},
+		{
+			name:       "port mismatch",
+			pattern:    "registry.example.com",
+			image:      "registry.example.com:5000/app:1.0",
+			want:       false,
+			wantErrMsg: "",
+		},
+		{
+			name:       "invalid pattern",
+			pattern:    "[.example.com",
+			image:      "registry.example.com/app:1.0",
+			want:       false,
+			wantErrMsg: "parse \"https://[.example.com\": missing ']' in host",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MatchImage(tt.pattern, tt.image)
+			if err != nil && err.Error() != tt.wantErrMsg {
+				t.Errorf("unexpected error: got %v, want %v", err, tt.wantErrMsg)
+			}
+			if err == nil && tt.wantErrMsg != "" {
+				t.Errorf("expected error: %v", tt.wantErrMsg)
+			}
+			if got != tt.want {
+				t.Errorf("unexpected match: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,23 +4,27 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
-	"strings"
 
 	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/communicationInterface"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/config"
 	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/credentialFetcher"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/imageReference"
 	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/logger"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	credentialproviderV1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
 )
 
 type KubeletCredentialProvider struct {
 	communicationInterface communicationInterface.CommunicationInterface
 	credentialFetcher      credentialFetcher.CredentialFetcher
+	gracefulConfig         *config.GracefulConfiguration
 }
 
-func NewKubeletCredentialProvider(communicationInterface communicationInterface.CommunicationInterface, credentialFetcher credentialFetcher.CredentialFetcher) *KubeletCredentialProvider {
+func NewKubeletCredentialProvider(communicationInterface communicationInterface.CommunicationInterface, credentialFetcher credentialFetcher.CredentialFetcher, gracefulConfig *config.GracefulConfiguration) *KubeletCredentialProvider {
 	return &KubeletCredentialProvider{
 		communicationInterface: communicationInterface,
 		credentialFetcher:      credentialFetcher,
+		gracefulConfig:         gracefulConfig,
 	}
 }
 
@@ -32,27 +36,59 @@ func (k *KubeletCredentialProvider) Run(ctx context.Context, log logger.Logger)
 	}
 	log.Log(ctx, slog.LevelDebug, "Received request", "request", request)
 
-	// fetch credentials
-	authConfig, err := k.credentialFetcher.Fetch(ctx, request)
-	if err != nil {
-		return fmt.Errorf("failed to fetch credentials: %w", err)
-	}
-	log.Log(ctx, slog.LevelDebug, "Fetched credentials", "credentials", authConfig)
+	// cleanup after the response is written (or the request failed), the kubelet still waits for the plugin to exit,
+	// so the cleanup (e.g. the token revocation) adds to the latency of the image pull
+	defer k.cleanup(ctx, log)
 
-	// get registry name
-	registryName, err := extractRegistryName(request.Image)
+	// fetch credentials
+	credentials, err := k.credentialFetcher.Fetch(ctx, log, request)
 	if err != nil {
-		return fmt.Errorf("failed to extract registry name: %w", err)
+		if !k.gracefulConfig.Enabled || !credentialFetcher.IsNoCredentials(err) {
+			return fmt.Errorf("failed to fetch credentials: %w", err)
+		}
+		// the kubelet falls back to other providers and image pull secrets if the response contains no credentials,
+		// the empty response is only cached for the image, so it does not hide credentials of other images of the registry
+		log.Log(ctx, slog.LevelInfo, "No credentials for image, writing empty response", "image", request.Image, "reason", err)
+		cacheDuration := k.gracefulConfig.CacheDuration
+		credentials = &credentialFetcher.Credentials{
+			CacheDuration: &cacheDuration,
+			CacheKeyType:  config.CacheKeyTypeImage,
+		}
 	}
-	log.Log(ctx, slog.LevelDebug, "Extracted registry name", "registryName", registryName)
+	log.Log(ctx, slog.LevelDebug, "Fetched credentials", "credentials", credentials)
 
 	// create response
 	response := &credentialproviderV1.CredentialProviderResponse{
-		Auth: map[string]credentialproviderV1.AuthConfig{
-			registryName: *authConfig,
-		},
+		Auth:         map[string]credentialproviderV1.AuthConfig{},
 		CacheKeyType: credentialproviderV1.RegistryPluginCacheKeyType,
 	}
+	if credentials.CacheKeyType != "" {
+		response.CacheKeyType = credentialproviderV1.PluginCacheKeyType(credentials.CacheKeyType)
+	}
+	for registry, authConfig := range credentials.Auth {
+		response.Auth[registry] = authConfig
+	}
+	if credentials.AuthConfig != nil {
+		// parse image (docker hub images are normalized to docker.io, like the kubelet does)
+		ref, err := imageReference.Parse(request.Image)
+		if err != nil {
+			return fmt.Errorf("failed to parse image: %w", err)
+		}
+		log.Log(ctx, slog.LevelDebug, "Parsed image", "registry", ref.Registry, "repository", ref.Repository)
+
+		// aliases (e.g. mirrors) get the same credentials, so the kubelet does not request them separately
+		for _, registry := range append([]string{ref.Registry}, credentials.Aliases...) {
+			// image scoped credentials must only match the repository of the image, not the whole registry
+			key := registry
+			if response.CacheKeyType == credentialproviderV1.ImagePluginCacheKeyType {
+				key = registry + "/" + ref.Repository
+			}
+			response.Auth[key] = *credentials.AuthConfig
+		}
+	}
+	if credentials.CacheDuration != nil {
+		response.CacheDuration = &metaV1.Duration{Duration: *credentials.CacheDuration}
+	}
 	response.APIVersion = credentialproviderV1.SchemeGroupVersion.String()
 	response.Kind = "CredentialProviderResponse"
 	log.Log(ctx, slog.LevelDebug, "Created response", "response", response)
@@ -66,10 +102,9 @@ func (k *KubeletCredentialProvider) Run(ctx context.Context, log logger.Logger)
 	return nil
 }
 
-func extractRegistryName(imageName string) (string, error) {
-	parts := strings.Split(imageName, "/")
-	if len(parts) < 2 {
-		return "", fmt.Errorf("no registry name found in image name: %s", imageName)
+func (k *KubeletCredentialProvider) cleanup(ctx context.Context, log logger.Logger) {
+	// errors are only logged, the response is already written
+	if err := k.credentialFetcher.Cleanup(ctx, log); err != nil {
+		log.Log(ctx, slog.LevelWarn, "Failed to cleanup credential fetcher", "error", err)
 	}
-	return parts[0], nil
 }
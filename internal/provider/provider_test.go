@@ -1,20 +1,32 @@
 package provider
 
 import (
+	"errors"
+	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/communicationInterface"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/config"
 	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/credentialFetcher"
 	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/logger"
+	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/vault"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	credentialproviderV1 "k8s.io/kubelet/pkg/apis/credentialprovider/v1"
 )
 
 func TestRun(t *testing.T) {
 	tests := []struct {
-		name       string
-		request    credentialproviderV1.CredentialProviderRequest
+		name    string
+		request credentialproviderV1.CredentialProviderRequest
+		// cacheDuration is returned by the credential fetcher
+		cacheDuration *time.Duration
+		cacheKeyType  config.CacheKeyType
+		aliases       []string
+		// fetchErr is returned by the credential fetcher instead of credentials
+		fetchErr   error
+		graceful   config.GracefulConfiguration
 		want       *credentialproviderV1.CredentialProviderResponse
 		wantErrMsg string
 	}{
@@ -44,7 +56,214 @@ func TestRun(t *testing.T) {
 			wantErrMsg: "",
 		},
 		{
-			name: "no registry in image",
+			name: "cache duration",
+			request: credentialproviderV1.CredentialProviderRequest{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderRequest",
+				},
+				Image:               "registry.example.com/my-image:latest",
+				ServiceAccountToken: "token",
+			},
+			cacheDuration: func() *time.Duration {
+				cacheDuration := 5 * time.Minute
+				return &cacheDuration
+			}(),
+			want: &credentialproviderV1.CredentialProviderResponse{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderResponse",
+				},
+				Auth: map[string]credentialproviderV1.AuthConfig{
+					"registry.example.com": {
+						Username: "user",
+						Password: "password",
+					},
+				},
+				CacheKeyType:  credentialproviderV1.RegistryPluginCacheKeyType,
+				CacheDuration: &metaV1.Duration{Duration: 5 * time.Minute},
+			},
+			wantErrMsg: "",
+		},
+		{
+			name: "image cache key type",
+			request: credentialproviderV1.CredentialProviderRequest{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderRequest",
+				},
+				Image:               "registry.example.com/team-a/my-image:latest@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+				ServiceAccountToken: "token",
+			},
+			cacheKeyType: config.CacheKeyTypeImage,
+			want: &credentialproviderV1.CredentialProviderResponse{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderResponse",
+				},
+				Auth: map[string]credentialproviderV1.AuthConfig{
+					"registry.example.com/team-a/my-image": {
+						Username: "user",
+						Password: "password",
+					},
+				},
+				CacheKeyType: credentialproviderV1.ImagePluginCacheKeyType,
+			},
+			wantErrMsg: "",
+		},
+		{
+			name: "aliases",
+			request: credentialproviderV1.CredentialProviderRequest{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderRequest",
+				},
+				Image:               "registry.example.com/team-a/my-image:latest",
+				ServiceAccountToken: "token",
+			},
+			aliases: []string{"mirror.example.com", "*.registry.example.com"},
+			want: &credentialproviderV1.CredentialProviderResponse{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderResponse",
+				},
+				Auth: map[string]credentialproviderV1.AuthConfig{
+					"registry.example.com":   {Username: "user", Password: "password"},
+					"mirror.example.com":     {Username: "user", Password: "password"},
+					"*.registry.example.com": {Username: "user", Password: "password"},
+				},
+				CacheKeyType: credentialproviderV1.RegistryPluginCacheKeyType,
+			},
+			wantErrMsg: "",
+		},
+		{
+			name: "aliases with image cache key type",
+			request: credentialproviderV1.CredentialProviderRequest{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderRequest",
+				},
+				Image:               "registry.example.com/team-a/my-image:latest",
+				ServiceAccountToken: "token",
+			},
+			cacheKeyType: config.CacheKeyTypeImage,
+			aliases:      []string{"mirror.example.com"},
+			want: &credentialproviderV1.CredentialProviderResponse{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderResponse",
+				},
+				Auth: map[string]credentialproviderV1.AuthConfig{
+					"registry.example.com/team-a/my-image": {Username: "user", Password: "password"},
+					"mirror.example.com/team-a/my-image":   {Username: "user", Password: "password"},
+				},
+				CacheKeyType: credentialproviderV1.ImagePluginCacheKeyType,
+			},
+			wantErrMsg: "",
+		},
+		{
+			name: "global cache key type",
+			request: credentialproviderV1.CredentialProviderRequest{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderRequest",
+				},
+				Image:               "registry.example.com/my-image:latest",
+				ServiceAccountToken: "token",
+			},
+			cacheKeyType: config.CacheKeyTypeGlobal,
+			want: &credentialproviderV1.CredentialProviderResponse{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderResponse",
+				},
+				Auth: map[string]credentialproviderV1.AuthConfig{
+					"registry.example.com": {
+						Username: "user",
+						Password: "password",
+					},
+				},
+				CacheKeyType: credentialproviderV1.GlobalPluginCacheKeyType,
+			},
+			wantErrMsg: "",
+		},
+		{
+			name: "docker hub short name",
+			request: credentialproviderV1.CredentialProviderRequest{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderRequest",
+				},
+				Image:               "my-image:latest",
+				ServiceAccountToken: "token",
+			},
+			want: &credentialproviderV1.CredentialProviderResponse{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderResponse",
+				},
+				Auth: map[string]credentialproviderV1.AuthConfig{
+					"docker.io": {
+						Username: "user",
+						Password: "password",
+					},
+				},
+				CacheKeyType: credentialproviderV1.RegistryPluginCacheKeyType,
+			},
+			wantErrMsg: "",
+		},
+		{
+			name: "docker hub organization",
+			request: credentialproviderV1.CredentialProviderRequest{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderRequest",
+				},
+				Image:               "myorg/my-image:latest",
+				ServiceAccountToken: "token",
+			},
+			want: &credentialproviderV1.CredentialProviderResponse{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderResponse",
+				},
+				Auth: map[string]credentialproviderV1.AuthConfig{
+					"docker.io": {
+						Username: "user",
+						Password: "password",
+					},
+				},
+				CacheKeyType: credentialproviderV1.RegistryPluginCacheKeyType,
+			},
+			wantErrMsg: "",
+		},
+		{
+			name: "legacy docker hub registry",
+			request: credentialproviderV1.CredentialProviderRequest{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderRequest",
+				},
+				Image:               "index.docker.io/library/my-image:latest",
+				ServiceAccountToken: "token",
+			},
+			want: &credentialproviderV1.CredentialProviderResponse{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderResponse",
+				},
+				Auth: map[string]credentialproviderV1.AuthConfig{
+					"docker.io": {
+						Username: "user",
+						Password: "password",
+					},
+				},
+				CacheKeyType: credentialproviderV1.RegistryPluginCacheKeyType,
+			},
+			wantErrMsg: "",
+		},
+		{
+			name: "docker hub image cache key type",
 			request: credentialproviderV1.CredentialProviderRequest{
 				TypeMeta: metaV1.TypeMeta{
 					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
@@ -53,8 +272,178 @@ func TestRun(t *testing.T) {
 				Image:               "my-image:latest",
 				ServiceAccountToken: "token",
 			},
+			cacheKeyType: config.CacheKeyTypeImage,
+			want: &credentialproviderV1.CredentialProviderResponse{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderResponse",
+				},
+				Auth: map[string]credentialproviderV1.AuthConfig{
+					"docker.io/library/my-image": {
+						Username: "user",
+						Password: "password",
+					},
+				},
+				CacheKeyType: credentialproviderV1.ImagePluginCacheKeyType,
+			},
+			wantErrMsg: "",
+		},
+		{
+			name: "registry with port",
+			request: credentialproviderV1.CredentialProviderRequest{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderRequest",
+				},
+				Image:               "localhost:5000/my-image:latest",
+				ServiceAccountToken: "token",
+			},
+			want: &credentialproviderV1.CredentialProviderResponse{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderResponse",
+				},
+				Auth: map[string]credentialproviderV1.AuthConfig{
+					"localhost:5000": {
+						Username: "user",
+						Password: "password",
+					},
+				},
+				CacheKeyType: credentialproviderV1.RegistryPluginCacheKeyType,
+			},
+			wantErrMsg: "",
+		},
+		{
+			name: "invalid image",
+			request: credentialproviderV1.CredentialProviderRequest{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderRequest",
+				},
+				Image:               "registry.example.com/My-Image:latest",
+				ServiceAccountToken: "token",
+			},
 			want:       nil,
-			wantErrMsg: "failed to extract registry name: no registry name found in image name: my-image:latest",
+			wantErrMsg: "failed to parse image: invalid reference format: repository name (My-Image) must be lowercase",
+		},
+		{
+			name: "graceful no credentials",
+			request: credentialproviderV1.CredentialProviderRequest{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderRequest",
+				},
+				Image:               "registry.example.com/my-image:latest",
+				ServiceAccountToken: "token",
+			},
+			fetchErr: fmt.Errorf("%w %s", credentialFetcher.ErrNoRegistryMatch, "registry.example.com/my-image:latest"),
+			graceful: config.GracefulConfiguration{Enabled: true, CacheDuration: time.Minute},
+			want: &credentialproviderV1.CredentialProviderResponse{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderResponse",
+				},
+				Auth:          map[string]credentialproviderV1.AuthConfig{},
+				CacheKeyType:  credentialproviderV1.ImagePluginCacheKeyType,
+				CacheDuration: &metaV1.Duration{Duration: time.Minute},
+			},
+			wantErrMsg: "",
+		},
+		{
+			name: "graceful missing secret",
+			request: credentialproviderV1.CredentialProviderRequest{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderRequest",
+				},
+				Image:               "registry.example.com/my-image:latest",
+				ServiceAccountToken: "token",
+			},
+			fetchErr: fmt.Errorf("failed to read secret from vault: %w", vault.ErrSecretNotFound),
+			graceful: config.GracefulConfiguration{Enabled: true},
+			want: &credentialproviderV1.CredentialProviderResponse{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderResponse",
+				},
+				Auth:          map[string]credentialproviderV1.AuthConfig{},
+				CacheKeyType:  credentialproviderV1.ImagePluginCacheKeyType,
+				CacheDuration: &metaV1.Duration{Duration: 0},
+			},
+			wantErrMsg: "",
+		},
+		{
+			name: "graceful missing secret with fallback to previous version",
+			request: credentialproviderV1.CredentialProviderRequest{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderRequest",
+				},
+				Image:               "registry.example.com/my-image:latest",
+				ServiceAccountToken: "token",
+			},
+			// the fallback reads the metadata after the secret was not found, which does not exist either
+			fetchErr: fmt.Errorf("failed to read credentials from vault: %w", errors.Join(
+				fmt.Errorf("failed to read secret: %w", vault.ErrSecretVersionNotFound),
+				fmt.Errorf("failed to read secret metadata: %w", vault.ErrSecretNotFound),
+			)),
+			graceful: config.GracefulConfiguration{Enabled: true},
+			want: &credentialproviderV1.CredentialProviderResponse{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderResponse",
+				},
+				Auth:          map[string]credentialproviderV1.AuthConfig{},
+				CacheKeyType:  credentialproviderV1.ImagePluginCacheKeyType,
+				CacheDuration: &metaV1.Duration{Duration: 0},
+			},
+			wantErrMsg: "",
+		},
+		{
+			name: "no credentials without graceful",
+			request: credentialproviderV1.CredentialProviderRequest{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderRequest",
+				},
+				Image:               "registry.example.com/my-image:latest",
+				ServiceAccountToken: "token",
+			},
+			fetchErr:   fmt.Errorf("%w for kubernetes auth method", credentialFetcher.ErrServiceAccountTokenRequired),
+			want:       nil,
+			wantErrMsg: "failed to fetch credentials: service account token is required for kubernetes auth method",
+		},
+		{
+			name: "graceful other error",
+			request: credentialproviderV1.CredentialProviderRequest{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderRequest",
+				},
+				Image:               "registry.example.com/my-image:latest",
+				ServiceAccountToken: "token",
+			},
+			fetchErr:   fmt.Errorf("failed to read secret from vault: permission denied"),
+			graceful:   config.GracefulConfiguration{Enabled: true, CacheDuration: time.Minute},
+			want:       nil,
+			wantErrMsg: "failed to fetch credentials: failed to read secret from vault: permission denied",
+		},
+		{
+			name: "graceful auth chain with vault outage",
+			request: credentialproviderV1.CredentialProviderRequest{
+				TypeMeta: metaV1.TypeMeta{
+					APIVersion: credentialproviderV1.SchemeGroupVersion.String(),
+					Kind:       "CredentialProviderRequest",
+				},
+				Image: "registry.example.com/my-image:latest",
+			},
+			fetchErr: fmt.Errorf("failed to setup vault client: %w", errors.Join(
+				fmt.Errorf("kubernetes: %w for kubernetes auth method", credentialFetcher.ErrServiceAccountTokenRequired),
+				errors.New("approle: failed to login: connection refused"),
+			)),
+			graceful:   config.GracefulConfiguration{Enabled: true, CacheDuration: time.Minute},
+			want:       nil,
+			wantErrMsg: "failed to fetch credentials: failed to setup vault client: kubernetes: service account token is required for kubernetes auth method\napprole: failed to login: connection refused",
 		},
 	}
 
@@ -62,17 +451,25 @@ func TestRun(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// mock dependencies
 			communicationInterface := communicationInterface.NewMockCommunicationInterface(&tt.request)
-			credentialFetcher := credentialFetcher.NewMockCredentialFetcher(&credentialproviderV1.AuthConfig{
-				Username: "user",
-				Password: "password",
+			fetcher := credentialFetcher.NewMockCredentialFetcherWithCredentials(&credentialFetcher.Credentials{
+				AuthConfig: &credentialproviderV1.AuthConfig{
+					Username: "user",
+					Password: "password",
+				},
+				CacheDuration: tt.cacheDuration,
+				CacheKeyType:  tt.cacheKeyType,
+				Aliases:       tt.aliases,
 			})
+			if tt.fetchErr != nil {
+				fetcher = credentialFetcher.NewMockCredentialFetcherWithError(tt.fetchErr)
+			}
 			logger, err := logger.NewFileLogger(false, "", "error")
 			if err != nil {
 				t.Fatalf("failed to create logger: %v", err)
 			}
 
 			// create KubeletCredentialProvider
-			provider := NewKubeletCredentialProvider(communicationInterface, credentialFetcher)
+			provider := NewKubeletCredentialProvider(communicationInterface, fetcher, &tt.graceful)
 
 			// run the provider
 			err = provider.Run(t.Context(), logger)
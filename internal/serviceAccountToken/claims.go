@@ -0,0 +1,50 @@
+package serviceAccountToken
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Claims contains the kubernetes specific claims of a projected service account token
+type Claims struct {
+	Subject    string           `json:"sub"`
+	Kubernetes KubernetesClaims `json:"kubernetes.io"`
+}
+
+type KubernetesClaims struct {
+	Namespace      string        `json:"namespace"`
+	ServiceAccount IdentityClaim `json:"serviceaccount"`
+	Pod            IdentityClaim `json:"pod"`
+}
+
+type IdentityClaim struct {
+	Name string `json:"name"`
+	UID  string `json:"uid"`
+}
+
+// ParseClaims decodes the claims of the service account token.
+// The signature is not verified, the claims must only be used to select configuration, never to authorize requests.
+// The token itself is verified by vault during the login.
+func ParseClaims(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("token is not a jwt")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode token payload: %w", err)
+	}
+
+	claims := &Claims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal token claims: %w", err)
+	}
+	if claims.Kubernetes.Namespace == "" {
+		return nil, fmt.Errorf("token does not contain a kubernetes namespace claim")
+	}
+
+	return claims, nil
+}
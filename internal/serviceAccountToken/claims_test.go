@@ -0,0 +1,71 @@
+package serviceAccountToken
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+)
+
+func newTestToken(payload string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","kid":"example"}`))
+	return header + "." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".signature"
+}
+
+func TestParseClaims(t *testing.T) {
+	tests := []struct {
+		name       string
+		token      string
+		want       *Claims
+		wantErrMsg string
+	}{
+		{
+			name:  "projected service account token",
+			token: newTestToken(`{"aud":["example"],"sub":"system:serviceaccount:team-a:puller","kubernetes.io":{"namespace":"team-a","serviceaccount":{"name":"puller","uid":"1234"},"pod":{"name":"app-0","uid":"5678"}}}`),
+			want: &Claims{
+				Subject: "system:serviceaccount:team-a:puller",
+				Kubernetes: KubernetesClaims{
+					Namespace: "team-a",
+					ServiceAccount: IdentityClaim{
+						Name: "puller",
+						UID:  "1234",
+					},
+					Pod: IdentityClaim{
+						Name: "app-0",
+						UID:  "5678",
+					},
+				},
+			},
+			wantErrMsg: "",
+		},
+		{
+			name:       "no jwt",
+			token:      "token",
+			want:       nil,
+			wantErrMsg: "token is not a jwt",
+		},
+		{
+			name:       "invalid payload encoding",
+			token:      "header.!!!.signature",
+			want:       nil,
+			wantErrMsg: "failed to decode token payload: illegal base64 data at input byte 0",
+		},
+		{
+			name:       "missing kubernetes claims",
+			token:      newTestToken(`{"sub":"example"}`),
+			want:       nil,
+			wantErrMsg: "token does not contain a kubernetes namespace claim",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseClaims(tt.token)
+			if err != nil && err.Error() != tt.wantErrMsg {
+				t.Errorf("unexpected error: got %v, want %v", err, tt.wantErrMsg)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unexpected claims: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
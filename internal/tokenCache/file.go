@@ -0,0 +1,261 @@
+package tokenCache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	keySize       = 32
+	entryFileExt  = ".token"
+	directoryMode = 0o700
+	fileMode      = 0o600
+	// expireTimeSize is the size of the unencrypted expire time in front of every entry
+	expireTimeSize = 8
+)
+
+// FileTokenCache stores every entry AES-GCM encrypted in its own file, readable by the owner only.
+// The encryption key is read from the key file, which is created on first use. The key file must be outside of
+// the directory (e.g. on another volume), otherwise a copy of the directory would contain the key of its entries.
+// The expire time of an entry is also stored unencrypted in front of it, so expired entries can be removed without
+// knowing their key (it is only used for the removal, the expire time of Get is taken from the encrypted entry).
+type FileTokenCache struct {
+	directory string
+	keyFile   string
+}
+
+func NewFileTokenCache(directory string, keyFile string) TokenCache {
+	return &FileTokenCache{
+		directory: directory,
+		keyFile:   keyFile,
+	}
+}
+
+func (c *FileTokenCache) Get(key string) (*Entry, error) {
+	data, err := os.ReadFile(c.entryFile(key))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read cache entry: %w", err)
+	}
+
+	aead, err := c.aead()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < expireTimeSize+aead.NonceSize() {
+		return nil, fmt.Errorf("cache entry is too short")
+	}
+	data = data[expireTimeSize:]
+	// the key is used as additional data, so an entry can not be moved to another key
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt cache entry: %w", err)
+	}
+
+	entry := &Entry{}
+	if err := json.Unmarshal(plaintext, entry); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cache entry: %w", err)
+	}
+	return entry, nil
+}
+
+func (c *FileTokenCache) Set(key string, entry *Entry) error {
+	plaintext, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache entry: %w", err)
+	}
+
+	aead, err := c.aead()
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	data := binary.BigEndian.AppendUint64(nil, expireTimeUnix(entry.ExpireTime))
+	data = append(data, nonce...)
+	data = aead.Seal(data, nonce, plaintext, []byte(key))
+
+	// write to a temporary file first, so concurrent invocations never read a partial entry
+	tmpFile, err := os.CreateTemp(c.directory, "*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create cache entry: %w", err)
+	}
+	// nolint:errcheck
+	defer os.Remove(tmpFile.Name()) //gosec:disable G104
+	if _, err := tmpFile.Write(data); err != nil {
+		// nolint:errcheck
+		tmpFile.Close() //gosec:disable G104
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := os.Rename(tmpFile.Name(), c.entryFile(key)); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+
+	// expired entries are removed, so the cache does not grow with tokens that are not used again
+	c.removeExpired(time.Now())
+	return nil
+}
+
+func (c *FileTokenCache) Delete(key string) error {
+	if err := os.Remove(c.entryFile(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete cache entry: %w", err)
+	}
+	return nil
+}
+
+// removeExpired removes the entries that expired before now, entries that can not be read are kept
+func (c *FileTokenCache) removeExpired(now time.Time) {
+	files, err := os.ReadDir(c.directory)
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), entryFileExt) {
+			continue
+		}
+		path := filepath.Join(c.directory, file.Name())
+		expireTime, err := readExpireTimeUnix(path)
+		if err != nil || expireTime == 0 || expireTime > uint64(now.Unix()) {
+			continue
+		}
+		// nolint:errcheck
+		os.Remove(path) //gosec:disable G104
+	}
+}
+
+// expireTimeUnix returns the expire time in seconds since the epoch, zero if the token does not expire
+func expireTimeUnix(expireTime time.Time) uint64 {
+	if expireTime.IsZero() {
+		return 0
+	}
+	return uint64(max(expireTime.Unix(), 1))
+}
+
+func readExpireTimeUnix(path string) (uint64, error) {
+	file, err := os.Open(path) //gosec:disable G304
+	if err != nil {
+		return 0, err
+	}
+	// nolint:errcheck
+	defer file.Close() //gosec:disable G104
+	data := make([]byte, expireTimeSize)
+	if _, err := io.ReadFull(file, data); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(data), nil
+}
+
+// entryFile returns the file of the entry, the key is hashed because it contains arbitrary characters
+func (c *FileTokenCache) entryFile(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(c.directory, hex.EncodeToString(hash[:])+entryFileExt)
+}
+
+func (c *FileTokenCache) aead() (cipher.AEAD, error) {
+	key, err := c.loadOrCreateKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return aead, nil
+}
+
+func (c *FileTokenCache) loadOrCreateKey() ([]byte, error) {
+	if err := os.MkdirAll(c.directory, directoryMode); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	if err := checkOwnerOnly(c.directory); err != nil {
+		return nil, err
+	}
+
+	key, err := c.readKey()
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return key, err
+	}
+	key, err = c.createKey()
+	if errors.Is(err, fs.ErrExist) {
+		// created by a concurrent invocation
+		return c.readKey()
+	}
+	return key, err
+}
+
+func (c *FileTokenCache) readKey() ([]byte, error) {
+	if err := checkOwnerOnly(c.keyFile); err != nil {
+		return nil, err
+	}
+	key, err := os.ReadFile(c.keyFile) //gosec:disable G304
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache key: %w", err)
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("cache key must be %d bytes", keySize)
+	}
+	return key, nil
+}
+
+// createKey writes the key to a temporary file and links it into place, so concurrent invocations never read a partial key.
+// Unlike a rename, the link fails with fs.ErrExist instead of overwriting a key created by a concurrent invocation.
+func (c *FileTokenCache) createKey() ([]byte, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate cache key: %w", err)
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(c.keyFile), filepath.Base(c.keyFile)+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache key: %w", err)
+	}
+	// nolint:errcheck
+	defer os.Remove(tmpFile.Name()) //gosec:disable G104
+	if _, err := tmpFile.Write(key); err != nil {
+		// nolint:errcheck
+		tmpFile.Close() //gosec:disable G104
+		return nil, fmt.Errorf("failed to write cache key: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write cache key: %w", err)
+	}
+	if err := os.Link(tmpFile.Name(), c.keyFile); err != nil {
+		return nil, fmt.Errorf("failed to create cache key: %w", err)
+	}
+	return key, nil
+}
+
+// checkOwnerOnly makes sure the cache is not accessible by other users
+func checkOwnerOnly(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		return fmt.Errorf("%s must only be accessible by its owner, mode is %s", path, info.Mode().Perm())
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package tokenCache
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileTokenCache(t *testing.T) {
+	directory := filepath.Join(t.TempDir(), "cache")
+	cache := NewFileTokenCache(directory, filepath.Join(t.TempDir(), "key"))
+
+	entry, err := cache.Get("kubernetes/example")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entry != nil {
+		t.Fatalf("unexpected entry: got %v, want nil", entry)
+	}
+
+	want := &Entry{
+		Token:      "hvs.example",
+		ExpireTime: time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC),
+		Renewable:  true,
+	}
+	if err := cache.Set("kubernetes/example", want); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := cache.Get("kubernetes/example")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected entry: got %v, want %v", got, want)
+	}
+
+	// token must not be stored in plain text and files must only be accessible by the owner
+	files, err := os.ReadDir(directory)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, file := range files {
+		path := filepath.Join(directory, file.Name())
+		if err := checkOwnerOnly(path); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if bytes.Contains(data, []byte(want.Token)) {
+			t.Errorf("token is stored in plain text in %s", file.Name())
+		}
+	}
+
+	if err := cache.Delete("kubernetes/example"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	entry, err = cache.Get("kubernetes/example")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entry != nil {
+		t.Errorf("unexpected entry after delete: got %v, want nil", entry)
+	}
+}
+
+func TestFileTokenCacheRemovesExpiredEntries(t *testing.T) {
+	cache := NewFileTokenCache(filepath.Join(t.TempDir(), "cache"), filepath.Join(t.TempDir(), "key"))
+	entries := map[string]*Entry{
+		"expired":        {Token: "hvs.expired", ExpireTime: time.Now().Add(-time.Minute)},
+		"valid":          {Token: "hvs.valid", ExpireTime: time.Now().Add(time.Hour)},
+		"without expiry": {Token: "hvs.root"},
+	}
+	for _, key := range []string{"expired", "valid", "without expiry"} {
+		if err := cache.Set(key, entries[key]); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// the expired entry is removed by the following set
+	for key, want := range map[string]*Entry{"expired": nil, "valid": entries["valid"], "without expiry": entries["without expiry"]} {
+		got, err := cache.Get(key)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want == nil && got != nil {
+			t.Errorf("expired entry %s is not removed", key)
+		}
+		if want != nil && (got == nil || got.Token != want.Token) {
+			t.Errorf("unexpected entry %s: got %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestFileTokenCacheConcurrentKeyCreation(t *testing.T) {
+	directory := filepath.Join(t.TempDir(), "cache")
+	keyDirectory := t.TempDir()
+	keyFile := filepath.Join(keyDirectory, "key")
+
+	// every invocation must end up with the same, complete key
+	keys := make([][]byte, 10)
+	errs := make([]error, len(keys))
+	var wg sync.WaitGroup
+	for i := range keys {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			keys[i], errs[i] = NewFileTokenCache(directory, keyFile).(*FileTokenCache).loadOrCreateKey()
+		}()
+	}
+	wg.Wait()
+
+	for i := range keys {
+		if errs[i] != nil {
+			t.Fatalf("unexpected error: %v", errs[i])
+		}
+		if !bytes.Equal(keys[i], keys[0]) {
+			t.Errorf("unexpected key of invocation %d: got %x, want %x", i, keys[i], keys[0])
+		}
+	}
+	files, err := os.ReadDir(keyDirectory)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(files) != 1 {
+		t.Errorf("temporary key files are not removed: %v", files)
+	}
+}
+
+func TestFileTokenCacheErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		setup      func(t *testing.T, cache *FileTokenCache)
+		wantErrMsg string
+	}{
+		{
+			name: "key file accessible by others",
+			setup: func(t *testing.T, cache *FileTokenCache) {
+				if err := os.WriteFile(cache.keyFile, make([]byte, keySize), 0o644); err != nil {
+					t.Fatalf("failed to write key file: %v", err)
+				}
+				if err := os.WriteFile(cache.entryFile("example"), []byte("entry"), 0o600); err != nil {
+					t.Fatalf("failed to write entry: %v", err)
+				}
+			},
+			wantErrMsg: "key must only be accessible by its owner, mode is -rw-r--r--",
+		},
+		{
+			name: "invalid key size",
+			setup: func(t *testing.T, cache *FileTokenCache) {
+				if err := os.WriteFile(cache.keyFile, []byte("key"), 0o600); err != nil {
+					t.Fatalf("failed to write key file: %v", err)
+				}
+				if err := os.WriteFile(cache.entryFile("example"), []byte("entry"), 0o600); err != nil {
+					t.Fatalf("failed to write entry: %v", err)
+				}
+			},
+			wantErrMsg: "cache key must be 32 bytes",
+		},
+		{
+			name: "entry moved to another key",
+			setup: func(t *testing.T, cache *FileTokenCache) {
+				if err := cache.Set("other", &Entry{Token: "hvs.example"}); err != nil {
+					t.Fatalf("failed to set entry: %v", err)
+				}
+				if err := os.Rename(cache.entryFile("other"), cache.entryFile("example")); err != nil {
+					t.Fatalf("failed to move entry: %v", err)
+				}
+			},
+			wantErrMsg: "failed to decrypt cache entry: cipher: message authentication failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			directory := filepath.Join(t.TempDir(), "cache")
+			if err := os.Mkdir(directory, directoryMode); err != nil {
+				t.Fatalf("failed to create cache directory: %v", err)
+			}
+			cache := NewFileTokenCache(directory, filepath.Join(t.TempDir(), "key")).(*FileTokenCache)
+			tt.setup(t, cache)
+
+			_, err := cache.Get("example")
+			if err == nil || !strings.HasSuffix(err.Error(), tt.wantErrMsg) {
+				t.Errorf("unexpected error: got %v, want %v", err, tt.wantErrMsg)
+			}
+		})
+	}
+}
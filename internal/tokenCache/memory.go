@@ -0,0 +1,51 @@
+package tokenCache
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryTokenCache keeps the entries in memory, so it is only useful for a long running process like the daemon.
+// It is safe for concurrent use.
+type MemoryTokenCache struct {
+	mu      sync.Mutex
+	entries map[string]Entry
+}
+
+func NewMemoryTokenCache() TokenCache {
+	return &MemoryTokenCache{
+		entries: map[string]Entry{},
+	}
+}
+
+func (c *MemoryTokenCache) Get(key string) (*Entry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	// a copy is returned, so callers can not modify the cached entry
+	return &entry, nil
+}
+
+func (c *MemoryTokenCache) Set(key string, entry *Entry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// expired entries are removed, so the cache does not grow with tokens that are not used again
+	now := time.Now()
+	for k, cached := range c.entries {
+		if !cached.ExpireTime.IsZero() && !cached.ExpireTime.After(now) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = *entry
+	return nil
+}
+
+func (c *MemoryTokenCache) Delete(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+	return nil
+}
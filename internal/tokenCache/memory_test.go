@@ -0,0 +1,82 @@
+package tokenCache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMemoryTokenCache(t *testing.T) {
+	cache := NewMemoryTokenCache()
+
+	entry, err := cache.Get("kubernetes/example")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entry != nil {
+		t.Fatalf("unexpected entry: got %v, want nil", entry)
+	}
+
+	want := &Entry{
+		Token:      "hvs.example",
+		ExpireTime: time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC),
+		Renewable:  true,
+	}
+	if err := cache.Set("kubernetes/example", want); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := cache.Get("kubernetes/example")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected entry: got %v, want %v", got, want)
+	}
+
+	// modifying the returned entry must not modify the cache
+	got.Token = "hvs.modified"
+	got, err = cache.Get("kubernetes/example")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Token != want.Token {
+		t.Errorf("unexpected token: got %s, want %s", got.Token, want.Token)
+	}
+
+	if err := cache.Delete("kubernetes/example"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	entry, err = cache.Get("kubernetes/example")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entry != nil {
+		t.Errorf("unexpected entry after delete: got %v, want nil", entry)
+	}
+}
+
+func TestMemoryTokenCacheRemovesExpiredEntries(t *testing.T) {
+	cache := NewMemoryTokenCache()
+	if err := cache.Set("expired", &Entry{Token: "hvs.expired", ExpireTime: time.Now().Add(-time.Minute)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := cache.Set("without expiry", &Entry{Token: "hvs.root"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the expired entry is removed by the following set
+	entry, err := cache.Get("expired")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entry != nil {
+		t.Errorf("expired entry is not removed: %v", entry)
+	}
+	entry, err = cache.Get("without expiry")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entry == nil {
+		t.Errorf("entry without expiry is removed")
+	}
+}
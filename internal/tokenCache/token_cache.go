@@ -0,0 +1,27 @@
+package tokenCache
+
+import (
+	"time"
+)
+
+// Entry is a cached vault token or the secret of a response-wrapping token (e.g. an unwrapped token or approle secret id)
+type Entry struct {
+	Token string `json:"token"`
+	// ExpireTime is zero if the token does not expire
+	ExpireTime time.Time `json:"expireTime"`
+	Renewable  bool      `json:"renewable"`
+	// WrappingTokenHash identifies the wrapping token the secret was unwrapped from, it is empty for tokens of a login
+	WrappingTokenHash string `json:"wrappingTokenHash,omitempty"`
+}
+
+// TTL returns the remaining ttl of the token at the given time
+func (e *Entry) TTL(now time.Time) time.Duration {
+	return e.ExpireTime.Sub(now)
+}
+
+type TokenCache interface {
+	// Get returns the cached entry for the key or nil if there is no entry
+	Get(key string) (*Entry, error)
+	Set(key string, entry *Entry) error
+	Delete(key string) error
+}
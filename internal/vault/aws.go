@@ -0,0 +1,72 @@
+package vault
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsSignerV4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsConfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/hashicorp/vault-client-go/schema"
+)
+
+const (
+	DefaultAWSRegion      = "us-east-1"
+	DefaultAWSSTSEndpoint = "https://sts.amazonaws.com"
+
+	awsGetCallerIdentityBody = "Action=GetCallerIdentity&Version=2011-06-15"
+	awsIAMServerIDHeader     = "X-Vault-AWS-IAM-Server-ID"
+)
+
+// newAWSLoginRequest builds the login request for the vault aws auth method (iam type)
+// using the credentials of the default credential chain (environment, shared config, instance profile, ...)
+func newAWSLoginRequest(ctx context.Context, role string, region string, stsEndpoint string, headerValue string) (*schema.AwsLoginRequest, error) {
+	cfg, err := awsConfig.LoadDefaultConfig(ctx, awsConfig.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load aws config: %w", err)
+	}
+	credentials, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve aws credentials: %w", err)
+	}
+	return signAWSLoginRequest(ctx, credentials, role, region, stsEndpoint, headerValue, time.Now())
+}
+
+func signAWSLoginRequest(ctx context.Context, credentials aws.Credentials, role string, region string, stsEndpoint string, headerValue string, signingTime time.Time) (*schema.AwsLoginRequest, error) {
+	// build sts:GetCallerIdentity request, vault forwards it to sts to verify the identity
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, stsEndpoint, strings.NewReader(awsGetCallerIdentityBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sts request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	if headerValue != "" {
+		req.Header.Set(awsIAMServerIDHeader, headerValue)
+	}
+
+	// sign request
+	payloadHash := sha256.Sum256([]byte(awsGetCallerIdentityBody))
+	err = awsSignerV4.NewSigner().SignHTTP(ctx, credentials, req, hex.EncodeToString(payloadHash[:]), "sts", region, signingTime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign sts request: %w", err)
+	}
+
+	headers, err := json.Marshal(req.Header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal sts request headers: %w", err)
+	}
+
+	return &schema.AwsLoginRequest{
+		IamHttpRequestMethod: http.MethodPost,
+		IamRequestUrl:        base64.StdEncoding.EncodeToString([]byte(stsEndpoint)),
+		IamRequestBody:       base64.StdEncoding.EncodeToString([]byte(awsGetCallerIdentityBody)),
+		IamRequestHeaders:    base64.StdEncoding.EncodeToString(headers),
+		Role:                 role,
+	}, nil
+}
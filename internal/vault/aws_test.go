@@ -0,0 +1,133 @@
+package vault
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestSignAWSLoginRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		stsEndpoint string
+		headerValue string
+		wantHeader  string
+	}{
+		{
+			name:        "default endpoint",
+			stsEndpoint: DefaultAWSSTSEndpoint,
+			headerValue: "",
+			wantHeader:  "",
+		},
+		{
+			name:        "custom endpoint with server id header",
+			stsEndpoint: "http://localhost:4566",
+			headerValue: "vault.example.com",
+			wantHeader:  "vault.example.com",
+		},
+	}
+
+	credentials := aws.Credentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := signAWSLoginRequest(t.Context(), credentials, "example", DefaultAWSRegion, tt.stsEndpoint, tt.headerValue, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got.IamHttpRequestMethod != http.MethodPost {
+				t.Errorf("unexpected method: got %v, want %v", got.IamHttpRequestMethod, http.MethodPost)
+			}
+			if got.Role != "example" {
+				t.Errorf("unexpected role: got %v, want %v", got.Role, "example")
+			}
+			if url, _ := base64.StdEncoding.DecodeString(got.IamRequestUrl); string(url) != tt.stsEndpoint {
+				t.Errorf("unexpected url: got %v, want %v", string(url), tt.stsEndpoint)
+			}
+			if body, _ := base64.StdEncoding.DecodeString(got.IamRequestBody); string(body) != awsGetCallerIdentityBody {
+				t.Errorf("unexpected body: got %v, want %v", string(body), awsGetCallerIdentityBody)
+			}
+
+			rawHeaders, _ := base64.StdEncoding.DecodeString(got.IamRequestHeaders)
+			headers := http.Header{}
+			if err := json.Unmarshal(rawHeaders, &headers); err != nil {
+				t.Fatalf("failed to unmarshal headers: %v", err)
+			}
+			if !strings.HasPrefix(headers.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20250101/us-east-1/sts/aws4_request") {
+				t.Errorf("unexpected authorization header: got %v", headers.Get("Authorization"))
+			}
+			if headers.Get(awsIAMServerIDHeader) != tt.wantHeader {
+				t.Errorf("unexpected server id header: got %v, want %v", headers.Get(awsIAMServerIDHeader), tt.wantHeader)
+			}
+			if tt.wantHeader != "" && !strings.Contains(headers.Get("Authorization"), strings.ToLower(awsIAMServerIDHeader)) {
+				t.Errorf("server id header is not signed: got %v", headers.Get("Authorization"))
+			}
+		})
+	}
+}
+
+func TestBuildAWSAuth(t *testing.T) {
+	// static credentials of the environment, the default credential chain must not reach the instance metadata service
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+
+	tests := []struct {
+		name       string
+		response   fakeVaultResponse
+		want       TokenInfo
+		wantErrMsg string
+	}{
+		{
+			name:     "login",
+			response: fakeVaultResponse{status: http.StatusOK, body: `{"data":null,"auth":{"client_token":"hvs.aws","lease_duration":3600,"renewable":true}}`},
+			want:     TokenInfo{Token: "hvs.aws", TTL: time.Hour, Renewable: true},
+		},
+		{
+			name:       "login without auth",
+			response:   fakeVaultResponse{status: http.StatusOK, body: `{"data":{}}`},
+			wantErrMsg: "aws login response does not contain auth information",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vault, address := newFakeVault(t, map[string]fakeVaultResponse{"/v1/auth/aws/login": tt.response})
+
+			client, err := NewHashicorpClientBuilder().
+				WithAddress(address).
+				WithAWSAuth("aws", "node", "", "", "").
+				Build(t.Context())
+			if tt.wantErrMsg != "" {
+				if err == nil || err.Error() != tt.wantErrMsg {
+					t.Fatalf("expected error %q, got %v", tt.wantErrMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			checkTokenInfo(t, client.Token(), tt.want)
+
+			loginRequest := vault.request("/v1/auth/aws/login")
+			if loginRequest == nil {
+				t.Fatalf("no login request")
+			}
+			if loginRequest.body["role"] != "node" || loginRequest.body["iam_http_request_method"] != http.MethodPost {
+				t.Errorf("unexpected login request: %v", loginRequest.body)
+			}
+		})
+	}
+}
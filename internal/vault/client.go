@@ -1,23 +1,95 @@
 package vault
 
-import "context"
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrSecretVersionNotFound is returned if the requested secret version does not exist or is deleted or destroyed
+var ErrSecretVersionNotFound = errors.New("secret version not found")
+
+// ErrSecretNotFound is returned if the secret does not exist (secrets of kv v2 return ErrSecretVersionNotFound)
+var ErrSecretNotFound = errors.New("secret not found")
 
 type ClientBuilder interface {
 	WithAddress(address string) ClientBuilder
 	InsecureSkipVerify(insecureSkipVerify bool) ClientBuilder
+	WithCACert(caCertFile string) ClientBuilder
+	WithTLSServerName(serverName string) ClientBuilder
+	WithNamespace(namespace string) ClientBuilder
 	WithKubernetesAuth(mount string, role string, serviceAccountToken string) ClientBuilder
+	WithJWTAuth(mount string, role string, serviceAccountToken string) ClientBuilder
+	WithAppRoleAuth(mount string, roleID string, secretID string, secretIDWrapped bool) ClientBuilder
+	WithCertAuth(mount string, role string, certFile string, keyFile string) ClientBuilder
+	WithTokenAuth(token string, wrapped bool, lookupSelf bool, minTTL time.Duration) ClientBuilder
+	WithAgentAuth() ClientBuilder
+	WithAWSAuth(mount string, role string, region string, stsEndpoint string, headerValue string) ClientBuilder
+	// WithUnwrapCache keeps the secrets of wrapping tokens, so wrapping tokens that are read again are not unwrapped again
+	WithUnwrapCache(cache UnwrapCache) ClientBuilder
 	validate() error
 	Build(ctx context.Context) (Client, error)
 }
 
+// UnwrapCache keeps the secrets of response-wrapping tokens, because a wrapping token can only be unwrapped once
+// (e.g. a vault agent only rewrites its sink on re-auth, so every invocation reads the same wrapping token)
+type UnwrapCache interface {
+	// Get returns the secret of the wrapping token or an empty string if it is not cached
+	Get(wrappingToken string) string
+	Set(wrappingToken string, secret string)
+}
+
 type Client interface {
 	Secrets() SecretsClient
+	// Token returns the token the client is authenticated with (empty if the token is injected by a vault agent)
+	Token() TokenInfo
+	RenewToken(ctx context.Context) (TokenInfo, error)
+	// RevokeToken revokes the token if it was created by the login of the client, tokens passed to the client are not revoked
+	RevokeToken(ctx context.Context) error
+	// CloseIdleConnections closes the idle connections of the client, e.g. when it is not used anymore
+	CloseIdleConnections()
+}
+
+type TokenInfo struct {
+	Token string
+	// TTL is the ttl at login or lookup, it is zero if the ttl is unknown or the token does not expire
+	TTL time.Duration
+	// ExpireTime is zero if the ttl is unknown or the token does not expire, unlike TTL it stays correct while a client is reused
+	ExpireTime time.Time
+	Renewable  bool
 }
 
 type SecretsClient interface {
+	KvV1(mount string, path string) SecretKvV1Client
 	KvV2(mount string, path string) SecretKvV2Client
+	// Generic reads <mount>/<path> with a plain logical read, e.g. for dynamic secrets engines and plugins
+	Generic(mount string, path string) SecretGenericClient
 }
 
-type SecretKvV2Client interface {
+type SecretKvV1Client interface {
 	Read(ctx context.Context) (map[string]any, error)
 }
+
+type SecretGenericClient interface {
+	Read(ctx context.Context) (*Secret, error)
+}
+
+// Secret is the response of a logical read
+type Secret struct {
+	Data map[string]any
+	// LeaseDuration is zero if the secret has no lease (e.g. static secrets)
+	LeaseDuration time.Duration
+}
+
+type SecretKvV2Client interface {
+	// Read reads the given version of the secret, version 0 reads the latest version
+	Read(ctx context.Context, version int) (map[string]any, error)
+	ReadMetadata(ctx context.Context) (*SecretKvV2Metadata, error)
+}
+
+type SecretKvV2Metadata struct {
+	CurrentVersion int
+	// AvailableVersions are the versions that are neither deleted nor destroyed, sorted in ascending order
+	AvailableVersions []int
+	CustomMetadata    map[string]string
+}
@@ -2,22 +2,117 @@ package vault
 
 import (
 	"context"
+	"fmt"
+	"slices"
+	"time"
 )
 
 type MockClientBuilder struct {
 	address             *string
 	insecureSkipVerify  *bool
+	caCertFile          *string
+	tlsServerName       *string
+	namespace           *string
 	mount               *string
 	role                *string
 	serviceAccountToken *string
+	roleID              *string
+	secretID            *string
+	secretIDWrapped     *bool
+	certFile            *string
+	keyFile             *string
+	token               *string
+	tokenWrapped        *bool
+	tokenLookupSelf     *bool
+	tokenMinTTL         *time.Duration
+	awsRegion           *string
+	awsSTSEndpoint      *string
+	awsHeaderValue      *string
+	tokenAuth           bool
+	login               MockLogin
 
-	mockSecretResponse map[string]any
+	mockSecretVersions       map[int]map[string]any
+	mockSecretLeaseDuration  time.Duration
+	mockSecretCustomMetadata map[string]string
+	mockSecretMetadataError  error
+	mockTokenTTL             time.Duration
+	mockTokenExpireTime      time.Time
+	mockLoginErrors          map[HashiCorpClientAuthMethod]error
+	mockWrappedSecrets       map[string]string
+	unwrapCache              UnwrapCache
+	// built is set by the first build, builders keep the state of their options and must not be reused
+	built bool
+}
+
+// MockLogin is the auth method a mock client was built with
+type MockLogin struct {
+	Method              HashiCorpClientAuthMethod
+	Mount               string
+	Role                string
+	ServiceAccountToken string
+	// SecretID is the unwrapped secret id of the approle auth method
+	SecretID string
 }
 
 func NewMockClientBuilder(mockSecretResponse map[string]any) ClientBuilder {
+	return NewMockClientBuilderWithSecretVersions(map[int]map[string]any{
+		1: mockSecretResponse,
+	})
+}
+
+// NewMockClientBuilderWithSecretVersions returns a builder for clients that return the given kv v2 secret versions,
+// the highest version is the latest one and versions without data are treated as deleted
+func NewMockClientBuilderWithSecretVersions(mockSecretVersions map[int]map[string]any) ClientBuilder {
 	return &MockClientBuilder{
-		mockSecretResponse: mockSecretResponse,
+		mockSecretVersions: mockSecretVersions,
+		mockTokenTTL:       time.Hour,
+	}
+}
+
+// WithMockSecretLeaseDuration sets the lease duration of secrets returned by generic reads
+func (b *MockClientBuilder) WithMockSecretLeaseDuration(leaseDuration time.Duration) *MockClientBuilder {
+	b.mockSecretLeaseDuration = leaseDuration
+	return b
+}
+
+// WithMockSecretCustomMetadata sets the custom metadata of kv v2 secrets
+func (b *MockClientBuilder) WithMockSecretCustomMetadata(customMetadata map[string]string) *MockClientBuilder {
+	b.mockSecretCustomMetadata = customMetadata
+	return b
+}
+
+// WithMockSecretMetadataError lets reads of the kv v2 metadata fail, e.g. to simulate policies that only grant data/
+func (b *MockClientBuilder) WithMockSecretMetadataError(err error) *MockClientBuilder {
+	b.mockSecretMetadataError = err
+	return b
+}
+
+// WithMockTokenTTL sets the ttl of tokens created by logins, zero means the token does not expire
+func (b *MockClientBuilder) WithMockTokenTTL(ttl time.Duration) *MockClientBuilder {
+	b.mockTokenTTL = ttl
+	return b
+}
+
+// WithMockTokenExpireTime overrides the expire time of tokens, e.g. to simulate a reused client whose token was created earlier
+func (b *MockClientBuilder) WithMockTokenExpireTime(expireTime time.Time) *MockClientBuilder {
+	b.mockTokenExpireTime = expireTime
+	return b
+}
+
+// WithMockLoginError lets logins with the given auth method fail
+func (b *MockClientBuilder) WithMockLoginError(method HashiCorpClientAuthMethod, err error) *MockClientBuilder {
+	if b.mockLoginErrors == nil {
+		b.mockLoginErrors = map[HashiCorpClientAuthMethod]error{}
 	}
+	b.mockLoginErrors[method] = err
+	return b
+}
+
+// WithMockWrappedSecrets sets the secrets of wrapping tokens, like in vault a wrapping token is removed when it is unwrapped
+// (the map is shared, so builders of the same map can only unwrap every wrapping token once)
+func (b *MockClientBuilder) WithMockWrappedSecrets(secrets map[string]string) *MockClientBuilder {
+	b.mockWrappedSecrets = secrets
+	return b
 }
 
 func (b *MockClientBuilder) WithAddress(address string) ClientBuilder {
@@ -30,28 +125,175 @@ func (b *MockClientBuilder) InsecureSkipVerify(insecureSkipVerify bool) ClientBu
 	return b
 }
 
+func (b *MockClientBuilder) WithCACert(caCertFile string) ClientBuilder {
+	b.caCertFile = &caCertFile
+	return b
+}
+
+func (b *MockClientBuilder) WithTLSServerName(serverName string) ClientBuilder {
+	b.tlsServerName = &serverName
+	return b
+}
+
+func (b *MockClientBuilder) WithNamespace(namespace string) ClientBuilder {
+	b.namespace = &namespace
+	return b
+}
+
 func (b *MockClientBuilder) WithKubernetesAuth(mount string, role string, serviceAccountToken string) ClientBuilder {
+	b.tokenAuth = false
+	b.login = MockLogin{Method: HashiCorpClientAuthMethodKubernetes, Mount: mount, Role: role, ServiceAccountToken: serviceAccountToken}
+	b.mount = &mount
+	b.role = &role
+	b.serviceAccountToken = &serviceAccountToken
+	return b
+}
+
+func (b *MockClientBuilder) WithJWTAuth(mount string, role string, serviceAccountToken string) ClientBuilder {
+	b.tokenAuth = false
+	b.login = MockLogin{Method: HashiCorpClientAuthMethodJWT, Mount: mount, Role: role, ServiceAccountToken: serviceAccountToken}
 	b.mount = &mount
 	b.role = &role
 	b.serviceAccountToken = &serviceAccountToken
 	return b
 }
 
+func (b *MockClientBuilder) WithAppRoleAuth(mount string, roleID string, secretID string, secretIDWrapped bool) ClientBuilder {
+	b.tokenAuth = false
+	b.login = MockLogin{Method: HashiCorpClientAuthMethodAppRole, Mount: mount, SecretID: secretID}
+	b.mount = &mount
+	b.roleID = &roleID
+	b.secretID = &secretID
+	b.secretIDWrapped = &secretIDWrapped
+	return b
+}
+
+func (b *MockClientBuilder) WithCertAuth(mount string, role string, certFile string, keyFile string) ClientBuilder {
+	b.tokenAuth = false
+	b.login = MockLogin{Method: HashiCorpClientAuthMethodCert, Mount: mount, Role: role}
+	b.mount = &mount
+	b.role = &role
+	b.certFile = &certFile
+	b.keyFile = &keyFile
+	return b
+}
+
+func (b *MockClientBuilder) WithTokenAuth(token string, wrapped bool, lookupSelf bool, minTTL time.Duration) ClientBuilder {
+	b.tokenAuth = true
+	b.login = MockLogin{Method: HashiCorpClientAuthMethodToken}
+	b.token = &token
+	b.tokenWrapped = &wrapped
+	b.tokenLookupSelf = &lookupSelf
+	b.tokenMinTTL = &minTTL
+	return b
+}
+
+func (b *MockClientBuilder) WithAgentAuth() ClientBuilder {
+	b.tokenAuth = false
+	b.login = MockLogin{Method: HashiCorpClientAuthMethodAgent}
+	return b
+}
+
+func (b *MockClientBuilder) WithAWSAuth(mount string, role string, region string, stsEndpoint string, headerValue string) ClientBuilder {
+	b.tokenAuth = false
+	b.login = MockLogin{Method: HashiCorpClientAuthMethodAWS, Mount: mount, Role: role}
+	b.mount = &mount
+	b.role = &role
+	b.awsRegion = &region
+	b.awsSTSEndpoint = &stsEndpoint
+	b.awsHeaderValue = &headerValue
+	return b
+}
+
+func (b *MockClientBuilder) WithUnwrapCache(cache UnwrapCache) ClientBuilder {
+	b.unwrapCache = cache
+	return b
+}
+
 func (b *MockClientBuilder) validate() error {
 	return nil
 }
 
 func (b *MockClientBuilder) Build(_ context.Context) (Client, error) {
-	return newMockClient(b.mockSecretResponse), nil
+	if b.built {
+		return nil, fmt.Errorf("mock client builder must not be reused")
+	}
+	b.built = true
+	if b.login.Method == HashiCorpClientAuthMethodAppRole && *b.secretIDWrapped {
+		secretID, err := b.unwrap(*b.secretID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unwrap approle secret id: %w", err)
+		}
+		b.login.SecretID = secretID
+	}
+	if err := b.mockLoginErrors[b.login.Method]; err != nil {
+		return nil, err
+	}
+	tokenInfo := TokenInfo{
+		Token:     "mock-token",
+		TTL:       b.mockTokenTTL,
+		Renewable: true,
+	}
+	if b.tokenAuth {
+		token := *b.token
+		if b.tokenWrapped != nil && *b.tokenWrapped {
+			unwrappedToken, err := b.unwrap(token)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unwrap token: %w", err)
+			}
+			token = unwrappedToken
+		}
+		tokenInfo = TokenInfo{Token: token}
+		// the lookup of a token returns its remaining ttl
+		if b.tokenLookupSelf != nil && *b.tokenLookupSelf {
+			tokenInfo.TTL = b.mockTokenTTL
+		}
+	}
+	if tokenInfo.TTL > 0 {
+		tokenInfo.ExpireTime = time.Now().Add(tokenInfo.TTL)
+	}
+	if !b.mockTokenExpireTime.IsZero() {
+		tokenInfo.ExpireTime = b.mockTokenExpireTime
+	}
+	client := newMockClient(b.mockSecretVersions, tokenInfo, !b.tokenAuth)
+	client.login = b.login
+	client.secretsClient.mockSecretLeaseDuration = b.mockSecretLeaseDuration
+	client.secretsClient.mockSecretCustomMetadata = b.mockSecretCustomMetadata
+	client.secretsClient.mockSecretMetadataError = b.mockSecretMetadataError
+	return client, nil
+}
+
+func (b *MockClientBuilder) unwrap(wrappingToken string) (string, error) {
+	if b.unwrapCache != nil {
+		if secret := b.unwrapCache.Get(wrappingToken); secret != "" {
+			return secret, nil
+		}
+	}
+	secret, ok := b.mockWrappedSecrets[wrappingToken]
+	if !ok {
+		return "", fmt.Errorf("wrapping token is not valid or does not exist")
+	}
+	delete(b.mockWrappedSecrets, wrappingToken)
+	if b.unwrapCache != nil {
+		b.unwrapCache.Set(wrappingToken, secret)
+	}
+	return secret, nil
 }
 
 type MockClient struct {
-	secretsClient SecretsClient
+	secretsClient *MockSecretsClient
+	tokenInfo     TokenInfo
+	ownsToken     bool
+	tokenRevoked  bool
+	login         MockLogin
+	closed        bool
 }
 
-func newMockClient(mockSecretResponse map[string]any) *MockClient {
+func newMockClient(mockSecretVersions map[int]map[string]any, tokenInfo TokenInfo, ownsToken bool) *MockClient {
 	return &MockClient{
-		secretsClient: newMockSecretsClient(mockSecretResponse),
+		secretsClient: newMockSecretsClient(mockSecretVersions),
+		tokenInfo:     tokenInfo,
+		ownsToken:     ownsToken,
 	}
 }
 
@@ -59,31 +301,158 @@ func (c *MockClient) Secrets() SecretsClient {
 	return c.secretsClient
 }
 
+func (c *MockClient) Token() TokenInfo {
+	return c.tokenInfo
+}
+
+func (c *MockClient) RenewToken(_ context.Context) (TokenInfo, error) {
+	c.tokenInfo.TTL = time.Hour
+	c.tokenInfo.ExpireTime = time.Now().Add(time.Hour)
+	return c.tokenInfo, nil
+}
+
+func (c *MockClient) RevokeToken(_ context.Context) error {
+	c.tokenRevoked = c.ownsToken
+	return nil
+}
+
+func (c *MockClient) TokenRevoked() bool {
+	return c.tokenRevoked
+}
+
+func (c *MockClient) CloseIdleConnections() {
+	c.closed = true
+}
+
+// Closed reports whether the idle connections of the client were closed
+func (c *MockClient) Closed() bool {
+	return c.closed
+}
+
+// Login returns the auth method the client was built with
+func (c *MockClient) Login() MockLogin {
+	return c.login
+}
+
 type MockSecretsClient struct {
-	mockSecretResponse map[string]any
+	mockSecretVersions       map[int]map[string]any
+	mockSecretLeaseDuration  time.Duration
+	mockSecretCustomMetadata map[string]string
+	mockSecretMetadataError  error
 }
 
-func newMockSecretsClient(mockSecretResponse map[string]any) *MockSecretsClient {
+func newMockSecretsClient(mockSecretVersions map[int]map[string]any) *MockSecretsClient {
 	return &MockSecretsClient{
-		mockSecretResponse: mockSecretResponse,
+		mockSecretVersions: mockSecretVersions,
 	}
 }
 
-func (c *MockSecretsClient) KvV2(mount string, path string) SecretKvV2Client {
-	return &MockSecretKvV2Client{
+func (c *MockSecretsClient) KvV1(mount string, path string) SecretKvV1Client {
+	return &MockSecretKvV1Client{
 		mount:              mount,
 		path:               path,
-		mockSecretResponse: c.mockSecretResponse,
+		mockSecretVersions: c.mockSecretVersions,
+	}
+}
+
+func (c *MockSecretsClient) KvV2(mount string, path string) SecretKvV2Client {
+	return &MockSecretKvV2Client{
+		mount:                    mount,
+		path:                     path,
+		mockSecretVersions:       c.mockSecretVersions,
+		mockSecretCustomMetadata: c.mockSecretCustomMetadata,
+		mockSecretMetadataError:  c.mockSecretMetadataError,
+	}
+}
+
+func (c *MockSecretsClient) Generic(mount string, path string) SecretGenericClient {
+	return &MockSecretGenericClient{
+		mount:                   mount,
+		path:                    path,
+		mockSecretVersions:      c.mockSecretVersions,
+		mockSecretLeaseDuration: c.mockSecretLeaseDuration,
+	}
+}
+
+type MockSecretGenericClient struct {
+	mount string
+	path  string
+
+	mockSecretVersions      map[int]map[string]any
+	mockSecretLeaseDuration time.Duration
+}
+
+func (c *MockSecretGenericClient) Read(_ context.Context) (*Secret, error) {
+	data := c.mockSecretVersions[latestMockSecretVersion(c.mockSecretVersions)]
+	if data == nil {
+		return nil, fmt.Errorf("failed to read secret: %w", ErrSecretNotFound)
+	}
+	return &Secret{
+		Data:          data,
+		LeaseDuration: c.mockSecretLeaseDuration,
+	}, nil
+}
+
+type MockSecretKvV1Client struct {
+	mount string
+	path  string
+
+	mockSecretVersions map[int]map[string]any
+}
+
+func (c *MockSecretKvV1Client) Read(_ context.Context) (map[string]any, error) {
+	// kv v1 is not versioned, so the latest version is returned
+	data := c.mockSecretVersions[latestMockSecretVersion(c.mockSecretVersions)]
+	if data == nil {
+		return nil, fmt.Errorf("failed to read secret: %w", ErrSecretNotFound)
 	}
+	return data, nil
 }
 
 type MockSecretKvV2Client struct {
 	mount string
 	path  string
 
-	mockSecretResponse map[string]any
+	mockSecretVersions       map[int]map[string]any
+	mockSecretCustomMetadata map[string]string
+	mockSecretMetadataError  error
+}
+
+func (c *MockSecretKvV2Client) Read(_ context.Context, version int) (map[string]any, error) {
+	if version == 0 {
+		version = latestMockSecretVersion(c.mockSecretVersions)
+	}
+	data, ok := c.mockSecretVersions[version]
+	if !ok || data == nil {
+		return nil, fmt.Errorf("failed to read secret: %w", ErrSecretVersionNotFound)
+	}
+	return data, nil
+}
+
+func (c *MockSecretKvV2Client) ReadMetadata(_ context.Context) (*SecretKvV2Metadata, error) {
+	if c.mockSecretMetadataError != nil {
+		return nil, fmt.Errorf("failed to read secret metadata: %w", c.mockSecretMetadataError)
+	}
+	if len(c.mockSecretVersions) == 0 {
+		return nil, fmt.Errorf("failed to read secret metadata: %w", ErrSecretNotFound)
+	}
+	metadata := &SecretKvV2Metadata{
+		CurrentVersion: latestMockSecretVersion(c.mockSecretVersions),
+		CustomMetadata: c.mockSecretCustomMetadata,
+	}
+	for version, data := range c.mockSecretVersions {
+		if data != nil {
+			metadata.AvailableVersions = append(metadata.AvailableVersions, version)
+		}
+	}
+	slices.Sort(metadata.AvailableVersions)
+	return metadata, nil
 }
 
-func (c *MockSecretKvV2Client) Read(_ context.Context) (map[string]any, error) {
-	return c.mockSecretResponse, nil
+func latestMockSecretVersion(mockSecretVersions map[int]map[string]any) int {
+	latest := 0
+	for version := range mockSecretVersions {
+		latest = max(latest, version)
+	}
+	return latest
 }
@@ -2,8 +2,16 @@ package vault
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/simonostendorf/kubelet-credential-provider-vault/internal/helpers"
 
@@ -15,15 +23,37 @@ type HashiCorpClientAuthMethod string
 
 const (
 	HashiCorpClientAuthMethodKubernetes HashiCorpClientAuthMethod = "kubernetes"
+	HashiCorpClientAuthMethodJWT        HashiCorpClientAuthMethod = "jwt"
+	HashiCorpClientAuthMethodAppRole    HashiCorpClientAuthMethod = "approle"
+	HashiCorpClientAuthMethodCert       HashiCorpClientAuthMethod = "cert"
+	HashiCorpClientAuthMethodToken      HashiCorpClientAuthMethod = "token"
+	HashiCorpClientAuthMethodAgent      HashiCorpClientAuthMethod = "agent"
+	HashiCorpClientAuthMethodAWS        HashiCorpClientAuthMethod = "aws"
 )
 
 type HashiCorpClientBuilder struct {
 	address             *string
 	insecureSkipVerify  *bool
+	caCertFile          *string
+	tlsServerName       *string
+	namespace           *string
 	authMethod          *HashiCorpClientAuthMethod
 	mount               *string
 	role                *string
 	serviceAccountToken *string
+	roleID              *string
+	secretID            *string
+	secretIDWrapped     *bool
+	certFile            *string
+	keyFile             *string
+	token               *string
+	tokenWrapped        *bool
+	tokenLookupSelf     *bool
+	tokenMinTTL         *time.Duration
+	awsRegion           *string
+	awsSTSEndpoint      *string
+	awsHeaderValue      *string
+	unwrapCache         UnwrapCache
 }
 
 func NewHashicorpClientBuilder() ClientBuilder {
@@ -40,6 +70,21 @@ func (b *HashiCorpClientBuilder) InsecureSkipVerify(insecureSkipVerify bool) Cli
 	return b
 }
 
+func (b *HashiCorpClientBuilder) WithCACert(caCertFile string) ClientBuilder {
+	b.caCertFile = &caCertFile
+	return b
+}
+
+func (b *HashiCorpClientBuilder) WithTLSServerName(serverName string) ClientBuilder {
+	b.tlsServerName = &serverName
+	return b
+}
+
+func (b *HashiCorpClientBuilder) WithNamespace(namespace string) ClientBuilder {
+	b.namespace = &namespace
+	return b
+}
+
 func (b *HashiCorpClientBuilder) WithKubernetesAuth(mount string, role string, serviceAccountToken string) ClientBuilder {
 	b.authMethod = helpers.Ptr(HashiCorpClientAuthMethodKubernetes)
 	b.mount = &mount
@@ -48,6 +93,61 @@ func (b *HashiCorpClientBuilder) WithKubernetesAuth(mount string, role string, s
 	return b
 }
 
+func (b *HashiCorpClientBuilder) WithJWTAuth(mount string, role string, serviceAccountToken string) ClientBuilder {
+	b.authMethod = helpers.Ptr(HashiCorpClientAuthMethodJWT)
+	b.mount = &mount
+	b.role = &role
+	b.serviceAccountToken = &serviceAccountToken
+	return b
+}
+
+func (b *HashiCorpClientBuilder) WithAppRoleAuth(mount string, roleID string, secretID string, secretIDWrapped bool) ClientBuilder {
+	b.authMethod = helpers.Ptr(HashiCorpClientAuthMethodAppRole)
+	b.mount = &mount
+	b.roleID = &roleID
+	b.secretID = &secretID
+	b.secretIDWrapped = &secretIDWrapped
+	return b
+}
+
+func (b *HashiCorpClientBuilder) WithCertAuth(mount string, role string, certFile string, keyFile string) ClientBuilder {
+	b.authMethod = helpers.Ptr(HashiCorpClientAuthMethodCert)
+	b.mount = &mount
+	b.role = &role
+	b.certFile = &certFile
+	b.keyFile = &keyFile
+	return b
+}
+
+func (b *HashiCorpClientBuilder) WithTokenAuth(token string, wrapped bool, lookupSelf bool, minTTL time.Duration) ClientBuilder {
+	b.authMethod = helpers.Ptr(HashiCorpClientAuthMethodToken)
+	b.token = &token
+	b.tokenWrapped = &wrapped
+	b.tokenLookupSelf = &lookupSelf
+	b.tokenMinTTL = &minTTL
+	return b
+}
+
+func (b *HashiCorpClientBuilder) WithAgentAuth() ClientBuilder {
+	b.authMethod = helpers.Ptr(HashiCorpClientAuthMethodAgent)
+	return b
+}
+
+func (b *HashiCorpClientBuilder) WithAWSAuth(mount string, role string, region string, stsEndpoint string, headerValue string) ClientBuilder {
+	b.authMethod = helpers.Ptr(HashiCorpClientAuthMethodAWS)
+	b.mount = &mount
+	b.role = &role
+	b.awsRegion = &region
+	b.awsSTSEndpoint = &stsEndpoint
+	b.awsHeaderValue = &headerValue
+	return b
+}
+
+func (b *HashiCorpClientBuilder) WithUnwrapCache(cache UnwrapCache) ClientBuilder {
+	b.unwrapCache = cache
+	return b
+}
+
 func (b *HashiCorpClientBuilder) validate() error {
 	var errs []error
 	if b.address == nil {
@@ -56,7 +156,7 @@ func (b *HashiCorpClientBuilder) validate() error {
 	if b.authMethod == nil {
 		errs = append(errs, fmt.Errorf("auth method is required"))
 	}
-	if b.mount == nil {
+	if b.mount == nil && (b.authMethod == nil || (*b.authMethod != HashiCorpClientAuthMethodToken && *b.authMethod != HashiCorpClientAuthMethodAgent)) {
 		errs = append(errs, fmt.Errorf("mount is required"))
 	}
 	if b.authMethod != nil && *b.authMethod == HashiCorpClientAuthMethodKubernetes {
@@ -67,6 +167,35 @@ func (b *HashiCorpClientBuilder) validate() error {
 			errs = append(errs, fmt.Errorf("service account token is required for kubernetes auth method"))
 		}
 	}
+	if b.authMethod != nil && *b.authMethod == HashiCorpClientAuthMethodJWT {
+		if b.role == nil {
+			errs = append(errs, fmt.Errorf("role is required for jwt auth method"))
+		}
+		if b.serviceAccountToken == nil {
+			errs = append(errs, fmt.Errorf("service account token is required for jwt auth method"))
+		}
+	}
+	if b.authMethod != nil && *b.authMethod == HashiCorpClientAuthMethodAppRole {
+		if b.roleID == nil {
+			errs = append(errs, fmt.Errorf("role id is required for approle auth method"))
+		}
+		if b.secretID == nil {
+			errs = append(errs, fmt.Errorf("secret id is required for approle auth method"))
+		}
+	}
+	if b.authMethod != nil && *b.authMethod == HashiCorpClientAuthMethodCert {
+		if b.certFile == nil {
+			errs = append(errs, fmt.Errorf("certificate file is required for cert auth method"))
+		}
+		if b.keyFile == nil {
+			errs = append(errs, fmt.Errorf("key file is required for cert auth method"))
+		}
+	}
+	if b.authMethod != nil && *b.authMethod == HashiCorpClientAuthMethodToken {
+		if b.token == nil || *b.token == "" {
+			errs = append(errs, fmt.Errorf("token is required for token auth method"))
+		}
+	}
 	if len(errs) > 0 {
 		return errors.Join(errs...)
 	}
@@ -84,17 +213,46 @@ func (b *HashiCorpClientBuilder) Build(ctx context.Context) (Client, error) {
 	if b.insecureSkipVerify != nil && *b.insecureSkipVerify {
 		tlsConfig.InsecureSkipVerify = true
 	}
+	if b.caCertFile != nil && *b.caCertFile != "" {
+		tlsConfig.ServerCertificate.FromFile = *b.caCertFile
+	}
+	if b.tlsServerName != nil && *b.tlsServerName != "" {
+		tlsConfig.ServerName = *b.tlsServerName
+	}
+	if b.authMethod != nil && *b.authMethod == HashiCorpClientAuthMethodCert {
+		// client certificate is presented in the tls handshake, so it must be part of the client configuration
+		tlsConfig.ClientCertificate.FromFile = *b.certFile
+		tlsConfig.ClientCertificateKey.FromFile = *b.keyFile
+	}
 
 	// build vault client
-	client, err := hashiVault.New(
-		hashiVault.WithAddress(*b.address),
+	options := []hashiVault.ClientOption{
 		hashiVault.WithTLS(tlsConfig),
-	)
+	}
+	if socketPath, ok := strings.CutPrefix(*b.address, "unix://"); ok {
+		// the unix socket handling of the vault client puts the socket path into the request url, which is not parseable,
+		// so the socket is dialed by the transport and a placeholder http address is used instead
+		options = append(options,
+			hashiVault.WithAddress("http://localhost"),
+			hashiVault.WithHTTPClient(newUnixSocketHTTPClient(socketPath)),
+		)
+	} else {
+		options = append(options, hashiVault.WithAddress(*b.address))
+	}
+	client, err := hashiVault.New(options...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create vault client: %w", err)
 	}
 
+	// set namespace (vault enterprise), it is sent with the login and all following requests
+	if b.namespace != nil && *b.namespace != "" {
+		if err := client.SetNamespace(*b.namespace); err != nil {
+			return nil, fmt.Errorf("failed to set namespace on vault client: %w", err)
+		}
+	}
+
 	// authenticate
+	var tokenInfo TokenInfo
 	switch *b.authMethod {
 	case HashiCorpClientAuthMethodKubernetes:
 		resp, err := client.Auth.KubernetesLogin(ctx, schema.KubernetesLoginRequest{
@@ -106,23 +264,263 @@ func (b *HashiCorpClientBuilder) Build(ctx context.Context) (Client, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to authenticate with kubernetes: %w", err)
 		}
+		if resp.Auth == nil {
+			return nil, fmt.Errorf("kubernetes login response does not contain auth information")
+		}
+		if err := client.SetToken(resp.Auth.ClientToken); err != nil {
+			return nil, fmt.Errorf("failed to set token on vault client: %w", err)
+		}
+		tokenInfo = newTokenInfo(resp.Auth)
+	case HashiCorpClientAuthMethodJWT:
+		resp, err := client.Auth.JwtLogin(ctx, schema.JwtLoginRequest{
+			Jwt:  *b.serviceAccountToken,
+			Role: *b.role,
+		},
+			hashiVault.WithMountPath(*b.mount),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to authenticate with jwt: %w", err)
+		}
+		if resp.Auth == nil {
+			return nil, fmt.Errorf("jwt login response does not contain auth information")
+		}
+		if err := client.SetToken(resp.Auth.ClientToken); err != nil {
+			return nil, fmt.Errorf("failed to set token on vault client: %w", err)
+		}
+		tokenInfo = newTokenInfo(resp.Auth)
+	case HashiCorpClientAuthMethodAppRole:
+		secretID := *b.secretID
+		if b.secretIDWrapped != nil && *b.secretIDWrapped {
+			unwrappedSecretID, err := b.unwrap(ctx, client, secretID, unwrapAppRoleSecretID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unwrap approle secret id: %w", err)
+			}
+			secretID = unwrappedSecretID
+		}
+		resp, err := client.Auth.AppRoleLogin(ctx, schema.AppRoleLoginRequest{
+			RoleId:   *b.roleID,
+			SecretId: secretID,
+		},
+			hashiVault.WithMountPath(*b.mount),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to authenticate with approle: %w", err)
+		}
+		if resp.Auth == nil {
+			return nil, fmt.Errorf("approle login response does not contain auth information")
+		}
+		if err := client.SetToken(resp.Auth.ClientToken); err != nil {
+			return nil, fmt.Errorf("failed to set token on vault client: %w", err)
+		}
+		tokenInfo = newTokenInfo(resp.Auth)
+	case HashiCorpClientAuthMethodCert:
+		// role is optional, vault tries all matching certificate roles if it is not set
+		resp, err := client.Auth.CertLogin(ctx, schema.CertLoginRequest{
+			Name: *b.role,
+		},
+			hashiVault.WithMountPath(*b.mount),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to authenticate with cert: %w", err)
+		}
+		if resp.Auth == nil {
+			return nil, fmt.Errorf("cert login response does not contain auth information")
+		}
 		if err := client.SetToken(resp.Auth.ClientToken); err != nil {
 			return nil, fmt.Errorf("failed to set token on vault client: %w", err)
 		}
+		tokenInfo = newTokenInfo(resp.Auth)
+	case HashiCorpClientAuthMethodToken:
+		token := *b.token
+		if b.tokenWrapped != nil && *b.tokenWrapped {
+			unwrappedToken, err := b.unwrap(ctx, client, token, unwrapToken)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unwrap token: %w", err)
+			}
+			token = unwrappedToken
+		}
+		if err := client.SetToken(token); err != nil {
+			return nil, fmt.Errorf("failed to set token on vault client: %w", err)
+		}
+		tokenInfo = TokenInfo{Token: token}
+		if b.tokenLookupSelf != nil && *b.tokenLookupSelf {
+			minTTL := time.Duration(0)
+			if b.tokenMinTTL != nil {
+				minTTL = *b.tokenMinTTL
+			}
+			// the looked up ttl is kept, so the cache duration of the response is bounded by the remaining ttl of the token
+			tokenInfo, err = lookupToken(ctx, client, token, minTTL)
+			if err != nil {
+				return nil, fmt.Errorf("failed to validate token: %w", err)
+			}
+		}
+	case HashiCorpClientAuthMethodAgent:
+		// no token is sent, the vault agent / proxy injects its auto-auth token (use_auto_auth_token)
+	case HashiCorpClientAuthMethodAWS:
+		region := DefaultAWSRegion
+		if b.awsRegion != nil && *b.awsRegion != "" {
+			region = *b.awsRegion
+		}
+		stsEndpoint := DefaultAWSSTSEndpoint
+		if b.awsSTSEndpoint != nil && *b.awsSTSEndpoint != "" {
+			stsEndpoint = *b.awsSTSEndpoint
+		}
+		headerValue := ""
+		if b.awsHeaderValue != nil {
+			headerValue = *b.awsHeaderValue
+		}
+		role := ""
+		if b.role != nil {
+			role = *b.role
+		}
+		loginRequest, err := newAWSLoginRequest(ctx, role, region, stsEndpoint, headerValue)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create aws login request: %w", err)
+		}
+		resp, err := client.Auth.AwsLogin(ctx, *loginRequest,
+			hashiVault.WithMountPath(*b.mount),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to authenticate with aws: %w", err)
+		}
+		if resp.Auth == nil {
+			return nil, fmt.Errorf("aws login response does not contain auth information")
+		}
+		if err := client.SetToken(resp.Auth.ClientToken); err != nil {
+			return nil, fmt.Errorf("failed to set token on vault client: %w", err)
+		}
+		tokenInfo = newTokenInfo(resp.Auth)
+	}
+
+	// tokens of the token and agent auth methods are owned by someone else and must not be revoked
+	ownsToken := *b.authMethod != HashiCorpClientAuthMethodToken && *b.authMethod != HashiCorpClientAuthMethodAgent
+
+	return newHashiCorpClient(client, tokenInfo, ownsToken), nil
+}
+
+func newTokenInfo(auth *hashiVault.ResponseAuth) TokenInfo {
+	tokenInfo := TokenInfo{
+		Token:     auth.ClientToken,
+		TTL:       time.Duration(auth.LeaseDuration) * time.Second,
+		Renewable: auth.Renewable,
+	}
+	if tokenInfo.TTL > 0 {
+		tokenInfo.ExpireTime = time.Now().Add(tokenInfo.TTL)
+	}
+	return tokenInfo
+}
+
+func newUnixSocketHTTPClient(socketPath string) *http.Client {
+	httpClient := hashiVault.DefaultConfiguration().HTTPClient
+	if transport, ok := httpClient.Transport.(*http.Transport); ok {
+		transport.DialContext = func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socketPath)
+		}
+	}
+	return httpClient
+}
+
+// unwrap returns the secret of the wrapping token from the unwrap cache or unwraps it, the secret is cached right after
+// the unwrap because the wrapping token is not valid anymore (even if the following login fails)
+func (b *HashiCorpClientBuilder) unwrap(ctx context.Context, client *hashiVault.Client, wrappingToken string, unwrap func(context.Context, *hashiVault.Client, string) (string, error)) (string, error) {
+	if b.unwrapCache != nil {
+		if secret := b.unwrapCache.Get(wrappingToken); secret != "" {
+			return secret, nil
+		}
+	}
+	secret, err := unwrap(ctx, client, wrappingToken)
+	if err != nil {
+		return "", err
+	}
+	if b.unwrapCache != nil {
+		b.unwrapCache.Set(wrappingToken, secret)
+	}
+	return secret, nil
+}
+
+func unwrapAppRoleSecretID(ctx context.Context, client *hashiVault.Client, wrappingToken string) (string, error) {
+	// the wrapping token is used as request token, the client itself is not authenticated yet
+	resp, err := client.System.Unwrap(ctx, schema.UnwrapRequest{},
+		hashiVault.WithToken(wrappingToken),
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to unwrap response: %w", err)
+	}
+	secretID, ok := resp.Data["secret_id"].(string)
+	if !ok || secretID == "" {
+		return "", fmt.Errorf("unwrapped response does not contain a secret id")
+	}
+	return secretID, nil
+}
+
+func unwrapToken(ctx context.Context, client *hashiVault.Client, wrappingToken string) (string, error) {
+	resp, err := client.System.Unwrap(ctx, schema.UnwrapRequest{},
+		hashiVault.WithToken(wrappingToken),
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to unwrap response: %w", err)
+	}
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return "", fmt.Errorf("unwrapped response does not contain a client token")
+	}
+	return resp.Auth.ClientToken, nil
+}
+
+// lookupToken returns the remaining ttl of the token and fails if it is below the minimum ttl
+func lookupToken(ctx context.Context, client *hashiVault.Client, token string, minTTL time.Duration) (TokenInfo, error) {
+	resp, err := client.Auth.TokenLookUpSelf(ctx)
+	if err != nil {
+		return TokenInfo{}, fmt.Errorf("failed to lookup token: %w", err)
+	}
+	ttl, err := parseSeconds(resp.Data["ttl"])
+	if err != nil {
+		return TokenInfo{}, fmt.Errorf("failed to parse token ttl: %w", err)
 	}
+	// a ttl of zero means the token never expires (e.g. root tokens)
+	if ttl != 0 && ttl < minTTL {
+		return TokenInfo{}, fmt.Errorf("token ttl %s is below the minimum ttl %s", ttl, minTTL)
+	}
+	renewable, _ := resp.Data["renewable"].(bool)
+	tokenInfo := TokenInfo{
+		Token:     token,
+		TTL:       ttl,
+		Renewable: renewable,
+	}
+	if ttl > 0 {
+		tokenInfo.ExpireTime = time.Now().Add(ttl)
+	}
+	return tokenInfo, nil
+}
 
-	return newHashiCorpClient(client), nil
+func parseSeconds(value any) (time.Duration, error) {
+	switch v := value.(type) {
+	case json.Number:
+		seconds, err := v.Int64()
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(seconds) * time.Second, nil
+	case float64:
+		return time.Duration(v) * time.Second, nil
+	default:
+		return 0, fmt.Errorf("unexpected type %T", value)
+	}
 }
 
 type HashiCorpClient struct {
-	client *hashiVault.Client
+	client    *hashiVault.Client
+	tokenInfo TokenInfo
+	ownsToken bool
 
 	secretsClient SecretsClient
 }
 
-func newHashiCorpClient(client *hashiVault.Client) *HashiCorpClient {
+func newHashiCorpClient(client *hashiVault.Client, tokenInfo TokenInfo, ownsToken bool) *HashiCorpClient {
 	return &HashiCorpClient{
 		client:        client,
+		tokenInfo:     tokenInfo,
+		ownsToken:     ownsToken,
 		secretsClient: newHashiCorpSecretsClient(client),
 	}
 }
@@ -131,6 +529,39 @@ func (c *HashiCorpClient) Secrets() SecretsClient {
 	return c.secretsClient
 }
 
+func (c *HashiCorpClient) Token() TokenInfo {
+	return c.tokenInfo
+}
+
+func (c *HashiCorpClient) RenewToken(ctx context.Context) (TokenInfo, error) {
+	resp, err := c.client.Auth.TokenRenewSelf(ctx, schema.TokenRenewSelfRequest{})
+	if err != nil {
+		return TokenInfo{}, fmt.Errorf("failed to renew token: %w", err)
+	}
+	if resp.Auth == nil {
+		return TokenInfo{}, fmt.Errorf("renew response does not contain auth information")
+	}
+	// the token itself does not change on renewal
+	tokenInfo := newTokenInfo(resp.Auth)
+	tokenInfo.Token = c.tokenInfo.Token
+	c.tokenInfo = tokenInfo
+	return tokenInfo, nil
+}
+
+func (c *HashiCorpClient) RevokeToken(ctx context.Context) error {
+	if !c.ownsToken {
+		return nil
+	}
+	if _, err := c.client.Auth.TokenRevokeSelf(ctx); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	return nil
+}
+
+func (c *HashiCorpClient) CloseIdleConnections() {
+	c.client.Configuration().HTTPClient.CloseIdleConnections()
+}
+
 type HashiCorpSecretsClient struct {
 	client *hashiVault.Client
 }
@@ -141,6 +572,14 @@ func newHashiCorpSecretsClient(client *hashiVault.Client) *HashiCorpSecretsClien
 	}
 }
 
+func (c *HashiCorpSecretsClient) KvV1(mount string, path string) SecretKvV1Client {
+	return &HashiCorpSecretKvV1Client{
+		client: c.client,
+		mount:  mount,
+		path:   path,
+	}
+}
+
 func (c *HashiCorpSecretsClient) KvV2(mount string, path string) SecretKvV2Client {
 	return &HashiCorpSecretKvV2Client{
 		client: c.client,
@@ -149,18 +588,139 @@ func (c *HashiCorpSecretsClient) KvV2(mount string, path string) SecretKvV2Clien
 	}
 }
 
-type HashiCorpSecretKvV2Client struct {
+func (c *HashiCorpSecretsClient) Generic(mount string, path string) SecretGenericClient {
+	return &HashiCorpSecretGenericClient{
+		client: c.client,
+		mount:  mount,
+		path:   path,
+	}
+}
+
+type HashiCorpSecretGenericClient struct {
 	client *hashiVault.Client
 	mount  string
 	path   string
 }
 
-func (c *HashiCorpSecretKvV2Client) Read(ctx context.Context) (map[string]any, error) {
-	s, err := c.client.Secrets.KvV2Read(ctx, c.path,
+func (c *HashiCorpSecretGenericClient) Read(ctx context.Context) (*Secret, error) {
+	s, err := c.client.Read(ctx, strings.Trim(c.mount, "/")+"/"+strings.Trim(c.path, "/"))
+	if err != nil {
+		if hashiVault.IsErrorStatus(err, http.StatusNotFound) {
+			return nil, fmt.Errorf("failed to read secret: %w", ErrSecretNotFound)
+		}
+		return nil, fmt.Errorf("failed to read secret: %w", err)
+	}
+	if s.Data == nil {
+		return nil, fmt.Errorf("failed to read secret: response does not contain data")
+	}
+	return &Secret{
+		Data:          s.Data,
+		LeaseDuration: time.Duration(s.LeaseDuration) * time.Second,
+	}, nil
+}
+
+type HashiCorpSecretKvV1Client struct {
+	client *hashiVault.Client
+	mount  string
+	path   string
+}
+
+func (c *HashiCorpSecretKvV1Client) Read(ctx context.Context) (map[string]any, error) {
+	s, err := c.client.Secrets.KvV1Read(ctx, c.path,
 		hashiVault.WithMountPath(c.mount),
 	)
 	if err != nil {
+		if hashiVault.IsErrorStatus(err, http.StatusNotFound) {
+			return nil, fmt.Errorf("failed to read secret: %w", ErrSecretNotFound)
+		}
+		return nil, fmt.Errorf("failed to read secret: %w", err)
+	}
+	return s.Data, nil
+}
+
+type HashiCorpSecretKvV2Client struct {
+	client *hashiVault.Client
+	mount  string
+	path   string
+}
+
+func (c *HashiCorpSecretKvV2Client) Read(ctx context.Context, version int) (map[string]any, error) {
+	options := []hashiVault.RequestOption{
+		hashiVault.WithMountPath(c.mount),
+	}
+	if version > 0 {
+		options = append(options, hashiVault.WithQueryParameters(url.Values{
+			"version": []string{strconv.Itoa(version)},
+		}))
+	}
+	s, err := c.client.Secrets.KvV2Read(ctx, c.path, options...)
+	if err != nil {
+		// deleted and destroyed versions are reported as not found
+		if hashiVault.IsErrorStatus(err, http.StatusNotFound) {
+			return nil, fmt.Errorf("failed to read secret: %w", ErrSecretVersionNotFound)
+		}
 		return nil, fmt.Errorf("failed to read secret: %w", err)
 	}
+	if s.Data.Data == nil {
+		return nil, fmt.Errorf("failed to read secret: %w", ErrSecretVersionNotFound)
+	}
 	return s.Data.Data, nil
 }
+
+func (c *HashiCorpSecretKvV2Client) ReadMetadata(ctx context.Context) (*SecretKvV2Metadata, error) {
+	s, err := c.client.Secrets.KvV2ReadMetadata(ctx, c.path,
+		hashiVault.WithMountPath(c.mount),
+	)
+	if err != nil {
+		if hashiVault.IsErrorStatus(err, http.StatusNotFound) {
+			return nil, fmt.Errorf("failed to read secret metadata: %w", ErrSecretNotFound)
+		}
+		return nil, fmt.Errorf("failed to read secret metadata: %w", err)
+	}
+
+	metadata := &SecretKvV2Metadata{
+		CurrentVersion: int(s.Data.CurrentVersion),
+		CustomMetadata: make(map[string]string, len(s.Data.CustomMetadata)),
+	}
+	for key, value := range s.Data.CustomMetadata {
+		if value, ok := value.(string); ok {
+			metadata.CustomMetadata[key] = value
+		}
+	}
+	now := time.Now()
+	for key, value := range s.Data.Versions {
+		version, err := strconv.Atoi(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse secret version %s: %w", key, err)
+		}
+		versionMetadata, ok := value.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("unexpected metadata of secret version %s", key)
+		}
+		destroyed, _ := versionMetadata["destroyed"].(bool)
+		deleted, err := isDeleted(versionMetadata["deletion_time"], now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse deletion time of secret version %s: %w", key, err)
+		}
+		if destroyed || deleted {
+			continue
+		}
+		metadata.AvailableVersions = append(metadata.AvailableVersions, version)
+	}
+	slices.Sort(metadata.AvailableVersions)
+	return metadata, nil
+}
+
+// isDeleted reports whether the deletion time of a secret version has passed, versions of mounts or secrets with
+// delete_version_after have a deletion time in the future until they are deleted automatically
+func isDeleted(value any, now time.Time) (bool, error) {
+	deletionTime, _ := value.(string)
+	if deletionTime == "" {
+		return false, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, deletionTime)
+	if err != nil {
+		return false, err
+	}
+	return !t.After(now), nil
+}
@@ -0,0 +1,1005 @@
+package vault
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeVaultResponse is the response of the fake vault server for a path
+type fakeVaultResponse struct {
+	status int
+	body   string
+}
+
+// fakeVaultRequest is a request received by the fake vault server
+type fakeVaultRequest struct {
+	path  string
+	query string
+	token string
+	// namespace is the X-Vault-Namespace header of the request (vault enterprise)
+	namespace string
+	body      map[string]any
+	// clientCertificate is the common name of the tls client certificate
+	clientCertificate string
+}
+
+// fakeVault answers requests by their path (e.g. /v1/auth/approle/login) and records them, unknown paths return 404
+type fakeVault struct {
+	responses map[string]fakeVaultResponse
+
+	mu       sync.Mutex
+	requests []fakeVaultRequest
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	request := fakeVaultRequest{
+		path:      r.URL.Path,
+		query:     r.URL.RawQuery,
+		token:     r.Header.Get("X-Vault-Token"),
+		namespace: r.Header.Get("X-Vault-Namespace"),
+	}
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		request.clientCertificate = r.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	// nolint:errcheck
+	json.NewDecoder(r.Body).Decode(&request.body) //gosec:disable G104
+	v.mu.Lock()
+	v.requests = append(v.requests, request)
+	v.mu.Unlock()
+
+	response, ok := v.responses[r.URL.Path]
+	if !ok {
+		response = fakeVaultResponse{status: http.StatusNotFound, body: `{"errors":[]}`}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(response.status)
+	// nolint:errcheck
+	w.Write([]byte(response.body)) //gosec:disable G104
+}
+
+// request returns the last request of the path
+func (v *fakeVault) request(path string) *fakeVaultRequest {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for i := len(v.requests) - 1; i >= 0; i-- {
+		if v.requests[i].path == path {
+			return &v.requests[i]
+		}
+	}
+	return nil
+}
+
+func newFakeVault(t *testing.T, responses map[string]fakeVaultResponse) (*fakeVault, string) {
+	t.Helper()
+	vault := &fakeVault{responses: responses}
+	server := httptest.NewServer(vault)
+	t.Cleanup(server.Close)
+	return vault, server.URL
+}
+
+// newFakeVaultUnixSocket serves the fake vault on a unix socket like a local vault agent or proxy, it returns the socket
+func newFakeVaultUnixSocket(t *testing.T, responses map[string]fakeVaultResponse) (*fakeVault, string) {
+	t.Helper()
+	vault := &fakeVault{responses: responses}
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("failed to listen on socket: %v", err)
+	}
+	server := &http.Server{Handler: vault, ReadHeaderTimeout: time.Second}
+	go func() {
+		// nolint:errcheck
+		server.Serve(listener) //gosec:disable G104
+	}()
+	t.Cleanup(func() {
+		// nolint:errcheck
+		server.Close() //gosec:disable G104
+	})
+	return vault, socket
+}
+
+// newFakeVaultTLS starts the fake vault with tls, clients must present a certificate of the client ca if it is set.
+// It returns the file of the ca certificate of the server.
+func newFakeVaultTLS(t *testing.T, responses map[string]fakeVaultResponse, clientCA *x509.Certificate) (*fakeVault, string, string) {
+	t.Helper()
+	vault := &fakeVault{responses: responses}
+	server := httptest.NewUnstartedServer(vault)
+	server.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	// failed handshakes are expected by some tests
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	if clientCA != nil {
+		clientCAs := x509.NewCertPool()
+		clientCAs.AddCert(clientCA)
+		server.TLS.ClientCAs = clientCAs
+		server.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	caCertFile := writePEMFile(t, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+	return vault, server.URL, caCertFile
+}
+
+// newClientCertificate returns a self-signed client certificate and the files of the certificate and key
+func newClientCertificate(t *testing.T, commonName string) (*x509.Certificate, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	return cert, writePEMFile(t, "client.pem", "CERTIFICATE", der), writePEMFile(t, "client-key.pem", "EC PRIVATE KEY", keyDER)
+}
+
+func writePEMFile(t *testing.T, name string, blockType string, der []byte) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return file
+}
+
+// checkTokenInfo compares the token info without the expire time, which depends on the time of the login
+func checkTokenInfo(t *testing.T, got TokenInfo, want TokenInfo) {
+	t.Helper()
+	if got.Token != want.Token || got.TTL != want.TTL || got.Renewable != want.Renewable {
+		t.Errorf("unexpected token: got %+v, want %+v", got, want)
+	}
+	if got.ExpireTime.IsZero() != (want.TTL == 0) {
+		t.Errorf("unexpected token expire time %v for ttl %s", got.ExpireTime, got.TTL)
+	}
+}
+
+func TestBuildAppRoleAuth(t *testing.T) {
+	loginResponse := fakeVaultResponse{
+		status: http.StatusOK,
+		body:   `{"data":null,"auth":{"client_token":"hvs.approle","lease_duration":3600,"renewable":true}}`,
+	}
+
+	tests := []struct {
+		name            string
+		secretID        string
+		secretIDWrapped bool
+		responses       map[string]fakeVaultResponse
+		wantSecretID    string
+		want            TokenInfo
+		wantErrMsg      string
+	}{
+		{
+			name:            "secret id",
+			secretID:        "secret-id",
+			secretIDWrapped: false,
+			responses: map[string]fakeVaultResponse{
+				"/v1/auth/approle/login": loginResponse,
+			},
+			wantSecretID: "secret-id",
+			want:         TokenInfo{Token: "hvs.approle", TTL: time.Hour, Renewable: true},
+			wantErrMsg:   "",
+		},
+		{
+			name:            "wrapped secret id",
+			secretID:        "hvs.wrapping",
+			secretIDWrapped: true,
+			responses: map[string]fakeVaultResponse{
+				"/v1/sys/wrapping/unwrap": {status: http.StatusOK, body: `{"data":{"secret_id":"unwrapped-secret-id","secret_id_accessor":"accessor"}}`},
+				"/v1/auth/approle/login":  loginResponse,
+			},
+			wantSecretID: "unwrapped-secret-id",
+			want:         TokenInfo{Token: "hvs.approle", TTL: time.Hour, Renewable: true},
+			wantErrMsg:   "",
+		},
+		{
+			name:            "wrapped response without secret id",
+			secretID:        "hvs.wrapping",
+			secretIDWrapped: true,
+			responses: map[string]fakeVaultResponse{
+				"/v1/sys/wrapping/unwrap": {status: http.StatusOK, body: `{"data":{"foo":"bar"}}`},
+				"/v1/auth/approle/login":  loginResponse,
+			},
+			wantErrMsg: "failed to unwrap approle secret id: unwrapped response does not contain a secret id",
+		},
+		{
+			name:            "invalid wrapping token",
+			secretID:        "hvs.wrapping",
+			secretIDWrapped: true,
+			responses: map[string]fakeVaultResponse{
+				"/v1/sys/wrapping/unwrap": {status: http.StatusBadRequest, body: `{"errors":["wrapping token is not valid or does not exist"]}`},
+				"/v1/auth/approle/login":  loginResponse,
+			},
+			wantErrMsg: "failed to unwrap approle secret id: failed to unwrap response: 400 Bad Request: wrapping token is not valid or does not exist",
+		},
+		{
+			name:            "login without auth",
+			secretID:        "secret-id",
+			secretIDWrapped: false,
+			responses: map[string]fakeVaultResponse{
+				"/v1/auth/approle/login": {status: http.StatusOK, body: `{"data":{}}`},
+			},
+			wantErrMsg: "approle login response does not contain auth information",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vault, address := newFakeVault(t, tt.responses)
+
+			client, err := NewHashicorpClientBuilder().
+				WithAddress(address).
+				WithAppRoleAuth("approle", "role-id", tt.secretID, tt.secretIDWrapped).
+				Build(t.Context())
+			if tt.wantErrMsg != "" {
+				if err == nil || err.Error() != tt.wantErrMsg {
+					t.Fatalf("expected error %q, got %v", tt.wantErrMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			checkTokenInfo(t, client.Token(), tt.want)
+
+			if tt.secretIDWrapped {
+				// the wrapping token is the token of the unwrap request
+				unwrapRequest := vault.request("/v1/sys/wrapping/unwrap")
+				if unwrapRequest == nil || unwrapRequest.token != tt.secretID {
+					t.Errorf("unexpected unwrap request: %+v", unwrapRequest)
+				}
+			}
+			loginRequest := vault.request("/v1/auth/approle/login")
+			if loginRequest == nil {
+				t.Fatalf("no login request")
+			}
+			if loginRequest.body["role_id"] != "role-id" || loginRequest.body["secret_id"] != tt.wantSecretID {
+				t.Errorf("unexpected login request: %v", loginRequest.body)
+			}
+		})
+	}
+}
+
+func TestBuildCertAuth(t *testing.T) {
+	responses := map[string]fakeVaultResponse{
+		"/v1/auth/cert/login": {status: http.StatusOK, body: `{"data":null,"auth":{"client_token":"hvs.cert","lease_duration":600,"renewable":false}}`},
+	}
+	clientCA, certFile, keyFile := newClientCertificate(t, "node-1")
+
+	tests := []struct {
+		name               string
+		certFile           string
+		keyFile            string
+		useCACert          bool
+		insecureSkipVerify bool
+		tlsServerName      string
+		// responses default to a successful login
+		responses map[string]fakeVaultResponse
+		want      TokenInfo
+		// wantErrMsg is a part of the error, the full error contains the random address of the server
+		wantErrMsg string
+	}{
+		{
+			name:      "client certificate",
+			certFile:  certFile,
+			keyFile:   keyFile,
+			useCACert: true,
+			want:      TokenInfo{Token: "hvs.cert", TTL: 10 * time.Minute, Renewable: false},
+		},
+		{
+			name:          "client certificate with tls server name",
+			certFile:      certFile,
+			keyFile:       keyFile,
+			useCACert:     true,
+			tlsServerName: "example.com",
+			want:          TokenInfo{Token: "hvs.cert", TTL: 10 * time.Minute, Renewable: false},
+		},
+		{
+			name:               "client certificate with insecure skip verify",
+			certFile:           certFile,
+			keyFile:            keyFile,
+			insecureSkipVerify: true,
+			want:               TokenInfo{Token: "hvs.cert", TTL: 10 * time.Minute, Renewable: false},
+		},
+		{
+			name:          "tls server name not in server certificate",
+			certFile:      certFile,
+			keyFile:       keyFile,
+			useCACert:     true,
+			tlsServerName: "vault.example.org",
+			wantErrMsg:    "not vault.example.org",
+		},
+		{
+			name:       "unknown server ca",
+			certFile:   certFile,
+			keyFile:    keyFile,
+			wantErrMsg: "certificate signed by unknown authority",
+		},
+		{
+			name:       "missing client key",
+			certFile:   certFile,
+			keyFile:    filepath.Join(t.TempDir(), "missing.pem"),
+			useCACert:  true,
+			wantErrMsg: "failed to create vault client",
+		},
+		{
+			name:      "login without auth",
+			certFile:  certFile,
+			keyFile:   keyFile,
+			useCACert: true,
+			responses: map[string]fakeVaultResponse{
+				"/v1/auth/cert/login": {status: http.StatusOK, body: `{"data":{}}`},
+			},
+			wantErrMsg: "cert login response does not contain auth information",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.responses == nil {
+				tt.responses = responses
+			}
+			vault, address, caCertFile := newFakeVaultTLS(t, tt.responses, clientCA)
+
+			builder := NewHashicorpClientBuilder().
+				WithAddress(address).
+				InsecureSkipVerify(tt.insecureSkipVerify).
+				WithTLSServerName(tt.tlsServerName).
+				WithCertAuth("cert", "node", tt.certFile, tt.keyFile)
+			if tt.useCACert {
+				builder = builder.WithCACert(caCertFile)
+			}
+			client, err := builder.Build(t.Context())
+			if tt.wantErrMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrMsg) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErrMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			checkTokenInfo(t, client.Token(), tt.want)
+
+			// the client certificate is presented in the tls handshake of the login
+			loginRequest := vault.request("/v1/auth/cert/login")
+			if loginRequest == nil {
+				t.Fatalf("no login request")
+			}
+			if loginRequest.clientCertificate != "node-1" || loginRequest.body["name"] != "node" {
+				t.Errorf("unexpected login request: %+v", loginRequest)
+			}
+		})
+	}
+}
+
+// mapUnwrapCache keeps the secrets of wrapping tokens in memory
+type mapUnwrapCache map[string]string
+
+func (c mapUnwrapCache) Get(wrappingToken string) string {
+	return c[wrappingToken]
+}
+
+func (c mapUnwrapCache) Set(wrappingToken string, secret string) {
+	c[wrappingToken] = secret
+}
+
+func TestBuildTokenAuth(t *testing.T) {
+	unwrapResponse := fakeVaultResponse{
+		status: http.StatusOK,
+		body:   `{"data":null,"auth":{"client_token":"hvs.unwrapped","lease_duration":3600,"renewable":true}}`,
+	}
+	lookupResponse := fakeVaultResponse{
+		status: http.StatusOK,
+		body:   `{"data":{"ttl":3600,"renewable":true}}`,
+	}
+
+	tests := []struct {
+		name        string
+		token       string
+		wrapped     bool
+		unwrapCache mapUnwrapCache
+		lookupSelf  bool
+		minTTL      time.Duration
+		responses   map[string]fakeVaultResponse
+		want        TokenInfo
+		wantErrMsg  string
+	}{
+		{
+			name:      "token",
+			token:     "hvs.token",
+			responses: map[string]fakeVaultResponse{},
+			want:      TokenInfo{Token: "hvs.token"},
+		},
+		{
+			name:    "wrapped token",
+			token:   "hvs.wrapping",
+			wrapped: true,
+			responses: map[string]fakeVaultResponse{
+				"/v1/sys/wrapping/unwrap": unwrapResponse,
+			},
+			want: TokenInfo{Token: "hvs.unwrapped"},
+		},
+		{
+			name:        "wrapped token is cached",
+			token:       "hvs.wrapping",
+			wrapped:     true,
+			unwrapCache: mapUnwrapCache{},
+			responses: map[string]fakeVaultResponse{
+				"/v1/sys/wrapping/unwrap": unwrapResponse,
+			},
+			want: TokenInfo{Token: "hvs.unwrapped"},
+		},
+		{
+			name:        "wrapped token from unwrap cache",
+			token:       "hvs.wrapping",
+			wrapped:     true,
+			unwrapCache: mapUnwrapCache{"hvs.wrapping": "hvs.cached"},
+			responses:   map[string]fakeVaultResponse{},
+			want:        TokenInfo{Token: "hvs.cached"},
+		},
+		{
+			name:    "wrapped response without token",
+			token:   "hvs.wrapping",
+			wrapped: true,
+			responses: map[string]fakeVaultResponse{
+				"/v1/sys/wrapping/unwrap": {status: http.StatusOK, body: `{"data":{"secret_id":"secret-id"}}`},
+			},
+			wantErrMsg: "failed to unwrap token: unwrapped response does not contain a client token",
+		},
+		{
+			name:       "lookup self",
+			token:      "hvs.token",
+			lookupSelf: true,
+			minTTL:     10 * time.Minute,
+			responses: map[string]fakeVaultResponse{
+				"/v1/auth/token/lookup-self": lookupResponse,
+			},
+			want: TokenInfo{Token: "hvs.token", TTL: time.Hour, Renewable: true},
+		},
+		{
+			name:       "lookup self of wrapped token",
+			token:      "hvs.wrapping",
+			wrapped:    true,
+			lookupSelf: true,
+			responses: map[string]fakeVaultResponse{
+				"/v1/sys/wrapping/unwrap":    unwrapResponse,
+				"/v1/auth/token/lookup-self": lookupResponse,
+			},
+			want: TokenInfo{Token: "hvs.unwrapped", TTL: time.Hour, Renewable: true},
+		},
+		{
+			name:       "lookup self of token without ttl",
+			token:      "hvs.root",
+			lookupSelf: true,
+			minTTL:     10 * time.Minute,
+			responses: map[string]fakeVaultResponse{
+				"/v1/auth/token/lookup-self": {status: http.StatusOK, body: `{"data":{"ttl":0,"renewable":false}}`},
+			},
+			want: TokenInfo{Token: "hvs.root"},
+		},
+		{
+			name:       "token ttl below minimum ttl",
+			token:      "hvs.token",
+			lookupSelf: true,
+			minTTL:     10 * time.Minute,
+			responses: map[string]fakeVaultResponse{
+				"/v1/auth/token/lookup-self": {status: http.StatusOK, body: `{"data":{"ttl":60,"renewable":true}}`},
+			},
+			wantErrMsg: "failed to validate token: token ttl 1m0s is below the minimum ttl 10m0s",
+		},
+		{
+			name:       "lookup self with invalid ttl",
+			token:      "hvs.token",
+			lookupSelf: true,
+			responses: map[string]fakeVaultResponse{
+				"/v1/auth/token/lookup-self": {status: http.StatusOK, body: `{"data":{"ttl":"1h"}}`},
+			},
+			wantErrMsg: "failed to validate token: failed to parse token ttl: unexpected type string",
+		},
+		{
+			name:       "lookup self of invalid token",
+			token:      "hvs.token",
+			lookupSelf: true,
+			responses: map[string]fakeVaultResponse{
+				"/v1/auth/token/lookup-self": {status: http.StatusForbidden, body: `{"errors":["permission denied"]}`},
+			},
+			wantErrMsg: "failed to validate token: failed to lookup token: 403 Forbidden: permission denied",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vault, address := newFakeVault(t, tt.responses)
+			cached := tt.unwrapCache[tt.token] != ""
+
+			builder := NewHashicorpClientBuilder().WithAddress(address)
+			if tt.unwrapCache != nil {
+				builder = builder.WithUnwrapCache(tt.unwrapCache)
+			}
+			client, err := builder.
+				WithTokenAuth(tt.token, tt.wrapped, tt.lookupSelf, tt.minTTL).
+				Build(t.Context())
+			if tt.wantErrMsg != "" {
+				if err == nil || err.Error() != tt.wantErrMsg {
+					t.Fatalf("expected error %q, got %v", tt.wantErrMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			checkTokenInfo(t, client.Token(), tt.want)
+
+			if tt.wrapped && !cached {
+				if unwrapRequest := vault.request("/v1/sys/wrapping/unwrap"); unwrapRequest == nil || unwrapRequest.token != tt.token {
+					t.Errorf("unexpected unwrap request: %+v", unwrapRequest)
+				}
+			}
+			if cached && vault.request("/v1/sys/wrapping/unwrap") != nil {
+				t.Errorf("cached wrapping token is unwrapped again")
+			}
+			if tt.unwrapCache != nil && tt.unwrapCache[tt.token] != tt.want.Token {
+				t.Errorf("unexpected unwrap cache: got %v, want %s", tt.unwrapCache, tt.want.Token)
+			}
+			lookupRequest := vault.request("/v1/auth/token/lookup-self")
+			if tt.lookupSelf && (lookupRequest == nil || lookupRequest.token != tt.want.Token) {
+				t.Errorf("unexpected lookup request: %+v", lookupRequest)
+			}
+			if !tt.lookupSelf && lookupRequest != nil {
+				t.Errorf("unexpected lookup request: %+v", lookupRequest)
+			}
+		})
+	}
+}
+
+func TestParseSeconds(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      any
+		want       time.Duration
+		wantErrMsg string
+	}{
+		{
+			name:  "json number",
+			value: json.Number("90"),
+			want:  90 * time.Second,
+		},
+		{
+			name:  "float",
+			value: float64(90),
+			want:  90 * time.Second,
+		},
+		{
+			name:       "json number with fraction",
+			value:      json.Number("1.5"),
+			wantErrMsg: "strconv.ParseInt: parsing \"1.5\": invalid syntax",
+		},
+		{
+			name:       "string",
+			value:      "90",
+			wantErrMsg: "unexpected type string",
+		},
+		{
+			name:       "missing",
+			value:      nil,
+			wantErrMsg: "unexpected type <nil>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSeconds(tt.value)
+			if err != nil && err.Error() != tt.wantErrMsg {
+				t.Errorf("unexpected error: got %v, want %v", err, tt.wantErrMsg)
+			}
+			if err == nil && tt.wantErrMsg != "" {
+				t.Errorf("expected error: %v", tt.wantErrMsg)
+			}
+			if got != tt.want {
+				t.Errorf("unexpected duration: got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildUnixSocket(t *testing.T) {
+	responses := map[string]fakeVaultResponse{
+		"/v1/auth/token/lookup-self": {status: http.StatusOK, body: `{"data":{"ttl":3600,"renewable":true}}`},
+		"/v1/secret/app":             {status: http.StatusOK, body: `{"data":{"username":"user","password":"password"},"lease_duration":0}`},
+	}
+
+	tests := []struct {
+		name      string
+		builder   func(builder ClientBuilder) ClientBuilder
+		wantToken string
+	}{
+		{
+			name: "agent auth",
+			builder: func(builder ClientBuilder) ClientBuilder {
+				return builder.WithAgentAuth()
+			},
+			wantToken: "",
+		},
+		{
+			name: "token auth with lookup self",
+			builder: func(builder ClientBuilder) ClientBuilder {
+				return builder.WithTokenAuth("hvs.token", false, true, 0)
+			},
+			wantToken: "hvs.token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vault, socket := newFakeVaultUnixSocket(t, responses)
+
+			client, err := tt.builder(NewHashicorpClientBuilder().WithAddress("unix://" + socket)).Build(t.Context())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			secret, err := client.Secrets().Generic("secret", "app").Read(t.Context())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if secret.Data["username"] != "user" {
+				t.Errorf("unexpected secret: %v", secret.Data)
+			}
+			// the vault agent injects its own token if the request has none
+			if secretRequest := vault.request("/v1/secret/app"); secretRequest == nil || secretRequest.token != tt.wantToken {
+				t.Errorf("unexpected secret request: %+v", secretRequest)
+			}
+		})
+	}
+}
+
+func TestNewUnixSocketHTTPClient(t *testing.T) {
+	_, socket := newFakeVaultUnixSocket(t, map[string]fakeVaultResponse{
+		"/v1/sys/health": {status: http.StatusOK, body: `{"initialized":true,"sealed":false}`},
+	})
+
+	tests := []struct {
+		name       string
+		socket     string
+		wantStatus int
+		wantErrMsg string
+	}{
+		{
+			name:       "socket",
+			socket:     socket,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "socket does not exist",
+			socket:     filepath.Join(t.TempDir(), "missing.sock"),
+			wantErrMsg: "connect: no such file or directory",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the host of the url is ignored, every request is sent to the socket
+			request, err := http.NewRequestWithContext(t.Context(), http.MethodGet, "http://localhost/v1/sys/health", nil)
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+			resp, err := newUnixSocketHTTPClient(tt.socket).Do(request)
+			if tt.wantErrMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrMsg) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErrMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// nolint:errcheck
+			defer resp.Body.Close() //gosec:disable G104
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("unexpected status: got %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestBuildServiceAccountAuth(t *testing.T) {
+	tests := []struct {
+		name       string
+		builder    func(builder ClientBuilder) ClientBuilder
+		path       string
+		response   fakeVaultResponse
+		want       TokenInfo
+		wantErrMsg string
+	}{
+		{
+			name: "kubernetes auth",
+			builder: func(builder ClientBuilder) ClientBuilder {
+				return builder.WithKubernetesAuth("kubernetes", "puller", "sa-token")
+			},
+			path:     "/v1/auth/kubernetes/login",
+			response: fakeVaultResponse{status: http.StatusOK, body: `{"data":null,"auth":{"client_token":"hvs.kubernetes","lease_duration":3600,"renewable":true}}`},
+			want:     TokenInfo{Token: "hvs.kubernetes", TTL: time.Hour, Renewable: true},
+		},
+		{
+			name: "kubernetes login without auth",
+			builder: func(builder ClientBuilder) ClientBuilder {
+				return builder.WithKubernetesAuth("kubernetes", "puller", "sa-token")
+			},
+			path:       "/v1/auth/kubernetes/login",
+			response:   fakeVaultResponse{status: http.StatusOK, body: `{"data":{}}`},
+			wantErrMsg: "kubernetes login response does not contain auth information",
+		},
+		{
+			name: "jwt auth",
+			builder: func(builder ClientBuilder) ClientBuilder {
+				return builder.WithJWTAuth("oidc", "puller", "sa-token")
+			},
+			path:     "/v1/auth/oidc/login",
+			response: fakeVaultResponse{status: http.StatusOK, body: `{"data":null,"auth":{"client_token":"hvs.jwt","lease_duration":600,"renewable":false}}`},
+			want:     TokenInfo{Token: "hvs.jwt", TTL: 10 * time.Minute, Renewable: false},
+		},
+		{
+			name: "jwt login without auth",
+			builder: func(builder ClientBuilder) ClientBuilder {
+				return builder.WithJWTAuth("oidc", "puller", "sa-token")
+			},
+			path:       "/v1/auth/oidc/login",
+			response:   fakeVaultResponse{status: http.StatusOK, body: `{"data":{}}`},
+			wantErrMsg: "jwt login response does not contain auth information",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vault, address := newFakeVault(t, map[string]fakeVaultResponse{tt.path: tt.response})
+
+			client, err := tt.builder(NewHashicorpClientBuilder().WithAddress(address)).Build(t.Context())
+			if tt.wantErrMsg != "" {
+				if err == nil || err.Error() != tt.wantErrMsg {
+					t.Fatalf("expected error %q, got %v", tt.wantErrMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			checkTokenInfo(t, client.Token(), tt.want)
+
+			loginRequest := vault.request(tt.path)
+			if loginRequest == nil {
+				t.Fatalf("no login request")
+			}
+			if loginRequest.body["jwt"] != "sa-token" || loginRequest.body["role"] != "puller" {
+				t.Errorf("unexpected login request: %v", loginRequest.body)
+			}
+		})
+	}
+}
+
+func TestBuildNamespace(t *testing.T) {
+	tests := []struct {
+		name          string
+		namespace     string
+		wantNamespace string
+	}{
+		{
+			name:          "namespace",
+			namespace:     "team-a/child",
+			wantNamespace: "team-a/child",
+		},
+		{
+			name:          "no namespace",
+			namespace:     "",
+			wantNamespace: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vault, address := newFakeVault(t, map[string]fakeVaultResponse{
+				"/v1/auth/kubernetes/login": {status: http.StatusOK, body: `{"data":null,"auth":{"client_token":"hvs.kubernetes","lease_duration":3600,"renewable":true}}`},
+				"/v1/secret/data/example":   {status: http.StatusOK, body: `{"data":{"data":{"username":"user"},"metadata":{"version":1}}}`},
+			})
+
+			client, err := NewHashicorpClientBuilder().
+				WithAddress(address).
+				WithNamespace(tt.namespace).
+				WithKubernetesAuth("kubernetes", "puller", "sa-token").
+				Build(t.Context())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if _, err := client.Secrets().KvV2("secret", "example").Read(t.Context(), 0); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for _, path := range []string{"/v1/auth/kubernetes/login", "/v1/secret/data/example"} {
+				request := vault.request(path)
+				if request == nil {
+					t.Fatalf("no request to %s", path)
+				}
+				if request.namespace != tt.wantNamespace {
+					t.Errorf("unexpected namespace of request to %s: got %q, want %q", path, request.namespace, tt.wantNamespace)
+				}
+			}
+		})
+	}
+}
+
+func newKvV2Client(t *testing.T, responses map[string]fakeVaultResponse) (*fakeVault, SecretKvV2Client) {
+	t.Helper()
+	vault, address := newFakeVault(t, responses)
+	client, err := NewHashicorpClientBuilder().
+		WithAddress(address).
+		WithTokenAuth("hvs.token", false, false, 0).
+		Build(t.Context())
+	if err != nil {
+		t.Fatalf("failed to build client: %v", err)
+	}
+	return vault, client.Secrets().KvV2("secret", "example")
+}
+
+func TestKvV2Read(t *testing.T) {
+	tests := []struct {
+		name       string
+		version    int
+		responses  map[string]fakeVaultResponse
+		wantQuery  string
+		want       map[string]any
+		wantErr    error
+		wantErrMsg string
+	}{
+		{
+			name:    "latest version",
+			version: 0,
+			responses: map[string]fakeVaultResponse{
+				"/v1/secret/data/example": {status: http.StatusOK, body: `{"data":{"data":{"username":"user"},"metadata":{"version":3}}}`},
+			},
+			wantQuery: "",
+			want:      map[string]any{"username": "user"},
+		},
+		{
+			name:    "specific version",
+			version: 2,
+			responses: map[string]fakeVaultResponse{
+				"/v1/secret/data/example": {status: http.StatusOK, body: `{"data":{"data":{"username":"previous"},"metadata":{"version":2}}}`},
+			},
+			wantQuery: "version=2",
+			want:      map[string]any{"username": "previous"},
+		},
+		{
+			name:       "deleted version",
+			version:    2,
+			responses:  map[string]fakeVaultResponse{},
+			wantQuery:  "version=2",
+			wantErr:    ErrSecretVersionNotFound,
+			wantErrMsg: "failed to read secret: secret version not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vault, client := newKvV2Client(t, tt.responses)
+
+			got, err := client.Read(t.Context(), tt.version)
+			if request := vault.request("/v1/secret/data/example"); request == nil || request.query != tt.wantQuery || request.token != "hvs.token" {
+				t.Errorf("unexpected read request: %+v", request)
+			}
+			if tt.wantErrMsg != "" {
+				if err == nil || err.Error() != tt.wantErrMsg || !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error %q, got %v", tt.wantErrMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unexpected data: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKvV2ReadMetadata(t *testing.T) {
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339Nano)
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339Nano)
+	metadataResponse := func(versions string) map[string]fakeVaultResponse {
+		return map[string]fakeVaultResponse{
+			"/v1/secret/metadata/example": {status: http.StatusOK, body: `{"data":{"current_version":4,"custom_metadata":{"expires-at":"2025-01-01T00:00:00Z"},"versions":` + versions + `}}`},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		responses  map[string]fakeVaultResponse
+		want       *SecretKvV2Metadata
+		wantErr    error
+		wantErrMsg string
+	}{
+		{
+			name: "available versions",
+			responses: metadataResponse(`{
+				"1":{"destroyed":true,"deletion_time":""},
+				"2":{"destroyed":false,"deletion_time":"` + past + `"},
+				"3":{"destroyed":false,"deletion_time":"` + future + `"},
+				"4":{"destroyed":false,"deletion_time":""}
+			}`),
+			want: &SecretKvV2Metadata{
+				CurrentVersion:    4,
+				AvailableVersions: []int{3, 4},
+				CustomMetadata:    map[string]string{"expires-at": "2025-01-01T00:00:00Z"},
+			},
+		},
+		{
+			name:       "secret does not exist",
+			responses:  map[string]fakeVaultResponse{},
+			wantErr:    ErrSecretNotFound,
+			wantErrMsg: "failed to read secret metadata: secret not found",
+		},
+		{
+			name:       "invalid deletion time",
+			responses:  metadataResponse(`{"4":{"destroyed":false,"deletion_time":"tomorrow"}}`),
+			wantErrMsg: `failed to parse deletion time of secret version 4: parsing time "tomorrow" as "2006-01-02T15:04:05.999999999Z07:00": cannot parse "tomorrow" as "2006"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, client := newKvV2Client(t, tt.responses)
+
+			got, err := client.ReadMetadata(t.Context())
+			if tt.wantErrMsg != "" {
+				if err == nil || err.Error() != tt.wantErrMsg || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+					t.Fatalf("expected error %q, got %v", tt.wantErrMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unexpected metadata: got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}